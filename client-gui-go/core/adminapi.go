@@ -0,0 +1,298 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// connInfo 是 activeConns 里一条连接的额外元数据快照，供 admin API 的
+// GET /connections 使用；bytesIn/bytesOut 用 atomic 更新，累加本身不持有
+// connMu（addBytesIn/addBytesOut 每次仍会短暂持有 connMu 查找这条记录）。
+type connInfo struct {
+	remote    string
+	target    string
+	user      string // 见 socks5auth.go，未认证连接为空
+	startedAt time.Time
+	bytesIn   int64
+	bytesOut  int64
+}
+
+// proxyMetrics 是 ProxyServer 的运行时计数器集合，GET /metrics 把它们原样
+// 输出成 Prometheus 文本格式。全部字段只能通过 sync/atomic 访问。
+type proxyMetrics struct {
+	connectionsOpened int64
+	connectionsClosed int64
+	echRefreshCount   int64
+	rulesVersion      int64
+
+	// closedBytesIn/closedBytesOut 累加已关闭连接在从 connInfos 里删除前的
+	// bytesIn/bytesOut，使 totalConnBytes 能返回单调递增的历史总量，而不
+	// 是只统计当前仍在跟踪的连接。
+	closedBytesIn  int64
+	closedBytesOut int64
+
+	dialErrMu sync.Mutex
+	dialErr   map[string]int64
+}
+
+// setConnTarget 记录 conn 对应的目标地址，在 handleTunnel 确认目标、握手
+// 成功之后调用。
+func (ps *ProxyServer) setConnTarget(conn net.Conn, target string) {
+	ps.connMu.Lock()
+	defer ps.connMu.Unlock()
+	if info, ok := ps.connInfos[conn]; ok {
+		info.target = target
+	}
+}
+
+// setConnIdentity 记录 conn 对应的已认证用户名（见 socks5auth.go），
+// identity 为 nil 时不做任何事，保持 info.user 为空。
+func (ps *ProxyServer) setConnIdentity(conn net.Conn, identity *Identity) {
+	if identity == nil {
+		return
+	}
+	ps.connMu.Lock()
+	defer ps.connMu.Unlock()
+	if info, ok := ps.connInfos[conn]; ok {
+		info.user = identity.User
+	}
+}
+
+func (ps *ProxyServer) addBytesIn(conn net.Conn, n int) {
+	ps.connMu.Lock()
+	info := ps.connInfos[conn]
+	ps.connMu.Unlock()
+	if info != nil {
+		atomic.AddInt64(&info.bytesIn, int64(n))
+	}
+}
+
+func (ps *ProxyServer) addBytesOut(conn net.Conn, n int) {
+	ps.connMu.Lock()
+	info := ps.connInfos[conn]
+	ps.connMu.Unlock()
+	if info != nil {
+		atomic.AddInt64(&info.bytesOut, int64(n))
+	}
+}
+
+// recordDialError 按 reason 给拨号失败计数，reason 是一个简短的、适合做
+// Prometheus 标签值的原因标识（如 "backend_dial_failed"）。
+func (ps *ProxyServer) recordDialError(reason string) {
+	ps.metrics.dialErrMu.Lock()
+	defer ps.metrics.dialErrMu.Unlock()
+	if ps.metrics.dialErr == nil {
+		ps.metrics.dialErr = make(map[string]int64)
+	}
+	ps.metrics.dialErr[reason]++
+}
+
+// connectionSnapshot 是 GET /connections 里一条记录的 JSON 形状。
+type connectionSnapshot struct {
+	Remote   string `json:"remote"`
+	Target   string `json:"target"`
+	User     string `json:"user,omitempty"`
+	BytesIn  int64  `json:"bytes_in"`
+	BytesOut int64  `json:"bytes_out"`
+	Duration string `json:"duration"`
+}
+
+// adminStatus 是 GET /status 的 JSON 形状。
+type adminStatus struct {
+	Running      bool   `json:"running"`
+	UptimeSecond int64  `json:"uptime_seconds"`
+	ECHLoaded    bool   `json:"ech_loaded"`
+	RulesVersion int64  `json:"rules_version"`
+	RulesCount   int    `json:"rules_count"`
+	ServerAddr   string `json:"server_addr"`
+}
+
+// AdminServer 是可选的、默认关闭的管理/指标 HTTP 接口，暴露 ProxyServer
+// 的运行时状态，用于不重启进程就能完成的运维操作（见 ProxyConfig.AdminAddr）。
+type AdminServer struct {
+	ps        *ProxyServer
+	srv       *http.Server
+	startedAt time.Time
+}
+
+// NewAdminServer 创建绑定到 addr 的管理接口；addr 为空表示不启用（调用方
+// 不应调用 Start）。
+func NewAdminServer(ps *ProxyServer, addr string) *AdminServer {
+	a := &AdminServer{ps: ps, startedAt: time.Now()}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", a.handleStatus)
+	mux.HandleFunc("/connections", a.handleConnections)
+	mux.HandleFunc("/ech/refresh", a.handleECHRefresh)
+	mux.HandleFunc("/geoip/reload", a.handleGeoIPReload)
+	mux.HandleFunc("/config/reload", a.handleConfigReload)
+	mux.HandleFunc("/metrics", a.handleMetrics)
+
+	a.srv = &http.Server{Addr: addr, Handler: mux}
+	return a
+}
+
+// Start 在后台开始监听，监听错误（例如地址已被占用）通过返回的 channel
+// 异步报告一次。
+func (a *AdminServer) Start() <-chan error {
+	errCh := make(chan error, 1)
+	go func() {
+		if err := a.srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			errCh <- err
+		}
+	}()
+	return errCh
+}
+
+// Stop 关闭管理接口。
+func (a *AdminServer) Stop() error {
+	return a.srv.Close()
+}
+
+func (a *AdminServer) handleStatus(w http.ResponseWriter, r *http.Request) {
+	ps := a.ps
+	_, echErr := ps.getECHList()
+
+	ps.rulesMu.RLock()
+	rulesCount := ps.rules.Count()
+	ps.rulesMu.RUnlock()
+
+	writeAdminJSON(w, adminStatus{
+		Running:      ps.IsRunning(),
+		UptimeSecond: int64(time.Since(a.startedAt).Seconds()),
+		ECHLoaded:    echErr == nil,
+		RulesVersion: ps.RulesVersion(),
+		RulesCount:   rulesCount,
+		ServerAddr:   ps.config.ServerAddr,
+	})
+}
+
+func (a *AdminServer) handleConnections(w http.ResponseWriter, r *http.Request) {
+	ps := a.ps
+	ps.connMu.Lock()
+	snapshots := make([]connectionSnapshot, 0, len(ps.connInfos))
+	for _, info := range ps.connInfos {
+		snapshots = append(snapshots, connectionSnapshot{
+			Remote:   info.remote,
+			Target:   info.target,
+			User:     info.user,
+			BytesIn:  atomic.LoadInt64(&info.bytesIn),
+			BytesOut: atomic.LoadInt64(&info.bytesOut),
+			Duration: time.Since(info.startedAt).String(),
+		})
+	}
+	ps.connMu.Unlock()
+	writeAdminJSON(w, snapshots)
+}
+
+func (a *AdminServer) handleECHRefresh(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := a.ps.refreshECH(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeAdminJSON(w, map[string]bool{"ok": true})
+}
+
+func (a *AdminServer) handleGeoIPReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := a.ps.loadGeoIPDB(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeAdminJSON(w, map[string]bool{"ok": true})
+}
+
+func (a *AdminServer) handleConfigReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := a.ps.ReloadConfig(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeAdminJSON(w, map[string]bool{"ok": true})
+}
+
+func (a *AdminServer) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	ps := a.ps
+	hits, misses, cacheSize := ps.DNSCacheStats()
+	total := hits + misses
+	hitRatio := 0.0
+	if total > 0 {
+		hitRatio = float64(hits) / float64(total)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	fmt.Fprintf(w, "# HELP echwk_connections_opened_total Connections accepted since start.\n")
+	fmt.Fprintf(w, "# TYPE echwk_connections_opened_total counter\n")
+	fmt.Fprintf(w, "echwk_connections_opened_total %d\n", atomic.LoadInt64(&ps.metrics.connectionsOpened))
+
+	fmt.Fprintf(w, "# HELP echwk_connections_closed_total Connections closed since start.\n")
+	fmt.Fprintf(w, "# TYPE echwk_connections_closed_total counter\n")
+	fmt.Fprintf(w, "echwk_connections_closed_total %d\n", atomic.LoadInt64(&ps.metrics.connectionsClosed))
+
+	bytesIn, bytesOut := ps.totalConnBytes()
+	fmt.Fprintf(w, "# HELP echwk_bytes_in_total Bytes received from backend and written to clients.\n")
+	fmt.Fprintf(w, "# TYPE echwk_bytes_in_total counter\n")
+	fmt.Fprintf(w, "echwk_bytes_in_total %d\n", bytesIn)
+
+	fmt.Fprintf(w, "# HELP echwk_bytes_out_total Bytes read from clients and sent to backend.\n")
+	fmt.Fprintf(w, "# TYPE echwk_bytes_out_total counter\n")
+	fmt.Fprintf(w, "echwk_bytes_out_total %d\n", bytesOut)
+
+	fmt.Fprintf(w, "# HELP echwk_doh_cache_hit_ratio Hit ratio of the DoH response cache.\n")
+	fmt.Fprintf(w, "# TYPE echwk_doh_cache_hit_ratio gauge\n")
+	fmt.Fprintf(w, "echwk_doh_cache_hit_ratio %f\n", hitRatio)
+
+	fmt.Fprintf(w, "# HELP echwk_doh_cache_size Current entry count of the DoH response cache.\n")
+	fmt.Fprintf(w, "# TYPE echwk_doh_cache_size gauge\n")
+	fmt.Fprintf(w, "echwk_doh_cache_size %d\n", cacheSize)
+
+	fmt.Fprintf(w, "# HELP echwk_ech_refresh_total ECH config refreshes since start.\n")
+	fmt.Fprintf(w, "# TYPE echwk_ech_refresh_total counter\n")
+	fmt.Fprintf(w, "echwk_ech_refresh_total %d\n", atomic.LoadInt64(&ps.metrics.echRefreshCount))
+
+	ps.metrics.dialErrMu.Lock()
+	fmt.Fprintf(w, "# HELP echwk_dial_errors_total Dial failures by reason.\n")
+	fmt.Fprintf(w, "# TYPE echwk_dial_errors_total counter\n")
+	for reason, count := range ps.metrics.dialErr {
+		fmt.Fprintf(w, "echwk_dial_errors_total{reason=%q} %d\n", reason, count)
+	}
+	ps.metrics.dialErrMu.Unlock()
+}
+
+// totalConnBytes 返回自启动以来的累计收发字节数：已关闭连接的字节数在
+// removeConnection 里被并入 metrics.closedBytesIn/closedBytesOut，这里
+// 再加上当前仍在跟踪的连接的字节数，使结果单调递增，适合 /metrics 里的
+// counter 语义（rate()/increase() 可以直接用）。
+func (ps *ProxyServer) totalConnBytes() (in, out int64) {
+	in = atomic.LoadInt64(&ps.metrics.closedBytesIn)
+	out = atomic.LoadInt64(&ps.metrics.closedBytesOut)
+
+	ps.connMu.Lock()
+	defer ps.connMu.Unlock()
+	for _, info := range ps.connInfos {
+		in += atomic.LoadInt64(&info.bytesIn)
+		out += atomic.LoadInt64(&info.bytesOut)
+	}
+	return in, out
+}
+
+func writeAdminJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,201 @@
+package core
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// happyEyeballsStagger 是 RFC 8305 建议的、相邻两次连接尝试之间等待的
+// 时间间隔（按地址逐个错开，不区分地址族）。
+const happyEyeballsStagger = 250 * time.Millisecond
+
+// ipVersionPreference 把 ProxyConfig.IPVersion 标准化成一个已知取值，空
+// 字符串（未配置）当作 "dual" 处理，即现有行为：两个地址族都尝试，不偏重
+// 任何一方。
+func ipVersionPreference(raw string) string {
+	switch raw {
+	case "ipv4-only", "ipv6-only", "ipv4-prefer", "ipv6-prefer", "dual":
+		return raw
+	default:
+		return "dual"
+	}
+}
+
+// dialTCPPreferred 解析 host 的 A/AAAA 记录，按 ProxyConfig.IPVersion 配置
+// 过滤和排序候选地址，然后以 happy-eyeballs 方式发起连接。
+//
+// 解析经 resolveHostViaDoH 走内置的 DoH 通道（和 queryDoHForProxyCached
+// 同一条路径，带 TTL 缓存），而不是本机系统解析器，否则每次直连拨号都会
+// 把目标域名泄露给本地/上游 DNS——这对一个本意是保护流量的 ECH 代理来说
+// 是不可接受的信息泄露。
+func (ps *ProxyServer) dialTCPPreferred(host, port string, timeout time.Duration) (net.Conn, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		var d net.Dialer
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		return d.DialContext(ctx, "tcp", net.JoinHostPort(host, port))
+	}
+
+	ips, err := ps.resolveHostViaDoH(host)
+	if err != nil {
+		return nil, err
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("未解析到 %s 的任何地址", host)
+	}
+
+	var v4, v6 []net.IP
+	for _, ip := range ips {
+		if ip.To4() != nil {
+			v4 = append(v4, ip)
+		} else {
+			v6 = append(v6, ip)
+		}
+	}
+
+	var ordered []net.IP
+	switch ipVersionPreference(ps.config.IPVersion) {
+	case "ipv4-only":
+		ordered = v4
+	case "ipv6-only":
+		ordered = v6
+	case "ipv6-prefer":
+		ordered = append(append(ordered, v6...), v4...)
+	default: // "ipv4-prefer", "dual"
+		ordered = append(append(ordered, v4...), v6...)
+	}
+	if len(ordered) == 0 {
+		return nil, fmt.Errorf("%s 在当前 IPVersion 限制下没有可用地址", host)
+	}
+
+	return ps.happyEyeballsDial(ordered, port, timeout)
+}
+
+// resolveHostViaDoH 分别查询 host 的 A 和 AAAA 记录，经
+// queryDoHForProxyCached（ECH 隧道转发 + TTL 缓存，见 dnscache.go）而不是
+// 本机系统解析器，避免把目标域名泄露出去。两种记录类型里只要有一种查询
+// 失败就忽略（不少域名本就没有 AAAA 记录），两种都失败才返回错误。
+func (ps *ProxyServer) resolveHostViaDoH(host string) ([]net.IP, error) {
+	var ips []net.IP
+	var firstErr error
+	for _, qtype := range []uint16{typeA, typeAAAA} {
+		response, err := ps.queryDoHForProxyCached(buildDNSQuery(host, qtype))
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		addrs, err := parseDNSAddresses(response, qtype)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		ips = append(ips, addrs...)
+	}
+	if len(ips) == 0 && firstErr != nil {
+		return nil, fmt.Errorf("DoH 解析 %s 失败: %w", host, firstErr)
+	}
+	return ips, nil
+}
+
+// parseDNSAddresses 从一个通用的 DoH 应答里提取 rrType（typeA 或
+// typeAAAA）对应的全部地址记录，复用 dnscache.go 里已有的通用 RR 读取
+// helper（skipDNSName/readRRRData），不像 parseDNSResponse 那样只认
+// HTTPS 记录。
+func parseDNSAddresses(response []byte, rrType uint16) ([]net.IP, error) {
+	if len(response) < 12 {
+		return nil, errors.New("DNS 响应过短")
+	}
+	ancount := int(binary.BigEndian.Uint16(response[6:8]))
+
+	offset := skipDNSName(response, 12)
+	offset += 4 // qtype + qclass
+	if offset > len(response) {
+		return nil, errors.New("DNS 响应越界")
+	}
+
+	var ips []net.IP
+	for i := 0; i < ancount; i++ {
+		gotType, rdata, next, ok := readRRRData(response, offset)
+		if !ok {
+			break
+		}
+		if gotType == rrType {
+			if ip := net.IP(rdata); len(rdata) == net.IPv4len || len(rdata) == net.IPv6len {
+				ips = append(ips, ip)
+			}
+		}
+		offset = next
+	}
+	return ips, nil
+}
+
+// dialResult 是 happyEyeballsDial 里每个并发拨号尝试往 results channel
+// 写入的结果。
+type dialResult struct {
+	conn net.Conn
+	err  error
+}
+
+// happyEyeballsDial 依次（每隔 happyEyeballsStagger）对 addrs 发起并发连接
+// 尝试，优先的地址族排在前面最先尝试；第一个成功的连接获胜，其余仍在
+// 等待或进行中的尝试被取消。
+func (ps *ProxyServer) happyEyeballsDial(addrs []net.IP, port string, timeout time.Duration) (net.Conn, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	results := make(chan dialResult, len(addrs))
+	var dialer net.Dialer
+
+	for i, ip := range addrs {
+		addr := net.JoinHostPort(ip.String(), port)
+		delay := time.Duration(i) * happyEyeballsStagger
+		go func(addr string, delay time.Duration) {
+			timer := time.NewTimer(delay)
+			defer timer.Stop()
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				results <- dialResult{err: ctx.Err()}
+				return
+			}
+			dctx, dcancel := context.WithTimeout(ctx, timeout)
+			defer dcancel()
+			conn, err := dialer.DialContext(dctx, "tcp", addr)
+			results <- dialResult{conn: conn, err: err}
+		}(addr, delay)
+	}
+
+	var lastErr error
+	for remaining := len(addrs); remaining > 0; remaining-- {
+		res := <-results
+		if res.err == nil {
+			cancel() // 已有连接成功，取消其余仍在等待/进行中的尝试
+			// cancel() 无法中止已经拨通、正卡在往 results 写结果的尝试：
+			// 它们仍会把连接推进这个带缓冲的 channel，若没人接收就永远不
+			// 会被关闭，造成每场竞速一个泄漏的 socket。剩下的名额交给
+			// 后台 goroutine 排空，迟到的连接直接 Close。
+			go drainLateDials(results, remaining-1)
+			return res.conn, nil
+		}
+		lastErr = res.err
+	}
+	cancel()
+	return nil, fmt.Errorf("所有地址均连接失败: %w", lastErr)
+}
+
+// drainLateDials 在 happyEyeballsDial 已经返回获胜连接之后，继续接收
+// 剩余 n 个仍在途的拨号结果，关闭其中任何迟到的成功连接，避免它们泄漏。
+func drainLateDials(results <-chan dialResult, n int) {
+	for i := 0; i < n; i++ {
+		if res := <-results; res.conn != nil {
+			res.conn.Close()
+		}
+	}
+}
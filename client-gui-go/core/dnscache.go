@@ -0,0 +1,313 @@
+package core
+
+import (
+	"container/list"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// dnsCacheMaxEntries 限制 DNS 应答缓存的最大条目数，超出后按 LRU 淘汰。
+const dnsCacheMaxEntries = 2048
+
+// dnsCacheRefreshThreshold 是触发异步刷新的剩余 TTL 比例：命中一条已经用掉
+// 超过 90% 生存期的记录时，在返回缓存结果的同时另起一个 goroutine 去刷新
+// 它，避免下一次请求撞上同步查询的延迟尖峰。
+const dnsCacheRefreshThreshold = 0.10
+
+// dnsCacheEntry 是一条缓存的 DoH 应答。
+type dnsCacheEntry struct {
+	key        string
+	response   []byte
+	storedAt   time.Time
+	expiresAt  time.Time
+	refreshing int32 // 用 atomic CAS 避免同一条目被并发刷新多次
+}
+
+func (e *dnsCacheEntry) ttl() time.Duration {
+	return e.expiresAt.Sub(e.storedAt)
+}
+
+// dnsCacheStats 是 dnsCache.Stats 返回的只读快照。
+type dnsCacheStats struct {
+	Hits   int64
+	Misses int64
+	Size   int
+}
+
+// dnsCache 是一个按 DNS 问题（qname+qtype+qclass）为键、遵循应答 TTL 过期
+// 的 LRU 缓存，供 queryDoHForProxy 使用。
+type dnsCache struct {
+	mu       sync.Mutex
+	capacity int
+	items    map[string]*list.Element
+	order    *list.List
+
+	hits   int64
+	misses int64
+}
+
+func newDNSCache(capacity int) *dnsCache {
+	return &dnsCache{
+		capacity: capacity,
+		items:    make(map[string]*list.Element, capacity),
+		order:    list.New(),
+	}
+}
+
+// Get 返回 key 对应的仍然有效的缓存应答；过期条目视为未命中并被清除。
+func (c *dnsCache) Get(key string, now time.Time) (*dnsCacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+	entry := el.Value.(*dnsCacheEntry)
+	if now.After(entry.expiresAt) {
+		c.order.Remove(el)
+		delete(c.items, key)
+		c.misses++
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	c.hits++
+	return entry, true
+}
+
+// Set 写入或覆盖 key 对应的缓存应答，超出容量时淘汰最久未使用的条目。
+func (c *dnsCache) Set(key string, entry *dnsCacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		el.Value = entry
+		c.order.MoveToFront(el)
+		return
+	}
+
+	el := c.order.PushFront(entry)
+	c.items[key] = el
+
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		if oldest != nil {
+			c.order.Remove(oldest)
+			delete(c.items, oldest.Value.(*dnsCacheEntry).key)
+		}
+	}
+}
+
+// Stats 返回当前的命中/未命中计数和条目数。
+func (c *dnsCache) Stats() dnsCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return dnsCacheStats{Hits: c.hits, Misses: c.misses, Size: c.order.Len()}
+}
+
+// DNSCacheStats 返回 DoH 应答缓存的命中/未命中次数和当前条目数，供 GUI 或
+// 控制 API 展示缓存效果。
+func (ps *ProxyServer) DNSCacheStats() (hits, misses int64, size int) {
+	stats := ps.dnsCache.Stats()
+	return stats.Hits, stats.Misses, stats.Size
+}
+
+// dnsQuestionKey 从 wire-format 的 DNS 查询里提取问题部分（qname+qtype+
+// qclass）作为缓存键，忽略报文开头的事务 ID，这样同一个问题的重复查询
+// 能命中同一条缓存，即使每次请求用的事务 ID 不同。
+func dnsQuestionKey(query []byte) (string, error) {
+	if len(query) < 12 {
+		return "", errors.New("DNS 查询过短")
+	}
+	offset := 12
+	var labels []string
+	for offset < len(query) && query[offset] != 0 {
+		l := int(query[offset])
+		offset++
+		if offset+l > len(query) {
+			return "", errors.New("DNS 查询名称越界")
+		}
+		labels = append(labels, strings.ToLower(string(query[offset:offset+l])))
+		offset += l
+	}
+	offset++ // 跳过结尾的 0x00
+	if offset+4 > len(query) {
+		return "", errors.New("DNS 查询缺少 qtype/qclass")
+	}
+	qtype := binary.BigEndian.Uint16(query[offset : offset+2])
+	qclass := binary.BigEndian.Uint16(query[offset+2 : offset+4])
+	return fmt.Sprintf("%s|%d|%d", strings.Join(labels, "."), qtype, qclass), nil
+}
+
+// dnsResponseTTL 解析应答报文，返回应该缓存多久：
+//   - 有应答记录（ANCOUNT > 0）时，取所有应答记录里最小的 TTL，跟 DoH
+//     代理的常规做法一致——缓存有效期不能超过最短命的那条记录；
+//   - 没有应答记录（NXDOMAIN/NODATA）时，按 RFC 2308 走负缓存：从权威
+//     区（authority section）的 SOA 记录里取 MINIMUM 字段；
+//   - 两者都解析不出时返回 false，调用方应该按"不可缓存"处理。
+func dnsResponseTTL(response []byte) (time.Duration, bool) {
+	if len(response) < 12 {
+		return 0, false
+	}
+	ancount := int(binary.BigEndian.Uint16(response[6:8]))
+	nscount := int(binary.BigEndian.Uint16(response[8:10]))
+
+	offset := 12
+	offset = skipDNSName(response, offset)
+	offset += 4 // qtype + qclass
+	if offset > len(response) {
+		return 0, false
+	}
+
+	if ancount > 0 {
+		minTTL := -1
+		for i := 0; i < ancount; i++ {
+			ttl, next, ok := readRRTTL(response, offset)
+			if !ok {
+				break
+			}
+			if minTTL == -1 || ttl < minTTL {
+				minTTL = ttl
+			}
+			offset = next
+		}
+		if minTTL >= 0 {
+			return time.Duration(minTTL) * time.Second, true
+		}
+		return 0, false
+	}
+
+	// 负缓存：在 authority section 里找 SOA 记录的 MINIMUM 字段。
+	for i := 0; i < nscount; i++ {
+		rrType, rdata, next, ok := readRRRData(response, offset)
+		if !ok {
+			break
+		}
+		if rrType == 6 && len(rdata) >= 20 { // SOA
+			minimum := binary.BigEndian.Uint32(rdata[len(rdata)-4:])
+			return time.Duration(minimum) * time.Second, true
+		}
+		offset = next
+	}
+	return 0, false
+}
+
+// skipDNSName 跳过从 offset 开始的一个 DNS 域名（含压缩指针），返回名称
+// 之后的偏移量。
+func skipDNSName(data []byte, offset int) int {
+	for offset < len(data) {
+		if data[offset]&0xC0 == 0xC0 {
+			return offset + 2
+		}
+		if data[offset] == 0 {
+			return offset + 1
+		}
+		offset += int(data[offset]) + 1
+	}
+	return offset
+}
+
+// readRRTTL 读取 offset 处一条资源记录的 TTL 字段，返回该记录结束后的
+// 偏移量。
+func readRRTTL(response []byte, offset int) (ttl int, next int, ok bool) {
+	offset = skipDNSName(response, offset)
+	if offset+10 > len(response) {
+		return 0, 0, false
+	}
+	ttl = int(binary.BigEndian.Uint32(response[offset+4 : offset+8]))
+	dataLen := int(binary.BigEndian.Uint16(response[offset+8 : offset+10]))
+	offset += 10
+	if offset+dataLen > len(response) {
+		return 0, 0, false
+	}
+	return ttl, offset + dataLen, true
+}
+
+// readRRRData 读取 offset 处一条资源记录的类型和 RDATA，返回该记录结束
+// 后的偏移量。
+func readRRRData(response []byte, offset int) (rrType uint16, rdata []byte, next int, ok bool) {
+	offset = skipDNSName(response, offset)
+	if offset+10 > len(response) {
+		return 0, nil, 0, false
+	}
+	rrType = binary.BigEndian.Uint16(response[offset : offset+2])
+	dataLen := int(binary.BigEndian.Uint16(response[offset+8 : offset+10]))
+	offset += 10
+	if offset+dataLen > len(response) {
+		return 0, nil, 0, false
+	}
+	return rrType, response[offset : offset+dataLen], offset + dataLen, true
+}
+
+// queryDoHForProxyCached 是 queryDoHForProxy 的带缓存版本：按问题
+// （qname+qtype+qclass）查缓存，命中且接近过期时在返回旧值的同时异步
+// 刷新；未命中或解析失败时直接穿透到 queryDoHForProxy 并在成功后按应答
+// TTL 写入缓存。解析查询本身失败（不是合法的 DNS 报文）时不缓存，直接
+// 穿透。
+func (ps *ProxyServer) queryDoHForProxyCached(dnsQuery []byte) ([]byte, error) {
+	key, keyErr := dnsQuestionKey(dnsQuery)
+	if keyErr != nil {
+		return ps.queryDoHForProxy(dnsQuery)
+	}
+
+	now := time.Now()
+	if entry, ok := ps.dnsCache.Get(key, now); ok {
+		if remaining := entry.expiresAt.Sub(now); remaining < time.Duration(float64(entry.ttl())*dnsCacheRefreshThreshold) {
+			if atomic.CompareAndSwapInt32(&entry.refreshing, 0, 1) {
+				go ps.refreshDNSCacheEntry(key, dnsQuery)
+			}
+		}
+		return withQueryID(entry.response, dnsQuery), nil
+	}
+
+	response, err := ps.queryDoHForProxy(dnsQuery)
+	if err != nil {
+		return nil, err
+	}
+	ps.storeDNSCacheEntry(key, response, now)
+	return withQueryID(response, dnsQuery), nil
+}
+
+// withQueryID 返回 response 的一份拷贝，并把开头两字节（DNS 报文 ID）替换
+// 为 dnsQuery 的 ID。缓存条目存的是首次写入时某次查询的响应，其 ID 大概率
+// 与后续命中缓存的查询不一致；stub resolver 会校验响应 ID 与自己发出的查
+// 询 ID 一致（基础防伪造手段），ID 对不上就会直接丢弃这个本该有效的命中。
+func withQueryID(response, dnsQuery []byte) []byte {
+	if len(response) < 2 || len(dnsQuery) < 2 {
+		return response
+	}
+	out := make([]byte, len(response))
+	copy(out, response)
+	binary.BigEndian.PutUint16(out[0:2], binary.BigEndian.Uint16(dnsQuery[0:2]))
+	return out
+}
+
+// refreshDNSCacheEntry 在后台重新查询 key 对应的问题并刷新缓存，供接近
+// 过期的缓存命中触发。
+func (ps *ProxyServer) refreshDNSCacheEntry(key string, dnsQuery []byte) {
+	response, err := ps.queryDoHForProxy(dnsQuery)
+	if err != nil {
+		ps.logf("[DNS缓存] 后台刷新 %s 失败: %v", key, err)
+		return
+	}
+	ps.storeDNSCacheEntry(key, response, time.Now())
+}
+
+func (ps *ProxyServer) storeDNSCacheEntry(key string, response []byte, now time.Time) {
+	ttl, ok := dnsResponseTTL(response)
+	if !ok || ttl <= 0 {
+		return // 不可缓存（例如无法确定 TTL），下次照常穿透查询
+	}
+	ps.dnsCache.Set(key, &dnsCacheEntry{
+		key:       key,
+		response:  response,
+		storedAt:  now,
+		expiresAt: now.Add(ttl),
+	})
+}
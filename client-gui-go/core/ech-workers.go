@@ -18,11 +18,15 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/oschwald/maxminddb-golang"
 )
 
 // ProxyConfig 代理配置
@@ -33,7 +37,40 @@ type ProxyConfig struct {
 	Token       string
 	DNSServer   string
 	ECHDomain   string
-	RoutingMode string // 分流模式: "global", "bypass_cn", "none"
+	RoutingMode string // 分流模式: "global", "none", "bypass_cn", "bypass:<codes>", "only:<codes>"（codes 为逗号分隔的 ISO 国家代码）
+	RulesFile   string // 规则文件路径（JSON 或简化 YAML），见 rules.go；为空时退回 RoutingMode 的逻辑
+
+	GeoIPDBPath          string        // MaxMind 格式 .mmdb 文件路径，见 geoip.go；为空时默认 "GeoLite2-Country.mmdb"
+	GeoIPDownloadURL     string        // 数据库缺失或刷新时的下载地址；为空则不自动下载
+	GeoIPLicenseKey      string        // 追加到下载地址的 MaxMind license_key 查询参数
+	GeoIPRefreshInterval time.Duration // 定期重新下载并加载数据库的间隔；0 表示不自动刷新
+
+	IPVersion string // 出站连接的地址族偏好，见 dial.go；为空等同于 "dual"
+
+	// WebSocket 连接池（见 wspool.go）。WSPoolMaxStreamsPerConn<=0 表示不
+	// 启用连接池，ProxyServer.wsPool 保持 nil
+	WSPoolMaxStreamsPerConn int
+	WSPoolIdleTimeout       time.Duration
+	WSPoolProbeInterval     time.Duration
+	// WSPoolSize 是启动时预先建立的 warm 连接数，<=0 表示不预热，仍然按
+	// 需惰性建连（第一次 Acquire 才握手）
+	WSPoolSize int
+
+	// AdminAddr 是管理/指标 HTTP 接口的监听地址（见 adminapi.go），为空表示
+	// 不启用，默认关闭
+	AdminAddr string
+
+	// TunnelFraming 为 true 时，handleTunnel 在 WS BinaryMessage 内部用
+	// tunnelCodec（见 tunnelcodec.go）显式加上长度前缀再转发；默认 false，
+	// 保持现有"一次 conn.Read 对应一条 WS 消息"的行为，确保不需要后端
+	// Worker 同步升级也能正常工作
+	TunnelFraming      bool
+	TunnelMaxFrameSize int
+
+	// Auth 为非 nil 时，SOCKS5 要求 RFC 1929 用户名密码认证（见
+	// socks5auth.go），HTTP 代理同样按 Proxy-Authorization: Basic 校验；
+	// 为 nil 时保持现有无认证行为
+	Auth Authenticator
 }
 
 // ProxyServer 代理服务器
@@ -46,8 +83,12 @@ type ProxyServer struct {
 
 	// 活动连接跟踪
 	activeConns map[net.Conn]bool
+	connInfos   map[net.Conn]*connInfo // 见 adminapi.go，remote/target/字节数/时长
 	connMu      sync.Mutex
 
+	// 运行时指标（见 adminapi.go），admin API 的 /metrics 端点据此输出
+	metrics proxyMetrics
+
 	// ECH配置
 	echListMu sync.RWMutex
 	echList   []byte
@@ -60,8 +101,40 @@ type ProxyServer struct {
 	chinaIPV6RangesMu sync.RWMutex
 	chinaIPV6Ranges   []ipRangeV6
 
+	// isChinaIP 结果缓存（见 iplru.go），按已加载的IP段表每次替换时清空
+	chinaIPLookupCache *ipLRUCache
+
+	// 分流规则引擎（见 rules.go），nil 表示未加载规则文件，回退到 RoutingMode
+	rulesMu sync.RWMutex
+	rules   *RoutingEngine
+
+	// GeoIP 数据库（见 geoip.go），nil 表示未加载，LookupCountry 回退到
+	// chinaIPRanges/chinaIPV6Ranges 文本列表
+	geoipMu sync.RWMutex
+	geoipDB *maxminddb.Reader
+
+	// DoH 应答缓存（见 dnscache.go），按 TTL 过期，减少热门域名重复走一次
+	// ECH 转发的 DoH 往返
+	dnsCache *dnsCache
+
+	// WebSocket 连接池（见 wspool.go），nil 表示未启用
+	wsPool *WSPool
+
+	// 管理/指标 HTTP 接口（见 adminapi.go），nil 表示未启用
+	adminServer *AdminServer
+
 	// 日志回调
 	logCallback func(string)
+
+	// connWG 跟踪每一个仍在处理中的长生命周期协程（每条 accept 出的连接、
+	// ping 保活、UDP 中继），Shutdown 据此判断是否已经排空完毕
+	connWG sync.WaitGroup
+	// shutdownOnce 保证 stopChan 只被关闭一次：Stop 和 Shutdown 都可能触发
+	shutdownOnce sync.Once
+
+	// onShutdownMu/onShutdown 见 RegisterOnShutdown
+	onShutdownMu sync.Mutex
+	onShutdown   []func()
 }
 
 // ipRange 表示一个IPv4 IP范围
@@ -91,12 +164,93 @@ func NewProxyServer(config ProxyConfig, logCallback func(string)) *ProxyServer {
 		config.RoutingMode = "global"
 	}
 
-	return &ProxyServer{
-		config:      config,
-		stopChan:    make(chan struct{}),
-		activeConns: make(map[net.Conn]bool),
-		logCallback: logCallback,
+	ps := &ProxyServer{
+		config:             config,
+		stopChan:           make(chan struct{}),
+		activeConns:        make(map[net.Conn]bool),
+		chinaIPLookupCache: newIPLRUCache(chinaIPLookupCacheSize),
+		dnsCache:           newDNSCache(dnsCacheMaxEntries),
+		logCallback:        logCallback,
+	}
+
+	if config.RulesFile != "" {
+		if err := ps.LoadRulesFile(config.RulesFile); err != nil {
+			ps.logf("[警告] 加载分流规则文件 %s 失败: %v，回退到 RoutingMode", config.RulesFile, err)
+		}
+	}
+
+	return ps
+}
+
+// SetRoutingMode 热更新分流模式，无需重启代理即可生效。
+func (ps *ProxyServer) SetRoutingMode(mode string) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.config.RoutingMode = mode
+}
+
+// LoadRulesFile 加载（或重新加载）path 指向的规则文件，加载成功后原子替换
+// 正在使用的规则引擎；加载失败时保留原有规则不变。可在服务运行期间调用，
+// 用于配合 SIGHUP 或控制 API 的热重载（见 rules.go）。
+func (ps *ProxyServer) LoadRulesFile(path string) error {
+	engine, err := LoadRulesFile(path)
+	if err != nil {
+		return err
+	}
+	ps.rulesMu.Lock()
+	ps.rules = engine
+	ps.rulesMu.Unlock()
+	atomic.AddInt64(&ps.metrics.rulesVersion, 1)
+	ps.logf("[分流] 已加载规则文件: %s (%d 条规则)", path, engine.Count())
+	return nil
+}
+
+// RulesVersion 返回规则引擎已被成功（重新）加载的次数，每次 LoadRulesFile
+// 成功都会递增；admin API 的 GET /status 用它让调用方判断规则是否变化过。
+func (ps *ProxyServer) RulesVersion() int64 {
+	return atomic.LoadInt64(&ps.metrics.rulesVersion)
+}
+
+// ReloadConfig 重新加载 RulesFile 和 GeoIP 数据库（如果配置了的话），供
+// admin API 的 POST /config/reload 使用，在不重启代理的情况下应用磁盘上
+// 已更新的规则/数据库文件。
+func (ps *ProxyServer) ReloadConfig() error {
+	var errs []string
+	if ps.config.RulesFile != "" {
+		if err := ps.LoadRulesFile(ps.config.RulesFile); err != nil {
+			errs = append(errs, fmt.Sprintf("规则文件: %v", err))
+		}
+	}
+	if ps.routingNeedsGeoIP() {
+		if err := ps.loadGeoIPDB(); err != nil {
+			errs = append(errs, fmt.Sprintf("GeoIP 数据库: %v", err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("重新加载配置时出现错误: %s", strings.Join(errs, "; "))
 	}
+	return nil
+}
+
+// SetDNSServer 热更新 DOH 服务地址，下一次查询 ECH 配置时生效。
+func (ps *ProxyServer) SetDNSServer(dns string) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.config.DNSServer = dns
+}
+
+// SetECHDomain 热更新 ECH 域名，下一次查询 ECH 配置时生效。
+func (ps *ProxyServer) SetECHDomain(domain string) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.config.ECHDomain = domain
+}
+
+// SetToken 热更新身份令牌，下一次建立连接时生效。
+func (ps *ProxyServer) SetToken(token string) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.config.Token = token
 }
 
 // logf 内部日志函数
@@ -133,42 +287,68 @@ func (ps *ProxyServer) Start() error {
 		return fmt.Errorf("获取 ECH 配置失败: %w", err)
 	}
 
-	// 加载中国IP列表（如果需要）
-	if ps.config.RoutingMode == "bypass_cn" {
-		ps.logf("[启动] 分流模式: 跳过中国大陆，正在加载中国IP列表...")
-		ipv4Count := 0
-		ipv6Count := 0
-
-		if err := ps.loadChinaIPList(); err != nil {
-			ps.logf("[警告] 加载中国IPv4列表失败: %v", err)
-		} else {
-			ps.chinaIPRangesMu.RLock()
-			ipv4Count = len(ps.chinaIPRanges)
-			ps.chinaIPRangesMu.RUnlock()
-		}
+	// 加载分流判断所需的地理位置数据（如果需要）
+	if ps.routingNeedsGeoIP() {
+		ps.logf("[启动] 正在加载 GeoIP 数据...")
+		if err := ps.loadGeoIPDB(); err != nil {
+			ps.logf("[警告] 加载 GeoIP 数据库失败: %v，回退到内置中国IP段文本列表", err)
 
-		if err := ps.loadChinaIPV6List(); err != nil {
-			ps.logf("[警告] 加载中国IPv6列表失败: %v", err)
-		} else {
-			ps.chinaIPV6RangesMu.RLock()
-			ipv6Count = len(ps.chinaIPV6Ranges)
-			ps.chinaIPV6RangesMu.RUnlock()
+			ipv4Count, ipv6Count := 0, 0
+			if err := ps.loadChinaIPList(); err != nil {
+				ps.logf("[警告] 加载中国IPv4列表失败: %v", err)
+			} else {
+				ps.chinaIPRangesMu.RLock()
+				ipv4Count = len(ps.chinaIPRanges)
+				ps.chinaIPRangesMu.RUnlock()
+			}
+			if err := ps.loadChinaIPV6List(); err != nil {
+				ps.logf("[警告] 加载中国IPv6列表失败: %v", err)
+			} else {
+				ps.chinaIPV6RangesMu.RLock()
+				ipv6Count = len(ps.chinaIPV6Ranges)
+				ps.chinaIPV6RangesMu.RUnlock()
+			}
+			if ipv4Count > 0 || ipv6Count > 0 {
+				ps.logf("[启动] 已加载 %d 个中国IPv4段, %d 个中国IPv6段", ipv4Count, ipv6Count)
+			} else {
+				ps.logf("[警告] 未加载到任何中国IP列表，将使用默认规则")
+			}
+		} else if ps.config.GeoIPRefreshInterval > 0 {
+			go ps.geoIPRefreshLoop(ps.config.GeoIPRefreshInterval)
 		}
+	}
 
-		if ipv4Count > 0 || ipv6Count > 0 {
-			ps.logf("[启动] 已加载 %d 个中国IPv4段, %d 个中国IPv6段", ipv4Count, ipv6Count)
-		} else {
-			ps.logf("[警告] 未加载到任何中国IP列表，将使用默认规则")
-		}
-	} else if ps.config.RoutingMode == "global" {
+	switch {
+	case ps.config.RoutingMode == "global":
 		ps.logf("[启动] 分流模式: 全局代理")
-	} else if ps.config.RoutingMode == "none" {
+	case ps.config.RoutingMode == "none":
 		ps.logf("[启动] 分流模式: 不改变代理（直连模式）")
-	} else {
+	case ps.config.RoutingMode == "bypass_cn":
+		ps.logf("[启动] 分流模式: 跳过中国大陆")
+	case strings.HasPrefix(ps.config.RoutingMode, "bypass:"):
+		ps.logf("[启动] 分流模式: 跳过指定国家/地区 (%s)", strings.TrimPrefix(ps.config.RoutingMode, "bypass:"))
+	case strings.HasPrefix(ps.config.RoutingMode, "only:"):
+		ps.logf("[启动] 分流模式: 仅代理指定国家/地区 (%s)", strings.TrimPrefix(ps.config.RoutingMode, "only:"))
+	default:
 		ps.logf("[警告] 未知的分流模式: %s，使用默认模式 global", ps.config.RoutingMode)
 		ps.config.RoutingMode = "global"
 	}
 
+	if ps.config.WSPoolMaxStreamsPerConn > 0 {
+		ps.logf("[启动] 启用 WebSocket 连接池，每条连接最多 %d 条复用流", ps.config.WSPoolMaxStreamsPerConn)
+		ps.wsPool = newWSPool(ps, ps.config.WSPoolMaxStreamsPerConn, ps.config.WSPoolIdleTimeout, ps.config.WSPoolProbeInterval, ps.config.WSPoolSize)
+	}
+
+	if ps.config.AdminAddr != "" {
+		ps.adminServer = NewAdminServer(ps, ps.config.AdminAddr)
+		go func() {
+			if err := <-ps.adminServer.Start(); err != nil {
+				ps.logf("[警告] 管理接口监听失败: %v", err)
+			}
+		}()
+		ps.logf("[启动] 管理/指标接口已启用: %s", ps.config.AdminAddr)
+	}
+
 	return ps.runProxyServer()
 }
 
@@ -183,8 +363,28 @@ func (ps *ProxyServer) Stop() {
 
 	ps.logf("[系统] 正在停止代理服务器...")
 
-	// 关闭停止通道
-	close(ps.stopChan)
+	// 关闭停止通道（Shutdown 也可能已经关过，用 shutdownOnce 避免重复 close）
+	ps.shutdownOnce.Do(func() { close(ps.stopChan) })
+
+	// 关闭 GeoIP 数据库
+	ps.geoipMu.Lock()
+	if ps.geoipDB != nil {
+		ps.geoipDB.Close()
+		ps.geoipDB = nil
+	}
+	ps.geoipMu.Unlock()
+
+	// 关闭 WebSocket 连接池
+	if ps.wsPool != nil {
+		ps.wsPool.Close()
+		ps.wsPool = nil
+	}
+
+	// 关闭管理/指标接口
+	if ps.adminServer != nil {
+		ps.adminServer.Stop()
+		ps.adminServer = nil
+	}
 
 	// 关闭监听器
 	if ps.listener != nil {
@@ -218,6 +418,95 @@ func (ps *ProxyServer) IsRunning() bool {
 	return ps.isRunning
 }
 
+// Shutdown 优雅停止代理服务器，用法仿照 http.Server.Shutdown：停止接受新连接、
+// 广播 stopChan，然后等待 connWG 跟踪的所有协程（每条已接受的连接及其内部的
+// handleTunnel/handleDirectConnection 转发、ping 保活、UDP 中继）自然退出，
+// 而不是像 Stop 那样直接砍断所有活动连接。ctx 到期时对仍未退出的连接做一次
+// 强制 Close 兜底，返回 ctx.Err()。
+//
+// 说明：accept 循环、ping 协程和 UDP 中继循环都在各自的 select 里监听
+// stopChan，能及时退出；handleTunnel 内部双向转发的 conn.Read/
+// wsConn.ReadMessage 本身也是阻塞调用，但它的 ping 协程在 stopChan 触发时
+// 会顺带给 conn/wsConn 都打上一个很短的读超时，把这两个阻塞读唤醒，使这条
+// 路径能在超时内主动退出、而不用等 ctx 到期被强制 Close。handleTunnelViaPool
+// （走连接池的隧道）和 handleDirectConnection（直连目标）没有这个保活协程、
+// 也没有 CLOSE 帧协议可用来通知对端，这两条路径上长期存活的连接仍然只能
+// 依赖 ctx 超时后的强制 Close 退出，而不是主动让出。
+func (ps *ProxyServer) Shutdown(ctx context.Context) error {
+	ps.mu.Lock()
+	if !ps.isRunning {
+		ps.mu.Unlock()
+		return nil
+	}
+	ps.isRunning = false
+	ps.logf("[系统] 正在优雅停止代理服务器...")
+
+	ps.shutdownOnce.Do(func() { close(ps.stopChan) })
+	if ps.listener != nil {
+		ps.listener.Close()
+	}
+	ps.mu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		ps.connWG.Wait()
+		close(drained)
+	}()
+
+	var shutdownErr error
+	select {
+	case <-drained:
+		ps.logf("[系统] 所有连接已正常排空")
+	case <-ctx.Done():
+		shutdownErr = ctx.Err()
+		ps.logf("[系统] 排空连接超时，强制关闭剩余连接: %v", shutdownErr)
+		ps.connMu.Lock()
+		for conn := range ps.activeConns {
+			conn.Close()
+		}
+		ps.connMu.Unlock()
+		<-drained
+	}
+
+	ps.geoipMu.Lock()
+	if ps.geoipDB != nil {
+		ps.geoipDB.Close()
+		ps.geoipDB = nil
+	}
+	ps.geoipMu.Unlock()
+
+	if ps.wsPool != nil {
+		ps.wsPool.Close()
+		ps.wsPool = nil
+	}
+	if ps.adminServer != nil {
+		ps.adminServer.Stop()
+		ps.adminServer = nil
+	}
+
+	ps.runOnShutdownHooks()
+	ps.logf("[系统] 代理服务器已优雅停止")
+	return shutdownErr
+}
+
+// RegisterOnShutdown 注册一个在 Shutdown 排空所有连接之后调用的钩子，用于
+// flush 日志、上报指标等收尾工作，用法和 http.Server.RegisterOnShutdown 一致；
+// 可以多次调用注册多个钩子，按注册顺序依次执行。
+func (ps *ProxyServer) RegisterOnShutdown(fn func()) {
+	ps.onShutdownMu.Lock()
+	defer ps.onShutdownMu.Unlock()
+	ps.onShutdown = append(ps.onShutdown, fn)
+}
+
+func (ps *ProxyServer) runOnShutdownHooks() {
+	ps.onShutdownMu.Lock()
+	hooks := append([]func(){}, ps.onShutdown...)
+	ps.onShutdownMu.Unlock()
+	for _, fn := range hooks {
+		fn()
+	}
+}
+
 // ======================== 工具函数 ========================
 
 // addConnection 添加连接到跟踪列表
@@ -227,15 +516,32 @@ func (ps *ProxyServer) addConnection(conn net.Conn) {
 	if ps.activeConns != nil {
 		ps.activeConns[conn] = true
 	}
+	if ps.connInfos == nil {
+		ps.connInfos = make(map[net.Conn]*connInfo)
+	}
+	ps.connInfos[conn] = &connInfo{
+		remote:    conn.RemoteAddr().String(),
+		startedAt: time.Now(),
+	}
+	atomic.AddInt64(&ps.metrics.connectionsOpened, 1)
 }
 
-// removeConnection 从跟踪列表移除连接
+// removeConnection 从跟踪列表移除连接。移除前把这条连接的 bytesIn/
+// bytesOut 并入 metrics.closedBytesIn/closedBytesOut，这样
+// totalConnBytes 汇总出的才是自启动以来的单调总量，而不是随连接关闭
+// 而倒退的瞬时值。
 func (ps *ProxyServer) removeConnection(conn net.Conn) {
 	ps.connMu.Lock()
 	defer ps.connMu.Unlock()
 	if ps.activeConns != nil {
 		delete(ps.activeConns, conn)
 	}
+	if info, ok := ps.connInfos[conn]; ok {
+		atomic.AddInt64(&ps.metrics.closedBytesIn, atomic.LoadInt64(&info.bytesIn))
+		atomic.AddInt64(&ps.metrics.closedBytesOut, atomic.LoadInt64(&info.bytesOut))
+	}
+	delete(ps.connInfos, conn)
+	atomic.AddInt64(&ps.metrics.connectionsClosed, 1)
 }
 
 // ======================== 工具函数 ========================
@@ -249,8 +555,18 @@ func ipToUint32(ip net.IP) uint32 {
 	return uint32(ip[0])<<24 | uint32(ip[1])<<16 | uint32(ip[2])<<8 | uint32(ip[3])
 }
 
-// isChinaIP 检查IP是否在中国IP列表中（支持IPv4和IPv6）
+// isChinaIP 检查IP是否在中国IP列表中（支持IPv4和IPv6）。结果按IP字符串
+// 缓存在一个小容量 LRU 里，因为同一批热门域名解析出的IP会反复被查询。
 func (ps *ProxyServer) isChinaIP(ipStr string) bool {
+	if cached, ok := ps.chinaIPLookupCache.Get(ipStr); ok {
+		return cached
+	}
+	result := ps.isChinaIPUncached(ipStr)
+	ps.chinaIPLookupCache.Add(ipStr, result)
+	return result
+}
+
+func (ps *ProxyServer) isChinaIPUncached(ipStr string) bool {
 	ip := net.ParseIP(ipStr)
 	if ip == nil {
 		return false
@@ -447,26 +763,42 @@ func (ps *ProxyServer) loadChinaIPList() error {
 
 	ps.logf("[加载] 已加载 %d 个中国IPv4段，内存占用约 %d KB", len(ranges), len(ranges)*8/1024)
 
-	// 按起始IP排序 - 使用更高效的排序
-	for i := 0; i < len(ranges)-1; i++ {
-		minIdx := i
-		for j := i + 1; j < len(ranges); j++ {
-			if ranges[j].start < ranges[minIdx].start {
-				minIdx = j
-			}
-		}
-		if minIdx != i {
-			ranges[i], ranges[minIdx] = ranges[minIdx], ranges[i]
-		}
-	}
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i].start < ranges[j].start
+	})
+	ranges = mergeIPRanges(ranges)
+	ps.logf("[加载] 合并相邻/重叠的IPv4段后剩余 %d 个", len(ranges))
 
 	ps.chinaIPRangesMu.Lock()
 	ps.chinaIPRanges = ranges
 	ps.chinaIPRangesMu.Unlock()
+	ps.chinaIPLookupCache.Purge()
 
 	return nil
 }
 
+// mergeIPRanges 合并已按 start 排序的 ranges 中相邻或重叠的区间，让
+// isChinaIP 的二分查找在一个更小、互不相邻的集合上进行。用 uint64 比较
+// cur.end+1，避免 cur.end 恰好是 0xFFFFFFFF 时在 uint32 上溢出回绕。
+func mergeIPRanges(ranges []ipRange) []ipRange {
+	if len(ranges) == 0 {
+		return ranges
+	}
+	merged := make([]ipRange, 0, len(ranges))
+	cur := ranges[0]
+	for _, r := range ranges[1:] {
+		if uint64(r.start) <= uint64(cur.end)+1 {
+			if r.end > cur.end {
+				cur.end = r.end
+			}
+			continue
+		}
+		merged = append(merged, cur)
+		cur = r
+	}
+	return append(merged, cur)
+}
+
 // loadChinaIPV6List 从程序目录加载中国IPv6 IP列表
 func (ps *ProxyServer) loadChinaIPV6List() error {
 	// 获取可执行文件所在目录
@@ -563,58 +895,121 @@ func (ps *ProxyServer) loadChinaIPV6List() error {
 
 	ps.logf("[加载] 已加载 %d 个中国IPv6段，内存占用约 %d KB", len(ranges), len(ranges)*32/1024)
 
-	// 按起始IP排序 - 使用更高效的排序
-	for i := 0; i < len(ranges)-1; i++ {
-		minIdx := i
-		for j := i + 1; j < len(ranges); j++ {
-			if compareIPv6(ranges[j].start, ranges[minIdx].start) < 0 {
-				minIdx = j
-			}
-		}
-		if minIdx != i {
-			ranges[i], ranges[minIdx] = ranges[minIdx], ranges[i]
-		}
-	}
+	sort.Slice(ranges, func(i, j int) bool {
+		return compareIPv6(ranges[i].start, ranges[j].start) < 0
+	})
+	ranges = mergeIPV6Ranges(ranges)
+	ps.logf("[加载] 合并重叠的IPv6段后剩余 %d 个", len(ranges))
 
 	ps.chinaIPV6RangesMu.Lock()
 	ps.chinaIPV6Ranges = ranges
 	ps.chinaIPV6RangesMu.Unlock()
+	ps.chinaIPLookupCache.Purge()
 
 	return nil
 }
 
+// mergeIPV6Ranges 是 mergeIPRanges 的 IPv6 版本，合并已按 start 排序的
+// ranges 中相邻或重叠的区间。
+func mergeIPV6Ranges(ranges []ipRangeV6) []ipRangeV6 {
+	if len(ranges) == 0 {
+		return ranges
+	}
+	merged := make([]ipRangeV6, 0, len(ranges))
+	cur := ranges[0]
+	for _, r := range ranges[1:] {
+		adjacent := false
+		if next, ok := incrementIPv6(cur.end); ok {
+			adjacent = compareIPv6(r.start, next) <= 0
+		}
+		if adjacent || compareIPv6(r.start, cur.end) <= 0 {
+			if compareIPv6(r.end, cur.end) > 0 {
+				cur.end = r.end
+			}
+			continue
+		}
+		merged = append(merged, cur)
+		cur = r
+	}
+	return append(merged, cur)
+}
+
+// incrementIPv6 返回 addr+1，ok 为 false 表示 addr 已经是全 0xFF（即
+// ffff:...:ffff），加一会溢出，此时调用方应只按重叠判断，不再判断相邻。
+func incrementIPv6(addr [16]byte) (next [16]byte, ok bool) {
+	next = addr
+	for i := len(next) - 1; i >= 0; i-- {
+		next[i]++
+		if next[i] != 0 {
+			return next, true
+		}
+	}
+	return next, false
+}
+
 // shouldBypassProxy 根据分流模式判断是否应该绕过代理（直连）
 func (ps *ProxyServer) shouldBypassProxy(targetHost string) bool {
-	if ps.config.RoutingMode == "none" {
+	switch {
+	case ps.config.RoutingMode == "none":
 		// "不改变代理"模式：所有流量都直连
 		return true
-	}
-	if ps.config.RoutingMode == "global" {
+	case ps.config.RoutingMode == "global":
 		// "全局代理"模式：所有流量都走代理
 		return false
+	case ps.config.RoutingMode == "bypass_cn":
+		// "跳过中国大陆"模式：目标在中国大陆就直连
+		return ps.hostInCountries(targetHost, []string{"CN"})
+	case strings.HasPrefix(ps.config.RoutingMode, "bypass:"):
+		// "跳过指定国家/地区"模式：目标属于列表里任意一个国家就直连
+		codes := splitCountryCodes(strings.TrimPrefix(ps.config.RoutingMode, "bypass:"))
+		return ps.hostInCountries(targetHost, codes)
+	case strings.HasPrefix(ps.config.RoutingMode, "only:"):
+		// "仅代理指定国家/地区"模式：只有目标属于列表里的国家才走代理，其余直连
+		codes := splitCountryCodes(strings.TrimPrefix(ps.config.RoutingMode, "only:"))
+		return !ps.hostInCountries(targetHost, codes)
+	default:
+		// 未知模式，默认走代理
+		return false
 	}
-	if ps.config.RoutingMode == "bypass_cn" {
-		// "跳过中国大陆"模式：检查是否是中国IP
-		// 先尝试解析为IP
-		if ip := net.ParseIP(targetHost); ip != nil {
-			return ps.isChinaIP(targetHost)
-		}
-		// 如果是域名，先解析IP
-		ips, err := net.LookupIP(targetHost)
-		if err != nil {
-			// 解析失败，默认走代理
-			return false
-		}
-		// 检查所有解析到的IP，如果有一个是中国IP，就直连
-		for _, ip := range ips {
-			if ps.isChinaIP(ip.String()) {
-				return true
-			}
+}
+
+// routingNeedsGeoIP 判断当前 RoutingMode 或已加载的规则是否需要国家代码
+// 查询，让 Start 在没人会用到时完全跳过 GeoIP 数据库的加载。
+func (ps *ProxyServer) routingNeedsGeoIP() bool {
+	mode := ps.config.RoutingMode
+	if mode == "bypass_cn" || strings.HasPrefix(mode, "bypass:") || strings.HasPrefix(mode, "only:") {
+		return true
+	}
+
+	ps.rulesMu.RLock()
+	defer ps.rulesMu.RUnlock()
+	if ps.rules == nil {
+		return false
+	}
+	for _, r := range ps.rules.rules {
+		if r.Type == "geoip" {
+			return true
 		}
-		// 都不是中国IP，走代理
+	}
+	return false
+}
+
+// hostInCountries 将 targetHost（IP 字面量或域名）解析为一个或多个 IP，
+// 判断其中是否有任意一个属于 codes 列表里的国家（见 LookupCountry）。
+func (ps *ProxyServer) hostInCountries(targetHost string, codes []string) bool {
+	if ip := net.ParseIP(targetHost); ip != nil {
+		return ps.ipInAnyCountry(targetHost, codes)
+	}
+	ips, err := net.LookupIP(targetHost)
+	if err != nil {
+		// 解析失败，默认走代理
 		return false
 	}
-	// 未知模式，默认走代理
+	for _, ip := range ips {
+		if ps.ipInAnyCountry(ip.String(), codes) {
+			return true
+		}
+	}
 	return false
 }
 
@@ -623,6 +1018,26 @@ func (ps *ProxyServer) ShouldBypassProxy(targetHost string) bool {
 	return ps.shouldBypassProxy(targetHost)
 }
 
+// resolveAction 决定 targetHost:port 这条连接应该走代理、直连还是被拒绝。
+// 如果加载了规则文件，按规则引擎逐条匹配；否则回退到 shouldBypassProxy
+// 按 RoutingMode（global/none/bypass_cn/bypass:<codes>/only:<codes>）判断。
+func (ps *ProxyServer) resolveAction(targetHost string, port int) RuleAction {
+	ps.rulesMu.RLock()
+	engine := ps.rules
+	ps.rulesMu.RUnlock()
+
+	if engine != nil {
+		if action, ok := engine.Resolve(targetHost, port, ps.LookupCountry); ok {
+			return normalizeAction(action)
+		}
+	}
+
+	if ps.shouldBypassProxy(targetHost) {
+		return ActionDirect
+	}
+	return ActionProxy
+}
+
 func isNormalCloseError(err error) bool {
 	if err == nil {
 		return false
@@ -640,6 +1055,8 @@ func isNormalCloseError(err error) bool {
 // ======================== ECH 支持 ========================
 
 const typeHTTPS = 65
+const typeA = 1
+const typeAAAA = 28
 
 // prepareECH 准备ECH配置
 func (ps *ProxyServer) prepareECH() error {
@@ -664,7 +1081,11 @@ func (ps *ProxyServer) prepareECH() error {
 // refreshECH 刷新ECH配置
 func (ps *ProxyServer) refreshECH() error {
 	ps.logf("[ECH] 刷新配置...")
-	return ps.prepareECH()
+	err := ps.prepareECH()
+	if err == nil {
+		atomic.AddInt64(&ps.metrics.echRefreshCount, 1)
+	}
+	return err
 }
 
 // getECHList 获取ECH配置
@@ -1004,6 +1425,17 @@ func (ps *ProxyServer) dialWebSocketWithECH(maxRetries int) (*websocket.Conn, er
 				}
 				return net.DialTimeout(network, net.JoinHostPort(ps.config.ServerIP, port), 10*time.Second)
 			}
+		} else {
+			// ServerIP 未固定时，按 IPVersion 偏好做 happy-eyeballs 拨号，
+			// 而不是让 gorilla/websocket 自己用 net.Dial 顺序尝试解析到的
+			// 第一个地址（在 IPv6-only 网络或 IPv6 较慢的环境下会卡住）。
+			dialer.NetDial = func(network, address string) (net.Conn, error) {
+				h, port, err := net.SplitHostPort(address)
+				if err != nil {
+					return nil, err
+				}
+				return ps.dialTCPPreferred(h, port, 10*time.Second)
+			}
 		}
 
 		ps.logf("[WebSocket] 尝试连接 (尝试 %d/%d)", attempt, maxRetries)
@@ -1066,7 +1498,11 @@ func (ps *ProxyServer) runProxyServer() error {
 				}
 			}
 
-			go ps.handleConnection(conn)
+			ps.connWG.Add(1)
+			go func() {
+				defer ps.connWG.Done()
+				ps.handleConnection(conn)
+			}()
 		}
 	}()
 
@@ -1149,8 +1585,10 @@ func (ps *ProxyServer) handleSOCKS5(conn net.Conn, clientAddr string, firstByte
 		return
 	}
 
-	// 响应无需认证
-	if _, err := conn.Write([]byte{0x05, 0x00}); err != nil {
+	// 根据 ps.config.Auth 选择是否需要认证并完成协商（见 socks5auth.go）
+	identity, err := ps.negotiateSOCKS5Auth(conn, methods)
+	if err != nil {
+		ps.logf("[SOCKS5] %s 认证失败: %v", clientAddr, err)
 		return
 	}
 
@@ -1217,7 +1655,7 @@ func (ps *ProxyServer) handleSOCKS5(conn net.Conn, clientAddr string, firstByte
 
 		ps.logf("[SOCKS5] %s -> %s", clientAddr, target)
 
-		if err := ps.handleTunnel(conn, target, clientAddr, modeSOCKS5, ""); err != nil {
+		if _, err := ps.handleTunnel(conn, target, clientAddr, modeSOCKS5, "", identity); err != nil {
 			if !isNormalCloseError(err) {
 				ps.logf("[SOCKS5] %s 代理失败: %v", clientAddr, err)
 			}
@@ -1267,7 +1705,11 @@ func (ps *ProxyServer) handleUDPAssociate(tcpConn net.Conn, clientAddr string) {
 
 	// 启动 UDP 处理
 	stopChan := make(chan struct{})
-	go ps.handleUDPRelay(udpConn, clientAddr, stopChan)
+	ps.connWG.Add(1)
+	go func() {
+		defer ps.connWG.Done()
+		ps.handleUDPRelay(udpConn, clientAddr, stopChan)
+	}()
 
 	// 保持 TCP 连接，直到客户端关闭
 	buf := make([]byte, 1)
@@ -1280,10 +1722,23 @@ func (ps *ProxyServer) handleUDPAssociate(tcpConn net.Conn, clientAddr string) {
 func (ps *ProxyServer) handleUDPRelay(udpConn *net.UDPConn, clientAddr string, stopChan chan struct{}) {
 	// 减少UDP缓冲区大小从65535到8192字节以节省内存
 	buf := make([]byte, 8192)
+
+	// relay 按需惰性创建：只有遇到第一个非 DNS 数据报时才建立专用的
+	// WebSocket 隧道（见 udprelay.go），纯 DNS 流量走现有的 handleDNSQuery
+	// /DoH 路径，不受影响。
+	var relay *udpRelay
+	defer func() {
+		if relay != nil {
+			relay.Close()
+		}
+	}()
+
 	for {
 		select {
 		case <-stopChan:
 			return
+		case <-ps.stopChan:
+			return
 		default:
 			udpConn.SetReadDeadline(time.Now().Add(1 * time.Second))
 			n, addr, err := udpConn.ReadFromUDP(buf)
@@ -1364,7 +1819,19 @@ func (ps *ProxyServer) handleUDPRelay(udpConn *net.UDPConn, clientAddr string, s
 				ps.logf("[UDP-DNS] %s -> %s (DoH 查询)", clientAddr, target)
 				go ps.handleDNSQuery(udpConn, addr, udpData, data[:headerLen])
 			} else {
-				ps.logf("[UDP] %s -> %s (暂不支持非 DNS UDP)", clientAddr, target)
+				if relay == nil {
+					var relayErr error
+					relay, relayErr = newUDPRelay(ps, udpConn, clientAddr)
+					if relayErr != nil {
+						ps.logf("[UDP] %s 建立中继隧道失败: %v", clientAddr, relayErr)
+						continue
+					}
+				}
+				ps.logf("[UDP] %s -> %s (经 WebSocket 隧道转发)", clientAddr, target)
+				header := append([]byte(nil), data[:headerLen]...)
+				if err := relay.Write(dstHost, dstPort, addr, header, udpData); err != nil {
+					ps.logf("[UDP] %s -> %s 转发失败: %v", clientAddr, target, err)
+				}
 			}
 		}
 	}
@@ -1381,8 +1848,8 @@ func (ps *ProxyServer) handleDNSQuery(udpConn *net.UDPConn, clientAddr *net.UDPA
 		return
 	}
 
-	// 通过 DoH 查询
-	dnsResponse, err := ps.queryDoHForProxy(dnsQuery)
+	// 通过 DoH 查询（经 dnscache.go 里的 TTL 缓存）
+	dnsResponse, err := ps.queryDoHForProxyCached(dnsQuery)
 	if err != nil {
 		ps.logf("[UDP-DNS] DoH 查询失败: %v", err)
 		return
@@ -1405,6 +1872,26 @@ func (ps *ProxyServer) handleDNSQuery(udpConn *net.UDPConn, clientAddr *net.UDPA
 
 // ======================== HTTP 处理 ========================
 
+// hopByHopHeaders 是 RFC 7230 §6.1 里只对相邻这一跳有意义、不能原样转发
+// 给上游的 header。
+var hopByHopHeaders = []string{
+	"Connection", "Keep-Alive", "Proxy-Connection", "Proxy-Authenticate",
+	"Proxy-Authorization", "TE", "Trailer", "Transfer-Encoding", "Upgrade",
+}
+
+// stripHopByHopHeaders 删除 hopByHopHeaders，以及 Connection header 本身
+// 点名的那些 header（RFC 7230 §6.1 允许请求额外声明逐跳 header）。
+func stripHopByHopHeaders(h http.Header) {
+	if conn := h.Get("Connection"); conn != "" {
+		for _, name := range strings.Split(conn, ",") {
+			h.Del(strings.TrimSpace(name))
+		}
+	}
+	for _, name := range hopByHopHeaders {
+		h.Del(name)
+	}
+}
+
 // handleHTTP 处理HTTP协议
 func (ps *ProxyServer) handleHTTP(conn net.Conn, clientAddr string, firstByte byte) {
 	// 检查服务器是否已经停止
@@ -1416,52 +1903,45 @@ func (ps *ProxyServer) handleHTTP(conn net.Conn, clientAddr string, firstByte by
 		return
 	}
 
-	// 将第一个字节放回缓冲区
-	reader := bufio.NewReader(io.MultiReader(
-		strings.NewReader(string(firstByte)),
-		conn,
-	))
+	// 把嗅探协议时已经读掉的第一个字节放回去，用 http.ReadRequest 解析，
+	// 而不是手写的按行读取——这样才能正确处理 Transfer-Encoding: chunked
+	// 请求体。
+	//
+	// 注意：每条 TCP 连接只代理一个请求。handleTunnel 建立隧道之后就进入
+	// 原样转发 conn 字节的全双工中继，不会在一个响应结束后解析下一个请求
+	// 再拨号到（可能不同的）目标，所以这里不支持 HTTP 长连接/管道化——见
+	// 下面把 Connection 头强制改成 close 的处理，对客户端和上游都如实声明
+	// 这一点，避免客户端认为可以在同一条连接上发下一个请求。
+	reader := bufio.NewReader(io.MultiReader(bytes.NewReader([]byte{firstByte}), conn))
 
-	// 读取 HTTP 请求行
-	requestLine, err := reader.ReadString('\n')
+	req, err := http.ReadRequest(reader)
 	if err != nil {
+		ps.logf("[HTTP] %s 解析请求失败: %v", clientAddr, err)
 		return
 	}
 
-	parts := strings.Fields(requestLine)
-	if len(parts) < 3 {
-		return
-	}
-
-	method := parts[0]
-	requestURL := parts[1]
-	httpVersion := parts[2]
+	method := req.Method
 
-	// 读取所有 headers
-	headers := make(map[string]string)
-	var headerLines []string
-	for {
-		line, err := reader.ReadString('\n')
-		if err != nil {
+	// 和 SOCKS5 共用同一份凭据表（见 socks5auth.go）；未配置 ps.config.Auth
+	// 时保持现有无认证行为
+	var identity *Identity
+	if ps.config.Auth != nil {
+		var authErr error
+		identity, authErr = ps.identityFromProxyAuthorization(req.Header.Get("Proxy-Authorization"))
+		if authErr != nil {
+			ps.logf("[HTTP] %s 认证失败: %v", clientAddr, authErr)
+			conn.Write([]byte("HTTP/1.1 407 Proxy Authentication Required\r\nProxy-Authenticate: Basic realm=\"ech-wk\"\r\n\r\n"))
 			return
 		}
-		line = strings.TrimRight(line, "\r\n")
-		if line == "" {
-			break
-		}
-		headerLines = append(headerLines, line)
-		if idx := strings.Index(line, ":"); idx > 0 {
-			key := strings.TrimSpace(line[:idx])
-			value := strings.TrimSpace(line[idx+1:])
-			headers[strings.ToLower(key)] = value
-		}
 	}
 
 	switch method {
 	case "CONNECT":
-		// HTTPS 隧道代理
+		// HTTPS 隧道代理；CONNECT 的请求目标是 host:port 本身（authority-
+		// form），req.RequestURI 原样保留了请求行上的这段文本
+		requestURL := req.RequestURI
 		ps.logf("[HTTP-CONNECT] %s -> %s", clientAddr, requestURL)
-		if err := ps.handleTunnel(conn, requestURL, clientAddr, modeHTTPConnect, ""); err != nil {
+		if _, err := ps.handleTunnel(conn, requestURL, clientAddr, modeHTTPConnect, "", identity); err != nil {
 			if !isNormalCloseError(err) {
 				ps.logf("[HTTP-CONNECT] %s 代理失败: %v", clientAddr, err)
 			}
@@ -1469,69 +1949,66 @@ func (ps *ProxyServer) handleHTTP(conn net.Conn, clientAddr string, firstByte by
 
 	case "GET", "POST", "PUT", "DELETE", "HEAD", "OPTIONS", "PATCH", "TRACE":
 		// HTTP 代理 - 直接转发
-		ps.logf("[HTTP-%s] %s -> %s", method, clientAddr, requestURL)
+		ps.logf("[HTTP-%s] %s -> %s", method, clientAddr, req.RequestURI)
 
-		var target string
-		var path string
-
-		if strings.HasPrefix(requestURL, "http://") {
-			// 解析完整 URL
-			urlWithoutScheme := strings.TrimPrefix(requestURL, "http://")
-			idx := strings.Index(urlWithoutScheme, "/")
-			if idx > 0 {
-				target = urlWithoutScheme[:idx]
-				path = urlWithoutScheme[idx:]
-			} else {
-				target = urlWithoutScheme
-				path = "/"
-			}
-		} else {
-			// 相对路径，从 Host header 获取
-			target = headers["host"]
-			path = requestURL
+		// 绝对形式（如 "GET http://host/path HTTP/1.1"）里 req.URL.Host 已经
+		// 被解析出来；相对形式只能从 Host header 拿
+		target := req.URL.Host
+		if target == "" {
+			target = req.Host
 		}
-
 		if target == "" {
 			conn.Write([]byte("HTTP/1.1 400 Bad Request\r\n\r\n"))
 			return
 		}
-
-		// 添加默认端口
 		if !strings.Contains(target, ":") {
 			target += ":80"
 		}
 
-		// 重构 HTTP 请求（去掉完整 URL，使用相对路径）
-		var requestBuilder strings.Builder
-		requestBuilder.WriteString(fmt.Sprintf("%s %s %s\r\n", method, path, httpVersion))
-
-		// 写入 headers（过滤掉 Proxy-Connection）
-		for _, line := range headerLines {
-			key := strings.Split(line, ":")[0]
-			keyLower := strings.ToLower(strings.TrimSpace(key))
-			if keyLower != "proxy-connection" && keyLower != "proxy-authorization" {
-				requestBuilder.WriteString(line)
-				requestBuilder.WriteString("\r\n")
+		stripHopByHopHeaders(req.Header)
+		req.Header.Set("Via", fmt.Sprintf("%d.%d ech-wk", req.ProtoMajor, req.ProtoMinor))
+		if clientIP, _, splitErr := net.SplitHostPort(clientAddr); splitErr == nil {
+			if existing := req.Header.Get("X-Forwarded-For"); existing != "" {
+				req.Header.Set("X-Forwarded-For", existing+", "+clientIP)
+			} else {
+				req.Header.Set("X-Forwarded-For", clientIP)
 			}
 		}
-		requestBuilder.WriteString("\r\n")
-
-		// 如果有请求体，需要读取并附加
-		if contentLength := headers["content-length"]; contentLength != "" {
-			var length int
-			fmt.Sscanf(contentLength, "%d", &length)
-			if length > 0 && length < 10*1024*1024 { // 限制 10MB
-				body := make([]byte, length)
-				if _, err := io.ReadFull(reader, body); err == nil {
-					requestBuilder.Write(body)
-				}
+		// 不支持长连接/管道化（见上面 handleHTTP 开头的说明），如实告知
+		// 客户端和上游这条连接用完即关，而不是悄悄吞掉 keep-alive 请求
+		req.Header.Set("Connection", "close")
+
+		// req.Write 会阻塞读取 req.Body；带 Expect: 100-continue 的客户端在
+		// 收到 100 响应之前不会发送请求体，而隧道这时还没拨通、更不可能把
+		// 上游的 100 响应转发回来，所以这里由代理自己先吐一个 100
+		// Continue 出去，把客户端的请求体催出来，避免卡死
+		if strings.EqualFold(req.Header.Get("Expect"), "100-continue") {
+			if _, err := conn.Write([]byte("HTTP/1.1 100 Continue\r\n\r\n")); err != nil {
+				ps.logf("[HTTP-%s] %s 发送 100 Continue 失败: %v", method, clientAddr, err)
+				return
 			}
 		}
 
-		firstFrame := requestBuilder.String()
+		// req.URL.RequestURI() 只输出路径+查询串，不含 scheme/host，所以
+		// req.Write 天然会把请求行重写成相对路径形式，不需要手动改写
+		var reqBuf bytes.Buffer
+		if err := req.Write(&reqBuf); err != nil {
+			ps.logf("[HTTP-%s] %s 重新序列化请求失败: %v", method, clientAddr, err)
+			conn.Write([]byte("HTTP/1.1 502 Bad Gateway\r\n\r\n"))
+			return
+		}
+
+		// handleTunnel 建立隧道之后就原样转发 conn 上的字节；bufio.Reader
+		// 可能已经把客户端管道化发送的下一个请求预读进了缓冲区，这些字节
+		// 不经过 conn.Read 就读不到了，原样拼进第一帧里一起发出去
+		if buffered := reader.Buffered(); buffered > 0 {
+			extra, _ := reader.Peek(buffered)
+			reqBuf.Write(extra)
+			reader.Discard(buffered)
+		}
 
 		// 使用 modeHTTPProxy 模式
-		if err := ps.handleTunnel(conn, target, clientAddr, modeHTTPProxy, firstFrame); err != nil {
+		if _, err := ps.handleTunnel(conn, target, clientAddr, modeHTTPProxy, reqBuf.String(), identity); err != nil {
 			if !isNormalCloseError(err) {
 				ps.logf("[HTTP-%s] %s 代理失败: %v", method, clientAddr, err)
 			}
@@ -1553,38 +2030,56 @@ const (
 	modeHTTPProxy   = 3 // HTTP 代理 (GET/POST等)
 )
 
-// handleTunnel 处理隧道连接
-func (ps *ProxyServer) handleTunnel(conn net.Conn, target, clientAddr string, mode int, firstFrame string) error {
+// handleTunnel 处理隧道连接。identity 是 SOCKS5/HTTP 认证通过后的身份（见
+// socks5auth.go），未配置 ps.config.Auth 时恒为 nil；目前只记录进日志和
+// connInfo，按身份匹配分流规则/限速留给以后按需扩展。
+func (ps *ProxyServer) handleTunnel(conn net.Conn, target, clientAddr string, mode int, firstFrame string, identity *Identity) (TunnelStats, error) {
 	// 检查服务器是否已经停止
 	ps.mu.RLock()
 	isRunning := ps.isRunning
 	ps.mu.RUnlock()
 
 	if !isRunning {
-		return errors.New("server is stopping")
+		return TunnelStats{}, errors.New("server is stopping")
 	}
 
 	// 解析目标地址
-	targetHost, _, err := net.SplitHostPort(target)
+	targetHost, targetPortStr, err := net.SplitHostPort(target)
 	if err != nil {
 		targetHost = target
 	}
+	targetPort, _ := strconv.Atoi(targetPortStr)
 
-	// 检查是否应该绕过代理（直连）
-	if ps.shouldBypassProxy(targetHost) {
+	// 按规则引擎（如果加载了规则文件）或分流模式决定去向
+	switch ps.resolveAction(targetHost, targetPort) {
+	case ActionReject:
+		ps.logf("[分流] %s -> %s (规则拒绝)", clientAddr, target)
+		sendErrorResponse(conn, mode)
+		return TunnelStats{}, fmt.Errorf("目标被规则拒绝: %s", target)
+	case ActionDirect:
 		ps.logf("[分流] %s -> %s (直连，绕过代理)", clientAddr, target)
 		return ps.handleDirectConnection(conn, target, clientAddr, mode, firstFrame)
 	}
 
-	// 走代理
+	// 走代理。已启用连接池（见 wspool.go）时优先复用池里的逻辑流，只有在
+	// 所有池内物理连接都已饱和时 WSPool.Acquire 才会新建一条；否则退回每
+	// 个会话单独握手一次 TLS+ECH+WebSocket 的旧路径
+	if ps.wsPool != nil {
+		ps.logf("[分流] %s -> %s (通过代理连接池)", clientAddr, target)
+		return ps.handleTunnelViaPool(conn, target, clientAddr, mode, firstFrame, identity)
+	}
+
 	ps.logf("[分流] %s -> %s (通过代理)", clientAddr, target)
 	wsConn, err := ps.dialWebSocketWithECH(2)
 	if err != nil {
 		ps.logf("[代理] 无法连接到后端服务器 %s: %v", ps.config.ServerAddr, err)
 		ps.logf("[代理] 请检查服务器地址是否正确，或使用有效的Cloudflare Workers地址")
+		ps.recordDialError("backend_dial_failed")
 		sendErrorResponse(conn, mode)
-		return fmt.Errorf("后端服务器连接失败: %w", err)
+		return TunnelStats{}, fmt.Errorf("后端服务器连接失败: %w", err)
 	}
+	ps.setConnTarget(conn, target)
+	ps.setConnIdentity(conn, identity)
 
 	// 确保WebSocket连接被关闭
 	defer func() {
@@ -1600,7 +2095,9 @@ func (ps *ProxyServer) handleTunnel(conn net.Conn, target, clientAddr string, mo
 
 	// 保活
 	stopPing := make(chan bool)
+	ps.connWG.Add(1)
 	go func() {
+		defer ps.connWG.Done()
 		ticker := time.NewTicker(10 * time.Second)
 		defer ticker.Stop()
 		for {
@@ -1613,6 +2110,19 @@ func (ps *ProxyServer) handleTunnel(conn net.Conn, target, clientAddr string, mo
 				mu.Unlock()
 			case <-stopPing:
 				return
+			case <-ps.stopChan:
+				// 服务器正在优雅停止：礼貌地通知后端这条隧道要关闭，而不是
+				// 等它超时发现。同时把 conn/wsConn 的读超时收紧，让下面
+				// Client->Server/Server->Client 两个转发 goroutine 尽快从
+				// 阻塞的 conn.Read/wsConn.ReadMessage 里醒过来检查停机信号，
+				// 而不是一直卡到 Shutdown 的 ctx 超时才被强制 Close——那样等
+				// 同于 Stop 的硬切，起不到排空在途数据的作用。
+				mu.Lock()
+				wsConn.WriteMessage(websocket.TextMessage, []byte("CLOSE"))
+				conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+				wsConn.SetReadDeadline(time.Now().Add(2 * time.Second))
+				mu.Unlock()
+				return
 			}
 		}
 	}()
@@ -1638,98 +2148,188 @@ func (ps *ProxyServer) handleTunnel(conn net.Conn, target, clientAddr string, mo
 	mu.Unlock()
 	if err != nil {
 		sendErrorResponse(conn, mode)
-		return err
+		return TunnelStats{}, err
 	}
 
 	// 等待响应
 	_, msg, err := wsConn.ReadMessage()
 	if err != nil {
 		sendErrorResponse(conn, mode)
-		return err
+		return TunnelStats{}, err
 	}
 
 	response := string(msg)
 	if strings.HasPrefix(response, "ERROR:") {
 		sendErrorResponse(conn, mode)
-		return errors.New(response)
+		return TunnelStats{}, errors.New(response)
 	}
 	if response != "CONNECTED" {
 		sendErrorResponse(conn, mode)
-		return fmt.Errorf("意外响应: %s", response)
+		return TunnelStats{}, fmt.Errorf("意外响应: %s", response)
 	}
 
 	// 发送成功响应
 	if err := sendSuccessResponse(conn, mode); err != nil {
-		return err
+		return TunnelStats{}, err
 	}
 
-	ps.logf("[代理] %s 已连接: %s", clientAddr, target)
+	if identity != nil {
+		ps.logf("[代理] %s (用户 %s) 已连接: %s", clientAddr, identity.User, target)
+	} else {
+		ps.logf("[代理] %s 已连接: %s", clientAddr, target)
+	}
 
-	// 双向转发
-	done := make(chan bool, 2)
+	// 按配置决定是否给转发的每个负载显式加上长度前缀（见 tunnelcodec.go）；
+	// 默认关闭，保持现有"一次 conn.Read 对应一条 WS 消息"的行为，避免要求
+	// 后端 Worker 同步升级才能工作
+	var codec *tunnelCodec
+	if ps.config.TunnelFraming {
+		codec = newTunnelCodec(ps.config.TunnelMaxFrameSize)
+	}
+
+	// 双向转发。两个方向各自跑到头（本地 EOF 或对端关闭）才退出，用
+	// WaitGroup 等两边都完成再返回——而不是像之前那样任何一个方向一结束就
+	// 整条连接关闭，截断另一个方向尚未转发完的数据（典型的比如长下载的
+	// 尾部被切掉）。一个方向结束后只半关闭它，另一方向仍可能在收尾。
+	var stats TunnelStats
+	var statsMu sync.Mutex
+	recordErr := func(err error) {
+		if err == nil || isNormalCloseError(err) {
+			return
+		}
+		statsMu.Lock()
+		if stats.Err == nil {
+			stats.Err = err
+		}
+		statsMu.Unlock()
+	}
+	// isShutdownWakeup 识别保活协程在 ps.stopChan 触发时主动收紧的读超时：
+	// 这类超时和 ps.stopChan 已关闭同时出现，是优雅停机特意唤醒阻塞的
+	// conn.Read/wsConn.ReadMessage，不应该当成真正的连接错误记录下来。
+	isShutdownWakeup := func(err error) bool {
+		netErr, ok := err.(net.Error)
+		if !ok || !netErr.Timeout() {
+			return false
+		}
+		select {
+		case <-ps.stopChan:
+			return true
+		default:
+			return false
+		}
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
 
 	// Client -> Server
 	go func() {
+		defer wg.Done()
 		buf := make([]byte, 8192) // 减少从32768到8192字节
 		for {
 			n, err := conn.Read(buf)
-			if err != nil {
+			if n > 0 {
+				outbound := buf[:n]
+				if codec != nil {
+					var framed bytes.Buffer
+					if ferr := codec.WriteFrame(&framed, buf[:n]); ferr != nil {
+						ps.logf("[代理] %s -> %s 编码帧失败: %v", clientAddr, target, ferr)
+						recordErr(ferr)
+						break
+					}
+					outbound = framed.Bytes()
+				}
+
 				mu.Lock()
-				wsConn.WriteMessage(websocket.TextMessage, []byte("CLOSE"))
+				werr := wsConn.WriteMessage(websocket.BinaryMessage, outbound)
 				mu.Unlock()
-				done <- true
-				return
+				if werr != nil {
+					recordErr(werr)
+					break
+				}
+				atomic.AddInt64(&stats.BytesUp, int64(n))
+				ps.addBytesOut(conn, n)
 			}
-
-			mu.Lock()
-			err = wsConn.WriteMessage(websocket.BinaryMessage, buf[:n])
-			mu.Unlock()
 			if err != nil {
-				done <- true
-				return
+				if !isShutdownWakeup(err) {
+					recordErr(err)
+				}
+				break
 			}
 		}
+		// 客户端这个方向已经没有更多数据；告知后端半关闭，而不是直接发
+		// 完整的 CLOSE——服务器到客户端那个方向可能还在发数据
+		mu.Lock()
+		wsConn.WriteMessage(websocket.TextMessage, []byte("CLOSE-WRITE"))
+		mu.Unlock()
 	}()
 
 	// Server -> Client
 	go func() {
+		defer wg.Done()
 		for {
 			mt, msg, err := wsConn.ReadMessage()
 			if err != nil {
-				done <- true
-				return
+				if !isShutdownWakeup(err) {
+					recordErr(err)
+				}
+				break
 			}
 
 			if mt == websocket.TextMessage {
-				if string(msg) == "CLOSE" {
-					done <- true
-					return
+				text := string(msg)
+				if text == "CLOSE" || text == "CLOSE-WRITE" {
+					break
 				}
+				continue
 			}
 
-			if _, err := conn.Write(msg); err != nil {
-				done <- true
-				return
+			payloads := [][]byte{msg}
+			if codec != nil {
+				decoded, derr := codec.ReadFrames(msg)
+				if derr != nil {
+					ps.logf("[代理] %s -> %s 解码帧失败: %v", clientAddr, target, derr)
+					recordErr(derr)
+					break
+				}
+				payloads = decoded
+			}
+
+			writeErr := error(nil)
+			for _, payload := range payloads {
+				if _, werr := conn.Write(payload); werr != nil {
+					writeErr = werr
+					break
+				}
+				atomic.AddInt64(&stats.BytesDown, int64(len(payload)))
+				ps.addBytesIn(conn, len(payload))
+			}
+			if writeErr != nil {
+				recordErr(writeErr)
+				break
 			}
 		}
+		// 服务器这个方向已经没有更多数据；半关闭客户端连接的写方向，让
+		// 客户端->服务器那个方向（如果还没结束）继续把剩下的数据发完
+		closeWrite(conn)
 	}()
 
-	<-done
-	ps.logf("[代理] %s 已断开: %s", clientAddr, target)
-	return nil
+	wg.Wait()
+	ps.logf("[代理] %s 已断开: %s (上行 %d 字节, 下行 %d 字节)", clientAddr, target, stats.BytesUp, stats.BytesDown)
+	return stats, nil
 }
 
 // ======================== 直连处理 ========================
 
 // handleDirectConnection 处理直连（绕过代理）
-func (ps *ProxyServer) handleDirectConnection(conn net.Conn, target, clientAddr string, mode int, firstFrame string) error {
+func (ps *ProxyServer) handleDirectConnection(conn net.Conn, target, clientAddr string, mode int, firstFrame string) (TunnelStats, error) {
 	// 检查服务器是否已经停止
 	ps.mu.RLock()
 	isRunning := ps.isRunning
 	ps.mu.RUnlock()
 
 	if !isRunning {
-		return errors.New("server is stopping")
+		return TunnelStats{}, errors.New("server is stopping")
 	}
 
 	// 解析目标地址
@@ -1749,12 +2349,12 @@ func (ps *ProxyServer) handleDirectConnection(conn net.Conn, target, clientAddr
 
 	ps.logf("[直连] %s -> %s (正在连接...)", clientAddr, target)
 
-	// 直接连接到目标
-	targetConn, err := net.DialTimeout("tcp", target, 10*time.Second)
+	// 直接连接到目标，按 IPVersion 偏好做 happy-eyeballs 拨号（见 dial.go）
+	targetConn, err := ps.dialTCPPreferred(host, port, 10*time.Second)
 	if err != nil {
 		ps.logf("[直连] %s -> %s 连接失败: %v", clientAddr, target, err)
 		sendErrorResponse(conn, mode)
-		return fmt.Errorf("直连失败: %w", err)
+		return TunnelStats{}, fmt.Errorf("直连失败: %w", err)
 	}
 	defer targetConn.Close()
 
@@ -1762,43 +2362,66 @@ func (ps *ProxyServer) handleDirectConnection(conn net.Conn, target, clientAddr
 
 	// 发送成功响应
 	if err := sendSuccessResponse(conn, mode); err != nil {
-		return err
+		return TunnelStats{}, err
 	}
 
 	// 如果有预设的第一帧数据，先发送
 	if firstFrame != "" {
 		if _, err := targetConn.Write([]byte(firstFrame)); err != nil {
 			ps.logf("[直连] %s -> %s 发送第一帧失败: %v", clientAddr, target, err)
-			return err
+			return TunnelStats{}, err
+		}
+	}
+
+	// 双向转发，用 WaitGroup 等两个方向都拷贝完再返回；一个方向遇到 EOF
+	// 就 io.Copy 结束，此时只半关闭这个方向写向的那一端（见
+	// closeWrite），让另一个方向（可能还在收长响应/流式下载的尾部）继续
+	// 跑完，而不是像之前那样任何一个方向一结束就靠 defer 整条关闭，截断
+	// 还没转发完的数据
+	var stats TunnelStats
+	var statsMu sync.Mutex
+	recordErr := func(err error) {
+		if err == nil || isNormalCloseError(err) {
+			return
 		}
+		statsMu.Lock()
+		if stats.Err == nil {
+			stats.Err = err
+		}
+		statsMu.Unlock()
 	}
 
-	// 改进的双向转发 - 等待连接完成
-	done := make(chan struct{}, 2)
+	var wg sync.WaitGroup
+	wg.Add(2)
 
 	// Client -> Target
 	go func() {
-		defer func() { done <- struct{}{} }()
-		_, err := io.Copy(targetConn, conn)
+		defer wg.Done()
+		n, err := io.Copy(targetConn, conn)
+		atomic.AddInt64(&stats.BytesUp, n)
 		if err != nil && !isNormalCloseError(err) {
 			ps.logf("[直连] %s -> %s 转发数据失败: %v", clientAddr, target, err)
 		}
+		recordErr(err)
+		closeWrite(targetConn)
 	}()
 
 	// Target -> Client
 	go func() {
-		defer func() { done <- struct{}{} }()
-		_, err := io.Copy(conn, targetConn)
+		defer wg.Done()
+		n, err := io.Copy(conn, targetConn)
+		atomic.AddInt64(&stats.BytesDown, n)
 		if err != nil && !isNormalCloseError(err) {
 			ps.logf("[直连] %s -> %s 接收数据失败: %v", clientAddr, target, err)
 		}
+		recordErr(err)
+		closeWrite(conn)
 	}()
 
-	// 等待任一方向完成
-	<-done
-	ps.logf("[直连] %s -> %s 连接已断开", clientAddr, target)
+	wg.Wait()
+	ps.logf("[直连] %s -> %s 连接已断开 (上行 %d 字节, 下行 %d 字节)", clientAddr, target, stats.BytesUp, stats.BytesDown)
 
-	return nil
+	return stats, nil
 }
 
 // ======================== 响应辅助函数 ========================
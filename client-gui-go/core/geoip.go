@@ -0,0 +1,198 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// countryRecord 是从 GeoLite2-Country/GeoIP2-Country 记录里读取的字段子集；
+// maxminddb 只会填充它找到的标签，其余字段保持零值。
+type countryRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+}
+
+// loadGeoIPDB 打开配置的 MMDB 文件，如果文件不存在且配置了下载地址，会
+// 先自动下载。成功后原子替换正在使用的数据库；失败时保留原有数据库不变
+// （如果之前加载过的话）。
+func (ps *ProxyServer) loadGeoIPDB() error {
+	path := ps.geoIPDBPath()
+
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		if ps.config.GeoIPDownloadURL == "" {
+			return fmt.Errorf("GeoIP 数据库 %s 不存在，且未配置下载地址", path)
+		}
+		if err := ps.downloadGeoIPDB(path); err != nil {
+			return fmt.Errorf("自动下载 GeoIP 数据库失败: %w", err)
+		}
+	}
+
+	db, err := maxminddb.Open(path)
+	if err != nil {
+		return fmt.Errorf("打开 GeoIP 数据库失败: %w", err)
+	}
+
+	ps.geoipMu.Lock()
+	old := ps.geoipDB
+	ps.geoipDB = db
+	ps.geoipMu.Unlock()
+
+	if old != nil {
+		old.Close()
+	}
+
+	ps.logf("[GeoIP] 已加载数据库: %s", path)
+	return nil
+}
+
+// geoIPDBPath 解析 GeoIPDBPath 配置项：相对路径先在可执行文件目录下查找，
+// 找不到就退回当前工作目录，与 loadChinaIPList 对 chn_ip.txt 的查找方式一致。
+func (ps *ProxyServer) geoIPDBPath() string {
+	path := ps.config.GeoIPDBPath
+	if path == "" {
+		path = "GeoLite2-Country.mmdb"
+	}
+	if filepath.IsAbs(path) {
+		return path
+	}
+	if exePath, err := os.Executable(); err == nil {
+		candidate := filepath.Join(filepath.Dir(exePath), path)
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate
+		}
+	}
+	return path
+}
+
+// downloadGeoIPDB 从 GeoIPDownloadURL 下载数据库，按 MaxMind permalink 的
+// 约定把 license_key 追加为查询参数。注意 MaxMind 官方下载接口实际提供的
+// 是 .tar.gz 压缩包，这里假设 URL 直接指向一个可用的 .mmdb 文件（例如自建
+// 镜像或预解压后的下载地址）；解包官方归档格式不在本次改动范围内。
+func (ps *ProxyServer) downloadGeoIPDB(path string) error {
+	url := ps.config.GeoIPDownloadURL
+	if ps.config.GeoIPLicenseKey != "" {
+		sep := "?"
+		if strings.Contains(url, "?") {
+			sep = "&"
+		}
+		url = fmt.Sprintf("%s%slicense_key=%s", url, sep, ps.config.GeoIPLicenseKey)
+	}
+
+	ps.logf("[GeoIP] 正在下载数据库: %s", path)
+	client := &http.Client{Timeout: 60 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return fmt.Errorf("下载失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("下载失败: HTTP %d", resp.StatusCode)
+	}
+
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("读取下载内容失败: %w", err)
+	}
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		return fmt.Errorf("保存文件失败: %w", err)
+	}
+
+	ps.logf("[GeoIP] 已保存到: %s", path)
+	return nil
+}
+
+// geoIPRefreshLoop 按 interval 定期重新下载并加载数据库，好让长期运行的
+// 进程跟上 MaxMind GeoLite2 每周两次的更新节奏，不需要重启。没有配置
+// GeoIPDownloadURL 时跳过下载，只是白等一个周期。
+func (ps *ProxyServer) geoIPRefreshLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ps.stopChan:
+			return
+		case <-ticker.C:
+			if ps.config.GeoIPDownloadURL == "" {
+				continue
+			}
+			if err := ps.downloadGeoIPDB(ps.geoIPDBPath()); err != nil {
+				ps.logf("[警告] 刷新 GeoIP 数据库失败: %v", err)
+				continue
+			}
+			if err := ps.loadGeoIPDB(); err != nil {
+				ps.logf("[警告] 重新加载刷新后的 GeoIP 数据库失败: %v", err)
+			}
+		}
+	}
+}
+
+// LookupCountry 返回 ipStr 所在的 ISO 国家代码（如 "CN"），查不到时返回 ""。
+// 优先使用已加载的 MMDB 数据库；未加载数据库时回退到 isChinaIP 用的内置
+// 中国IP段文本列表，此时只能识别 "CN"，其余国家一律返回 ""。
+func (ps *ProxyServer) LookupCountry(ipStr string) string {
+	ps.geoipMu.RLock()
+	db := ps.geoipDB
+	ps.geoipMu.RUnlock()
+
+	if db != nil {
+		ip := net.ParseIP(ipStr)
+		if ip == nil {
+			return ""
+		}
+		var record countryRecord
+		if err := db.Lookup(ip, &record); err != nil || record.Country.ISOCode == "" {
+			return ""
+		}
+		return strings.ToUpper(record.Country.ISOCode)
+	}
+
+	if ps.isChinaIP(ipStr) {
+		return "CN"
+	}
+	return ""
+}
+
+// IsIPInCountry 判断 ipStr 是否属于 country（ISO 国家代码，大小写不敏感）。
+func (ps *ProxyServer) IsIPInCountry(ipStr, country string) bool {
+	return ps.LookupCountry(ipStr) == strings.ToUpper(strings.TrimSpace(country))
+}
+
+// ipInAnyCountry 判断 ipStr 的国家代码是否属于 codes 中的任意一个，供
+// RoutingMode 的 "bypass:<codes>"/"only:<codes>" 语法使用。
+func (ps *ProxyServer) ipInAnyCountry(ipStr string, codes []string) bool {
+	cc := ps.LookupCountry(ipStr)
+	if cc == "" {
+		return false
+	}
+	for _, code := range codes {
+		if cc == code {
+			return true
+		}
+	}
+	return false
+}
+
+// splitCountryCodes 把 "JP,US" 这样的逗号分隔国家代码字符串拆分成大写、
+// 去除空白后的切片。
+func splitCountryCodes(raw string) []string {
+	parts := strings.Split(raw, ",")
+	out := make([]string, 0, len(parts))
+	for _, p := range parts {
+		p = strings.ToUpper(strings.TrimSpace(p))
+		if p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
@@ -0,0 +1,80 @@
+package core
+
+import (
+	"container/list"
+	"sync"
+)
+
+// chinaIPLookupCacheSize bounds how many resolved IPs' isChinaIP verdicts
+// ProxyServer keeps around; popular domains resolve to a small, repeated
+// set of edge/CDN IPs, so a modest cache catches most of the traffic.
+const chinaIPLookupCacheSize = 4096
+
+// ipLRUCache is a fixed-capacity LRU cache mapping an IP string to a
+// cached bool verdict, used to skip isChinaIPUncached's binary search on
+// repeat lookups.
+type ipLRUCache struct {
+	mu       sync.Mutex
+	capacity int
+	items    map[string]*list.Element
+	order    *list.List
+}
+
+type ipLRUEntry struct {
+	key   string
+	value bool
+}
+
+func newIPLRUCache(capacity int) *ipLRUCache {
+	return &ipLRUCache{
+		capacity: capacity,
+		items:    make(map[string]*list.Element, capacity),
+		order:    list.New(),
+	}
+}
+
+// Get 返回 key 对应的缓存结果，命中时把它移到最近使用的一端。
+func (c *ipLRUCache) Get(key string) (bool, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		return false, false
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*ipLRUEntry).value, true
+}
+
+// Add 写入 key -> value，超出容量时淘汰最久未使用的条目。
+func (c *ipLRUCache) Add(key string, value bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		el.Value.(*ipLRUEntry).value = value
+		c.order.MoveToFront(el)
+		return
+	}
+
+	el := c.order.PushFront(&ipLRUEntry{key: key, value: value})
+	c.items[key] = el
+
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		if oldest != nil {
+			c.order.Remove(oldest)
+			delete(c.items, oldest.Value.(*ipLRUEntry).key)
+		}
+	}
+}
+
+// Purge 清空缓存。每次 chinaIPRanges/chinaIPV6Ranges 被重新加载后都要调用，
+// 否则缓存里按旧表算出的结果会在新表生效后继续被返回。
+func (c *ipLRUCache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.items = make(map[string]*list.Element, c.capacity)
+	c.order.Init()
+}
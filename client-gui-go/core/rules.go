@@ -0,0 +1,274 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// RuleAction 是一条命中规则产生的去向。
+type RuleAction string
+
+const (
+	ActionProxy  RuleAction = "proxy"
+	ActionDirect RuleAction = "direct"
+	ActionReject RuleAction = "reject"
+)
+
+// Rule 是规则引擎里的一条匹配规则，按声明顺序依次尝试，第一条命中的规则
+// 决定该连接的去向。compiled 字段由 newRoutingEngine 在加载时填充，避免
+// 每次连接都重新编译正则或解析 CIDR。
+type Rule struct {
+	Type   string
+	Value  string
+	Action string
+
+	regex *regexp.Regexp
+	cidr  *net.IPNet
+	port  int
+}
+
+// RoutingEngine 是一份已加载、已编译的有序规则列表，仿照 Clash 等主流代理
+// 客户端的惯例：逐条匹配，第一条命中的规则决定目标的去向；全部不命中时
+// 交由调用方退回默认分流模式（见 ProxyServer.resolveAction）。
+type RoutingEngine struct {
+	rules []Rule
+}
+
+// Count 返回已加载的规则条数，供日志使用。
+func (re *RoutingEngine) Count() int {
+	if re == nil {
+		return 0
+	}
+	return len(re.rules)
+}
+
+// ruleEntry 是规则文件里一条规则的原始（未编译）形态。
+type ruleEntry struct {
+	Type   string `json:"type"`
+	Value  string `json:"value"`
+	Action string `json:"action"`
+}
+
+// ruleFile 是规则文件的顶层 JSON 形状：一个有序的规则列表。
+type ruleFile struct {
+	Rules []ruleEntry `json:"rules"`
+}
+
+// LoadRulesFile 从 path 加载规则文件并编译成 RoutingEngine，按扩展名在 JSON
+// 与简化 YAML 之间选择解析方式（与 importer.DetectAndParse 对 .yaml/.yml 的
+// 判断方式一致）。
+func LoadRulesFile(path string) (*RoutingEngine, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []ruleEntry
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		entries, err = parseSimpleRuleYAML(data)
+	default:
+		entries, err = parseRuleJSON(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newRoutingEngine(entries)
+}
+
+func parseRuleJSON(data []byte) ([]ruleEntry, error) {
+	var f ruleFile
+	if err := json.Unmarshal(data, &f); err == nil && len(f.Rules) > 0 {
+		return f.Rules, nil
+	}
+	var bare []ruleEntry
+	if err := json.Unmarshal(data, &bare); err == nil && len(bare) > 0 {
+		return bare, nil
+	}
+	return nil, fmt.Errorf("无法识别的规则文件格式，应为 {\"rules\": [...]} 或规则数组")
+}
+
+// parseSimpleRuleYAML 处理 Clash 风格的 `rules:` 块序列（`- type: ...` /
+// `  value: ...` / `  action: ...`），与 importer.parseSimpleYAML 对服务器
+// 列表采用的是同一套惯例：不是通用 YAML 解析器，锚点、嵌套结构和多文档都
+// 不在支持范围内。
+func parseSimpleRuleYAML(data []byte) ([]ruleEntry, error) {
+	var entries []ruleEntry
+	var cur *ruleEntry
+	inRules := false
+
+	for _, raw := range strings.Split(string(data), "\n") {
+		trimmed := strings.TrimSpace(strings.TrimRight(raw, "\r"))
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if !inRules {
+			if trimmed == "rules:" {
+				inRules = true
+			}
+			continue
+		}
+		if strings.HasPrefix(trimmed, "- ") {
+			if cur != nil {
+				entries = append(entries, *cur)
+			}
+			cur = &ruleEntry{}
+			trimmed = strings.TrimPrefix(trimmed, "- ")
+		} else if cur == nil {
+			continue
+		}
+		kv := strings.SplitN(trimmed, ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		key := strings.TrimSpace(kv[0])
+		val := strings.Trim(strings.TrimSpace(kv[1]), `"'`)
+		switch key {
+		case "type":
+			cur.Type = val
+		case "value":
+			cur.Value = val
+		case "action":
+			cur.Action = val
+		}
+	}
+	if cur != nil {
+		entries = append(entries, *cur)
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("未找到 rules 列表")
+	}
+	return entries, nil
+}
+
+// newRoutingEngine 编译每条原始规则：正则表达式预编译、CIDR 预解析、端口
+// 预转换，任何一条规则格式错误都会让整个规则文件加载失败，而不是悄悄跳过
+// 坏规则，避免用户以为某条规则生效了但实际上从未被编译进去。
+func newRoutingEngine(entries []ruleEntry) (*RoutingEngine, error) {
+	rules := make([]Rule, 0, len(entries))
+	for i, e := range entries {
+		r := Rule{
+			Type:   strings.ToLower(strings.TrimSpace(e.Type)),
+			Value:  e.Value,
+			Action: strings.ToLower(strings.TrimSpace(e.Action)),
+		}
+		if r.Action == "" {
+			return nil, fmt.Errorf("第 %d 条规则缺少 action", i+1)
+		}
+
+		switch r.Type {
+		case "domain_suffix", "domain", "domain_exact":
+			// 不需要预编译
+		case "domain_regex":
+			re, err := regexp.Compile(e.Value)
+			if err != nil {
+				return nil, fmt.Errorf("第 %d 条规则的正则表达式无效: %w", i+1, err)
+			}
+			r.regex = re
+		case "cidr":
+			_, ipnet, err := net.ParseCIDR(e.Value)
+			if err != nil {
+				return nil, fmt.Errorf("第 %d 条规则的 CIDR 无效: %w", i+1, err)
+			}
+			r.cidr = ipnet
+		case "port":
+			p, err := strconv.Atoi(e.Value)
+			if err != nil {
+				return nil, fmt.Errorf("第 %d 条规则的端口无效: %w", i+1, err)
+			}
+			r.port = p
+		case "geoip":
+			// value 是一个或多个逗号分隔的 ISO 国家代码（如 "CN" 或
+			// "JP,US"），按 ProxyServer.LookupCountry 的结果匹配；未加载
+			// GeoIP 数据库时 LookupCountry 只能识别 "CN"。
+		default:
+			return nil, fmt.Errorf("第 %d 条规则的类型未知: %q", i+1, e.Type)
+		}
+
+		rules = append(rules, r)
+	}
+	return &RoutingEngine{rules: rules}, nil
+}
+
+// Resolve 按顺序尝试每条规则，返回第一条命中规则的原始 action 字符串；host
+// 是已解析出的目标主机（域名或 IP 字面量），port 是目标端口（0 表示未知）。
+// lookupCountry 由调用方传入（通常是 ProxyServer.LookupCountry），用于
+// geoip 规则判断目标所在的 ISO 国家代码。全部不命中时返回 ("", false)，
+// 调用方应退回默认分流模式。
+func (re *RoutingEngine) Resolve(host string, port int, lookupCountry func(string) string) (action string, matched bool) {
+	if re == nil {
+		return "", false
+	}
+	ip := net.ParseIP(host)
+	for _, r := range re.rules {
+		if ruleMatches(r, host, ip, port, lookupCountry) {
+			return r.Action, true
+		}
+	}
+	return "", false
+}
+
+func ruleMatches(r Rule, host string, ip net.IP, port int, lookupCountry func(string) string) bool {
+	switch r.Type {
+	case "domain_suffix":
+		// Clash 语义的 DOMAIN-SUFFIX：匹配域名本身或以 "."+Value 结尾的子域，
+		// 不能用裸 strings.HasSuffix，否则 "google.com" 会误匹配
+		// "evilgoogle.com" 这类无关域名。
+		return host == r.Value || strings.HasSuffix(host, "."+r.Value)
+	case "domain", "domain_exact":
+		return host == r.Value
+	case "domain_regex":
+		return r.regex != nil && r.regex.MatchString(host)
+	case "cidr":
+		return ip != nil && r.cidr != nil && r.cidr.Contains(ip)
+	case "port":
+		return port != 0 && port == r.port
+	case "geoip":
+		if lookupCountry == nil {
+			return false
+		}
+		target := host
+		if ip == nil {
+			ips, err := net.LookupIP(host)
+			if err != nil || len(ips) == 0 {
+				return false
+			}
+			target = ips[0].String()
+		}
+		cc := lookupCountry(target)
+		if cc == "" {
+			return false
+		}
+		for _, code := range strings.Split(r.Value, ",") {
+			if strings.EqualFold(strings.TrimSpace(code), cc) {
+				return true
+			}
+		}
+		return false
+	default:
+		return false
+	}
+}
+
+// normalizeAction 把规则里的原始 action 字符串映射到 RuleAction 常量；
+// 无法识别的值（包括为未来多出站分发预留、尚未实现的 "route:<tag>" 语法）
+// 一律按 ActionProxy 处理，保证配置里写了暂不支持的 action 时至少不会
+// 被意外直连或拒绝。
+func normalizeAction(raw string) RuleAction {
+	switch RuleAction(raw) {
+	case ActionDirect:
+		return ActionDirect
+	case ActionReject:
+		return ActionReject
+	case ActionProxy:
+		return ActionProxy
+	default:
+		return ActionProxy
+	}
+}
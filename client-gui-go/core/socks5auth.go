@@ -0,0 +1,137 @@
+package core
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+)
+
+// SOCKS5 方法协商里的方法编号（RFC 1928）。
+const (
+	socks5AuthNone     byte = 0x00
+	socks5AuthUserPass byte = 0x02
+	socks5AuthNoAccept byte = 0xFF
+)
+
+// Identity 是一次认证成功后得到的客户端身份。SOCKS5 用户名密码子协商和 HTTP
+// 的 Proxy-Authorization 共用同一个 Authenticator，因此也共用这一个类型，
+// 供调用方（目前是 handleTunnel 的日志和 connInfo）按用户名区分客户端；
+// 真正按身份匹配分流规则/限速目前还没有实现，留给以后按需扩展 RoutingEngine。
+type Identity struct {
+	User string
+}
+
+// Authenticator 校验一对用户名密码，返回对应的身份。
+type Authenticator interface {
+	Authenticate(user, pass string) (*Identity, error)
+}
+
+// StaticAuthenticator 是最简单的 Authenticator 实现：一份写死的用户名到密码
+// 的映射，供 ProxyConfig.Auth 直接使用。
+type StaticAuthenticator map[string]string
+
+// errSOCKS5AuthFailed 在用户名不存在或密码不匹配时统一返回，不区分两种情况
+// 的错误文案，避免给客户端提供用户名是否存在的信息。
+var errSOCKS5AuthFailed = errors.New("用户名或密码错误")
+
+// Authenticate 实现 Authenticator。
+func (a StaticAuthenticator) Authenticate(user, pass string) (*Identity, error) {
+	want, ok := a[user]
+	if !ok {
+		return nil, errSOCKS5AuthFailed
+	}
+	if subtle.ConstantTimeCompare([]byte(want), []byte(pass)) != 1 {
+		return nil, errSOCKS5AuthFailed
+	}
+	return &Identity{User: user}, nil
+}
+
+// negotiateSOCKS5Auth 根据客户端提供的方法列表选择认证方式并完成协商，返回
+// 认证通过的身份（未配置 ps.config.Auth 时恒为 nil）。ps.config.Auth 为 nil
+// 时保持现有行为：直接回复 {0x05, socks5AuthNone}，不要求认证。
+func (ps *ProxyServer) negotiateSOCKS5Auth(conn net.Conn, methods []byte) (*Identity, error) {
+	if ps.config.Auth == nil {
+		_, err := conn.Write([]byte{0x05, socks5AuthNone})
+		return nil, err
+	}
+
+	offered := false
+	for _, m := range methods {
+		if m == socks5AuthUserPass {
+			offered = true
+			break
+		}
+	}
+	if !offered {
+		conn.Write([]byte{0x05, socks5AuthNoAccept})
+		return nil, errors.New("客户端未提供用户名密码认证方法")
+	}
+
+	if _, err := conn.Write([]byte{0x05, socks5AuthUserPass}); err != nil {
+		return nil, err
+	}
+	return ps.authenticateSOCKS5UserPass(conn)
+}
+
+// authenticateSOCKS5UserPass 处理方法选择之后的用户名密码子协商（RFC 1929）：
+// 版本 0x01，ulen/uname/plen/passwd，成功回复 {0x01, 0x00}，失败回复
+// {0x01, 0x01} 并断开。
+func (ps *ProxyServer) authenticateSOCKS5UserPass(conn net.Conn) (*Identity, error) {
+	header := make([]byte, 1)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return nil, err
+	}
+	if header[0] != 0x01 {
+		return nil, fmt.Errorf("不支持的用户名密码子协商版本: 0x%02x", header[0])
+	}
+
+	ulen := make([]byte, 1)
+	if _, err := io.ReadFull(conn, ulen); err != nil {
+		return nil, err
+	}
+	userBuf := make([]byte, ulen[0])
+	if _, err := io.ReadFull(conn, userBuf); err != nil {
+		return nil, err
+	}
+
+	plen := make([]byte, 1)
+	if _, err := io.ReadFull(conn, plen); err != nil {
+		return nil, err
+	}
+	passBuf := make([]byte, plen[0])
+	if _, err := io.ReadFull(conn, passBuf); err != nil {
+		return nil, err
+	}
+
+	identity, err := ps.config.Auth.Authenticate(string(userBuf), string(passBuf))
+	if err != nil {
+		conn.Write([]byte{0x01, 0x01})
+		return nil, err
+	}
+	if _, err := conn.Write([]byte{0x01, 0x00}); err != nil {
+		return nil, err
+	}
+	return identity, nil
+}
+
+// identityFromProxyAuthorization 解析 HTTP 代理请求里的 Proxy-Authorization:
+// Basic 头，和 SOCKS5 共用同一个 ps.config.Auth，让两种协议共享一份凭据表。
+func (ps *ProxyServer) identityFromProxyAuthorization(header string) (*Identity, error) {
+	const prefix = "Basic "
+	if !strings.HasPrefix(header, prefix) {
+		return nil, errors.New("不支持的 Proxy-Authorization 认证方案")
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(header, prefix))
+	if err != nil {
+		return nil, fmt.Errorf("Proxy-Authorization 解码失败: %w", err)
+	}
+	user, pass, ok := strings.Cut(string(decoded), ":")
+	if !ok {
+		return nil, errors.New("Proxy-Authorization 格式错误")
+	}
+	return ps.config.Auth.Authenticate(user, pass)
+}
@@ -0,0 +1,79 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// tunnelFrameHeaderLen 是长度前缀帧的帧头长度：4字节大端长度。
+const tunnelFrameHeaderLen = 4
+
+// defaultMaxTunnelFrameSize 是 TunnelMaxFrameSize 未配置时使用的上限。
+const defaultMaxTunnelFrameSize = 1 << 20 // 1 MiB
+
+// tunnelCodec 是 handleTunnel 两个转发方向共用的长度前缀帧格式："4字节
+// 大端长度 + 载荷"，显式标出每个负载在 WS BinaryMessage 里的边界，而不是
+// 把"一次 conn.Read 读到的字节数"隐式当成应用层消息边界——这正是 TCP
+// 转发里经典的粘包/拆包问题，用一个记录长度的帧头是惯用的解法。
+type tunnelCodec struct {
+	maxFrameSize int
+}
+
+// newTunnelCodec 创建一个 codec，maxFrameSize<=0 时使用
+// defaultMaxTunnelFrameSize。
+func newTunnelCodec(maxFrameSize int) *tunnelCodec {
+	if maxFrameSize <= 0 {
+		maxFrameSize = defaultMaxTunnelFrameSize
+	}
+	return &tunnelCodec{maxFrameSize: maxFrameSize}
+}
+
+// WriteFrame 把 payload 编码成一帧写入 w。payload 超过 maxFrameSize 时返回
+// 错误而不是截断——调用方应该把这当成致命错误断开连接，而不是悄悄丢数据。
+func (c *tunnelCodec) WriteFrame(w io.Writer, payload []byte) error {
+	if len(payload) > c.maxFrameSize {
+		return fmt.Errorf("帧长度 %d 超过上限 %d", len(payload), c.maxFrameSize)
+	}
+	header := make([]byte, tunnelFrameHeaderLen)
+	binary.BigEndian.PutUint32(header, uint32(len(payload)))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.Write(payload)
+	return err
+}
+
+// ReadFrame 用 io.ReadFull 读出一个完整帧；对端提前关闭导致读不满帧头或
+// 载荷，或者声明长度超过 maxFrameSize，都会返回错误。
+func (c *tunnelCodec) ReadFrame(r io.Reader) ([]byte, error) {
+	header := make([]byte, tunnelFrameHeaderLen)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	length := binary.BigEndian.Uint32(header)
+	if int(length) > c.maxFrameSize {
+		return nil, fmt.Errorf("帧长度 %d 超过上限 %d", length, c.maxFrameSize)
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// ReadFrames 从 data（一条完整的 WS BinaryMessage）里按 WriteFrame 的格式
+// 连续解出所有帧，发送端把多帧合批进一条 WS 消息时也能正确拆开。
+func (c *tunnelCodec) ReadFrames(data []byte) ([][]byte, error) {
+	var frames [][]byte
+	br := bytes.NewReader(data)
+	for br.Len() > 0 {
+		payload, err := c.ReadFrame(br)
+		if err != nil {
+			return nil, err
+		}
+		frames = append(frames, payload)
+	}
+	return frames, nil
+}
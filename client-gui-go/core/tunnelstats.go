@@ -0,0 +1,22 @@
+package core
+
+import "net"
+
+// TunnelStats 是 handleTunnel/handleDirectConnection 一次隧道转发的结果：
+// 双向拷贝的字节数，以及转发阶段遇到的第一个非正常关闭错误（EOF、对端主动
+// 关闭等视为正常，不计入 Err），供调用方做日志或指标统计。
+type TunnelStats struct {
+	BytesUp   int64 // 客户端 -> 目标/后端
+	BytesDown int64 // 目标/后端 -> 客户端
+	Err       error
+}
+
+// closeWrite 半关闭 conn 的写方向：真正的 TCP 连接（*net.TCPConn 等实现了
+// CloseWrite 的类型）允许对端继续把尚未发完的数据发完，只是不再接受这一侧
+// 新写入的数据；不支持半关闭的连接类型退回整体 Close。
+func closeWrite(conn net.Conn) error {
+	if cw, ok := conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return conn.Close()
+}
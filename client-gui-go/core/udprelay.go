@@ -0,0 +1,268 @@
+package core
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// udpFrameHeaderLen 是 UDP 中继复用帧的帧头长度：4字节会话ID + 4字节载荷
+// 长度，帧本身通过 websocket.BinaryMessage 发送。
+const udpFrameHeaderLen = 8
+
+// udpSessionIdleTimeout 是一条 UDP 会话（同一个 dstHost:dstPort 的数据流）
+// 允许的最长静默时间，超时后本地关闭它并通知后端释放资源。
+const udpSessionIdleTimeout = 60 * time.Second
+
+// udpSessionSweepInterval 是扫描过期会话的周期。
+const udpSessionSweepInterval = 15 * time.Second
+
+// encodeUDPFrame 把 sessionID/payload 编码成一个待发送的 UDP 中继帧。
+func encodeUDPFrame(sessionID uint32, payload []byte) []byte {
+	frame := make([]byte, udpFrameHeaderLen+len(payload))
+	binary.BigEndian.PutUint32(frame[0:4], sessionID)
+	binary.BigEndian.PutUint32(frame[4:8], uint32(len(payload)))
+	copy(frame[udpFrameHeaderLen:], payload)
+	return frame
+}
+
+// decodeUDPFrame 解析 encodeUDPFrame 编码的一个 UDP 中继帧。
+func decodeUDPFrame(frame []byte) (sessionID uint32, payload []byte, err error) {
+	if len(frame) < udpFrameHeaderLen {
+		return 0, nil, errors.New("UDP 中继帧长度不足")
+	}
+	sessionID = binary.BigEndian.Uint32(frame[0:4])
+	length := binary.BigEndian.Uint32(frame[4:8])
+	if int(length) != len(frame)-udpFrameHeaderLen {
+		return 0, nil, fmt.Errorf("UDP 中继帧载荷长度不匹配: 声明 %d，实际 %d", length, len(frame)-udpFrameHeaderLen)
+	}
+	return sessionID, frame[udpFrameHeaderLen:], nil
+}
+
+// udpSessionKey 标识一次 SOCKS5 UDP ASSOCIATE 内部的一个目的地。同一个
+// udpRelay（同一条客户端 UDP 连接）下，每个 dstHost:dstPort 对应一个会话。
+type udpSessionKey struct {
+	dstHost string
+	dstPort int
+}
+
+// udpSession 是本地视角下一条已经打开的 UDP 中继会话。
+type udpSession struct {
+	id         uint32
+	key        udpSessionKey
+	clientAddr *net.UDPAddr
+	header     []byte // 原始 SOCKS5 UDP 请求头（RSV+FRAG+ATYP+DST.ADDR+DST.PORT），回包时原样复用
+	lastActive time.Time
+}
+
+// udpRelay 在一条专用的、长期存活的 ECH WebSocket 连接上为一次 SOCKS5 UDP
+// ASSOCIATE 里所有非 DNS 的 (dstHost,dstPort) 目的地复用会话：第一次遇到
+// 某个目的地时发送 `UDP:host:port` 文本控制帧，等待后端用
+// `UDP-SESSION:<id>` 分配一个会话ID；之后同一目的地的数据报都装进
+// udpFrameHeaderLen 描述的二进制帧，带着这个会话ID 发送。入站的二进制帧
+// 按会话ID 找回发起它的客户端 *net.UDPAddr 和原始 SOCKS5 UDP 请求头，
+// 把请求头重新拼到载荷前面后经 udpConn.WriteToUDP 送回去，符合 RFC 1928
+// 对 UDP 应答报文格式的要求。
+//
+// 后端 Worker 需要实现同一套帧格式（见 handleUDPRelay 里现有的
+// port-53/DoH 分支作为参照），这是本次改动里在客户端侧能独立完成的部分。
+type udpRelay struct {
+	ps         *ProxyServer
+	udpConn    *net.UDPConn
+	clientAddr string
+
+	wsConn *websocket.Conn
+	wsMu   sync.Mutex // gorilla/websocket 要求同一连接上的写操作互斥
+
+	openMu         sync.Mutex // 串行化"打开新会话"的握手，避免响应串台
+	pendingSession chan uint32
+
+	mu       sync.Mutex
+	sessions map[uint32]*udpSession
+	byTarget map[udpSessionKey]uint32
+
+	stopChan  chan struct{}
+	closeOnce sync.Once
+}
+
+// newUDPRelay 为一次 UDP ASSOCIATE 建立专用的 ECH WebSocket 连接。
+func newUDPRelay(ps *ProxyServer, udpConn *net.UDPConn, clientAddr string) (*udpRelay, error) {
+	wsConn, err := ps.dialWebSocketWithECH(2)
+	if err != nil {
+		return nil, fmt.Errorf("建立 UDP 中继 WebSocket 连接失败: %w", err)
+	}
+	r := &udpRelay{
+		ps:             ps,
+		udpConn:        udpConn,
+		clientAddr:     clientAddr,
+		wsConn:         wsConn,
+		pendingSession: make(chan uint32, 1),
+		sessions:       make(map[uint32]*udpSession),
+		byTarget:       make(map[udpSessionKey]uint32),
+		stopChan:       make(chan struct{}),
+	}
+	go r.readLoop()
+	go r.sweepLoop()
+	return r, nil
+}
+
+// Write 把一个客户端数据报转发给 dstHost:dstPort，必要时先打开一条新会话。
+// header 是这个请求原始的 SOCKS5 UDP 头（RSV+FRAG+ATYP+DST.ADDR+DST.PORT），
+// 存进会话里供 readLoop 回包时原样复用，见 handleDNSQuery 的同一约定。
+func (r *udpRelay) Write(dstHost string, dstPort int, clientUDPAddr *net.UDPAddr, header, payload []byte) error {
+	id, err := r.sessionFor(dstHost, dstPort, clientUDPAddr, header)
+	if err != nil {
+		return err
+	}
+	r.wsMu.Lock()
+	defer r.wsMu.Unlock()
+	return r.wsConn.WriteMessage(websocket.BinaryMessage, encodeUDPFrame(id, payload))
+}
+
+// sessionFor 返回 dstHost:dstPort 对应的会话ID，命中已有会话时顺带刷新它
+// 的客户端地址、请求头和活跃时间（同一目的地可能换了一个新的源端口发来
+// 数据报）。
+func (r *udpRelay) sessionFor(dstHost string, dstPort int, clientUDPAddr *net.UDPAddr, header []byte) (uint32, error) {
+	key := udpSessionKey{dstHost: dstHost, dstPort: dstPort}
+
+	r.mu.Lock()
+	if id, ok := r.byTarget[key]; ok {
+		r.sessions[id].lastActive = time.Now()
+		r.sessions[id].clientAddr = clientUDPAddr
+		r.sessions[id].header = header
+		r.mu.Unlock()
+		return id, nil
+	}
+	r.mu.Unlock()
+
+	r.openMu.Lock()
+	defer r.openMu.Unlock()
+
+	// 握手期间可能已经被另一个 goroutine 打开，重新确认一次。
+	r.mu.Lock()
+	if id, ok := r.byTarget[key]; ok {
+		r.mu.Unlock()
+		return id, nil
+	}
+	r.mu.Unlock()
+
+	r.wsMu.Lock()
+	err := r.wsConn.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf("UDP:%s:%d", dstHost, dstPort)))
+	r.wsMu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+
+	select {
+	case id := <-r.pendingSession:
+		r.mu.Lock()
+		r.sessions[id] = &udpSession{id: id, key: key, clientAddr: clientUDPAddr, header: header, lastActive: time.Now()}
+		r.byTarget[key] = id
+		r.mu.Unlock()
+		return id, nil
+	case <-time.After(10 * time.Second):
+		return 0, errors.New("等待后端分配 UDP 会话超时")
+	case <-r.stopChan:
+		return 0, errors.New("UDP 中继已关闭")
+	}
+}
+
+// readLoop 持续读取专用 WebSocket 连接：文本帧是 UDP-SESSION:<id> 握手
+// 应答，二进制帧是复用的数据报，按会话ID 分发回发起它的客户端地址。
+func (r *udpRelay) readLoop() {
+	defer r.Close()
+	for {
+		mt, msg, err := r.wsConn.ReadMessage()
+		if err != nil {
+			return
+		}
+		switch mt {
+		case websocket.TextMessage:
+			text := string(msg)
+			if !strings.HasPrefix(text, "UDP-SESSION:") {
+				continue
+			}
+			id64, err := strconv.ParseUint(strings.TrimPrefix(text, "UDP-SESSION:"), 10, 32)
+			if err != nil {
+				continue
+			}
+			select {
+			case r.pendingSession <- uint32(id64):
+			default:
+			}
+		case websocket.BinaryMessage:
+			sessionID, payload, err := decodeUDPFrame(msg)
+			if err != nil {
+				continue
+			}
+			r.mu.Lock()
+			sess, ok := r.sessions[sessionID]
+			var clientAddr *net.UDPAddr
+			var header []byte
+			if ok {
+				sess.lastActive = time.Now()
+				clientAddr = sess.clientAddr
+				header = sess.header
+			}
+			r.mu.Unlock()
+			if !ok {
+				continue
+			}
+			// 补回 RFC 1928 的 UDP 请求头，否则客户端会把载荷的前几个字节
+			// 当成头解析，导致每条中继回包都被截断/错读。
+			response := make([]byte, 0, len(header)+len(payload))
+			response = append(response, header...)
+			response = append(response, payload...)
+			r.udpConn.WriteToUDP(response, clientAddr)
+		}
+	}
+}
+
+// sweepLoop 定期关闭闲置超过 udpSessionIdleTimeout 的会话。
+func (r *udpRelay) sweepLoop() {
+	ticker := time.NewTicker(udpSessionSweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stopChan:
+			return
+		case <-ticker.C:
+			r.closeIdleSessions()
+		}
+	}
+}
+
+func (r *udpRelay) closeIdleSessions() {
+	now := time.Now()
+	r.mu.Lock()
+	var expired []uint32
+	for id, sess := range r.sessions {
+		if now.Sub(sess.lastActive) > udpSessionIdleTimeout {
+			expired = append(expired, id)
+			delete(r.sessions, id)
+			delete(r.byTarget, sess.key)
+		}
+	}
+	r.mu.Unlock()
+
+	for _, id := range expired {
+		r.wsMu.Lock()
+		r.wsConn.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf("UDP-CLOSE:%d", id)))
+		r.wsMu.Unlock()
+	}
+}
+
+// Close 关闭专用 WebSocket 连接和后台循环，仅在进程内清理，不等待后端确认。
+func (r *udpRelay) Close() {
+	r.closeOnce.Do(func() {
+		close(r.stopChan)
+		r.wsConn.Close()
+	})
+}
@@ -0,0 +1,369 @@
+package core
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// wsFrameHeaderLen 是每个复用帧前缀的字节数：4字节流ID + 1字节标志位 +
+// 4字节载荷长度，帧本身通过 websocket.BinaryMessage 发送。
+const wsFrameHeaderLen = 9
+
+// 复用帧标志位
+const (
+	wsFlagOpen  byte = 0x00 // 打开一条新的逻辑流
+	wsFlagData  byte = 0x01 // 普通数据
+	wsFlagClose byte = 0x02 // 关闭这条逻辑流（两个方向均可发起）
+)
+
+// encodeWSFrame 把 streamID/flag/payload 编码成一个待发送的复用帧。
+func encodeWSFrame(streamID uint32, flag byte, payload []byte) []byte {
+	frame := make([]byte, wsFrameHeaderLen+len(payload))
+	binary.BigEndian.PutUint32(frame[0:4], streamID)
+	frame[4] = flag
+	binary.BigEndian.PutUint32(frame[5:9], uint32(len(payload)))
+	copy(frame[wsFrameHeaderLen:], payload)
+	return frame
+}
+
+// decodeWSFrame 解析 encodeWSFrame 编码的一个复用帧。
+func decodeWSFrame(frame []byte) (streamID uint32, flag byte, payload []byte, err error) {
+	if len(frame) < wsFrameHeaderLen {
+		return 0, 0, nil, errors.New("复用帧长度不足")
+	}
+	streamID = binary.BigEndian.Uint32(frame[0:4])
+	flag = frame[4]
+	length := binary.BigEndian.Uint32(frame[5:9])
+	if int(length) != len(frame)-wsFrameHeaderLen {
+		return 0, 0, nil, fmt.Errorf("复用帧载荷长度不匹配: 声明 %d，实际 %d", length, len(frame)-wsFrameHeaderLen)
+	}
+	return streamID, flag, frame[wsFrameHeaderLen:], nil
+}
+
+// wsStream 是 WSPool 在一条物理 WebSocket 连接上开出的一条逻辑流，对外
+// 表现为一个 io.ReadWriteCloser，读写的都是已经去掉帧头的数据。
+type wsStream struct {
+	id   uint32
+	conn *pooledWSConn
+
+	incoming  chan []byte
+	pending   []byte // incoming 里取出但没读完的剩余数据
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func (s *wsStream) Read(p []byte) (int, error) {
+	if len(s.pending) > 0 {
+		n := copy(p, s.pending)
+		s.pending = s.pending[n:]
+		return n, nil
+	}
+	select {
+	case data, ok := <-s.incoming:
+		if !ok {
+			return 0, io.EOF
+		}
+		n := copy(p, data)
+		if n < len(data) {
+			s.pending = data[n:]
+		}
+		return n, nil
+	case <-s.closed:
+		return 0, io.EOF
+	}
+}
+
+func (s *wsStream) Write(p []byte) (int, error) {
+	if err := s.conn.writeFrame(s.id, wsFlagData, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close 通知对端关闭这条逻辑流，并让本地的 Read 立即返回 io.EOF。物理连接
+// 本身不受影响，仍留在池里供其他流复用。
+func (s *wsStream) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		err = s.conn.writeFrame(s.id, wsFlagClose, nil)
+		close(s.closed)
+		s.conn.dropStream(s.id)
+	})
+	return err
+}
+
+// pooledWSConn 包装一条长期存活的、到后端的 ECH WebSocket 连接，把入站的
+//复用帧按 streamID 分发给对应的 wsStream，让多个客户端会话共享同一条
+// TLS+ECH+WS 握手的成本。
+type pooledWSConn struct {
+	conn *websocket.Conn
+
+	writeMu sync.Mutex // gorilla/websocket 要求同一连接上的写操作互斥
+
+	streamsMu  sync.Mutex
+	streams    map[uint32]*wsStream
+	nextID     uint32
+	lastActive time.Time
+	closed     bool
+}
+
+func newPooledWSConn(conn *websocket.Conn) *pooledWSConn {
+	pc := &pooledWSConn{
+		conn:       conn,
+		streams:    make(map[uint32]*wsStream),
+		lastActive: time.Now(),
+	}
+	go pc.readLoop()
+	return pc
+}
+
+// streamCount 返回当前这条物理连接上仍然存活的逻辑流数量，WSPool 据此判断
+// 是否已经饱和。
+func (pc *pooledWSConn) streamCount() int {
+	pc.streamsMu.Lock()
+	defer pc.streamsMu.Unlock()
+	return len(pc.streams)
+}
+
+// openStream 在这条物理连接上分配一个新的 streamID 并通知对端打开它。
+func (pc *pooledWSConn) openStream() (*wsStream, error) {
+	pc.streamsMu.Lock()
+	pc.nextID++
+	id := pc.nextID
+	s := &wsStream{
+		id:       id,
+		conn:     pc,
+		incoming: make(chan []byte, 16),
+		closed:   make(chan struct{}),
+	}
+	pc.streams[id] = s
+	pc.lastActive = time.Now()
+	pc.streamsMu.Unlock()
+
+	if err := pc.writeFrame(id, wsFlagOpen, nil); err != nil {
+		pc.dropStream(id)
+		return nil, err
+	}
+	return s, nil
+}
+
+func (pc *pooledWSConn) dropStream(id uint32) {
+	pc.streamsMu.Lock()
+	delete(pc.streams, id)
+	pc.streamsMu.Unlock()
+}
+
+func (pc *pooledWSConn) writeFrame(id uint32, flag byte, payload []byte) error {
+	pc.writeMu.Lock()
+	defer pc.writeMu.Unlock()
+	return pc.conn.WriteMessage(websocket.BinaryMessage, encodeWSFrame(id, flag, payload))
+}
+
+// readLoop 持续读取这条物理连接上的复用帧，把数据分发给对应的 wsStream；
+// 遇到 wsFlagClose 或连接本身出错时清理相应的流。
+func (pc *pooledWSConn) readLoop() {
+	defer pc.Close()
+	for {
+		mt, msg, err := pc.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		if mt != websocket.BinaryMessage {
+			continue
+		}
+		streamID, flag, payload, err := decodeWSFrame(msg)
+		if err != nil {
+			continue
+		}
+
+		pc.streamsMu.Lock()
+		pc.lastActive = time.Now()
+		s, ok := pc.streams[streamID]
+		pc.streamsMu.Unlock()
+		if !ok {
+			continue
+		}
+
+		switch flag {
+		case wsFlagClose:
+			s.closeOnce.Do(func() { close(s.closed) })
+			pc.dropStream(streamID)
+		case wsFlagData:
+			select {
+			case s.incoming <- payload:
+			case <-s.closed:
+			}
+		}
+	}
+}
+
+// idleSince 返回这条连接已经没有任何活动（收发帧）多久了。
+func (pc *pooledWSConn) idleSince() time.Duration {
+	pc.streamsMu.Lock()
+	defer pc.streamsMu.Unlock()
+	return time.Since(pc.lastActive)
+}
+
+func (pc *pooledWSConn) ping() error {
+	pc.writeMu.Lock()
+	defer pc.writeMu.Unlock()
+	return pc.conn.WriteMessage(websocket.PingMessage, nil)
+}
+
+func (pc *pooledWSConn) Close() {
+	pc.streamsMu.Lock()
+	if pc.closed {
+		pc.streamsMu.Unlock()
+		return
+	}
+	pc.closed = true
+	for _, s := range pc.streams {
+		s.closeOnce.Do(func() { close(s.closed) })
+	}
+	pc.streams = make(map[uint32]*wsStream)
+	pc.streamsMu.Unlock()
+	pc.conn.Close()
+}
+
+// WSPool 维护若干条到 ps.config.ServerAddr 的长连接，每条连接上用
+// wsFrameHeaderLen 描述的帧头复用多条逻辑流。新的客户端会话（见
+// handleTunnelViaPool）从负载最轻的存活连接上获取一条流，只有在所有连接都
+// 达到 maxStreamsPerConn 时才会新建一条物理连接；空闲超过 idleTimeout 且
+// 没有活动流的连接会被回收，probeInterval 驱动的健康探测负责剔除已经失效
+// 但还没报错的连接。
+//
+// 说明：要让 wsPool 真正工作，后端 Worker 也需要认识同一套复用帧格式和
+// handleTunnelViaPool 里的长度前缀控制协议；在后端协议升级之前，启用
+// WSPoolMaxStreamsPerConn 会直接破坏与现有服务端的兼容性，所以默认关闭。
+type WSPool struct {
+	ps *ProxyServer
+
+	maxStreamsPerConn int
+	idleTimeout       time.Duration
+	probeInterval     time.Duration
+	poolSize          int
+
+	mu       sync.Mutex
+	conns    []*pooledWSConn
+	stopChan chan struct{}
+}
+
+// newWSPool 创建一个连接池。maxStreamsPerConn<=0 时退回到 1（等价于
+// 每条流一条物理连接，也就是不开启连接池时 handleTunnel 的行为）。
+// poolSize>0 时立即预热这么多条物理连接，而不是等第一次 Acquire 才握手。
+func newWSPool(ps *ProxyServer, maxStreamsPerConn int, idleTimeout, probeInterval time.Duration, poolSize int) *WSPool {
+	if maxStreamsPerConn <= 0 {
+		maxStreamsPerConn = 1
+	}
+	p := &WSPool{
+		ps:                ps,
+		maxStreamsPerConn: maxStreamsPerConn,
+		idleTimeout:       idleTimeout,
+		probeInterval:     probeInterval,
+		poolSize:          poolSize,
+		stopChan:          make(chan struct{}),
+	}
+	if probeInterval > 0 {
+		go p.healthLoop()
+	}
+	if poolSize > 0 {
+		go p.prewarm()
+	}
+	return p
+}
+
+// prewarm 在后台把池子攒到 poolSize 条物理连接，单条握手失败只记日志，不
+// 阻塞调用方；Acquire 仍然会在预热完成前按需建连。
+func (p *WSPool) prewarm() {
+	for i := 0; i < p.poolSize; i++ {
+		if _, err := p.dialNewConn(); err != nil {
+			p.ps.logf("[WebSocket连接池] 预热第 %d 条连接失败: %v", i+1, err)
+		}
+	}
+}
+
+// Acquire 从负载最轻的存活连接上取一条新流，必要时新建物理连接。
+func (p *WSPool) Acquire() (*wsStream, error) {
+	p.mu.Lock()
+	var best *pooledWSConn
+	for _, pc := range p.conns {
+		if pc.streamCount() >= p.maxStreamsPerConn {
+			continue
+		}
+		if best == nil || pc.streamCount() < best.streamCount() {
+			best = pc
+		}
+	}
+	p.mu.Unlock()
+
+	if best == nil {
+		pc, err := p.dialNewConn()
+		if err != nil {
+			return nil, fmt.Errorf("创建新的 WebSocket 连接失败: %w", err)
+		}
+		best = pc
+	}
+	return best.openStream()
+}
+
+func (p *WSPool) dialNewConn() (*pooledWSConn, error) {
+	wsConn, err := p.ps.dialWebSocketWithECH(2)
+	if err != nil {
+		return nil, err
+	}
+	pc := newPooledWSConn(wsConn)
+
+	p.mu.Lock()
+	p.conns = append(p.conns, pc)
+	p.mu.Unlock()
+	return pc, nil
+}
+
+// healthLoop 周期性地对池内连接发 ping，回收空闲超时或已经失效的连接。
+func (p *WSPool) healthLoop() {
+	ticker := time.NewTicker(p.probeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stopChan:
+			return
+		case <-ticker.C:
+			p.reapAndProbe()
+		}
+	}
+}
+
+func (p *WSPool) reapAndProbe() {
+	p.mu.Lock()
+	live := make([]*pooledWSConn, 0, len(p.conns))
+	for _, pc := range p.conns {
+		if pc.streamCount() == 0 && p.idleTimeout > 0 && pc.idleSince() > p.idleTimeout {
+			pc.Close()
+			continue
+		}
+		if err := pc.ping(); err != nil {
+			pc.Close()
+			continue
+		}
+		live = append(live, pc)
+	}
+	p.conns = live
+	p.mu.Unlock()
+}
+
+// Close 关闭池内所有物理连接并停止健康探测循环。
+func (p *WSPool) Close() {
+	close(p.stopChan)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, pc := range p.conns {
+		pc.Close()
+	}
+	p.conns = nil
+}
@@ -0,0 +1,150 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// handleTunnelViaPool 和 handleTunnel 里直接握手的路径功能等价，区别是从
+// ps.wsPool 取一条复用的逻辑流（wsStream），而不是每个会话都重新做一次完整
+// 的 TLS+ECH+WebSocket 握手。wsStream 只是一个不带消息边界的
+// io.ReadWriteCloser，所以这里始终用 tunnelCodec（见 tunnelcodec.go）显式
+// 加长度前缀，把控制握手（CONNECT:/CONNECTED/ERROR:）和之后的数据负载都
+// 分成独立的帧——这一点和裸 WebSocket 连接天然带有的消息边界不同，和
+// ps.config.TunnelFraming 是否开启无关。
+//
+// 和 wspool.go 的说明一致：这需要后端 Worker 同时认识复用帧格式（见
+// encodeWSFrame/decodeWSFrame）和这里的长度前缀控制协议，客户端这一侧先把
+// 基础设施和调用路径补齐。
+func (ps *ProxyServer) handleTunnelViaPool(conn net.Conn, target, clientAddr string, mode int, firstFrame string, identity *Identity) (TunnelStats, error) {
+	stream, err := ps.wsPool.Acquire()
+	if err != nil {
+		ps.logf("[代理] 从连接池获取复用流失败: %v", err)
+		ps.recordDialError("pool_acquire_failed")
+		sendErrorResponse(conn, mode)
+		return TunnelStats{}, fmt.Errorf("从连接池获取复用流失败: %w", err)
+	}
+	defer stream.Close()
+
+	ps.setConnTarget(conn, target)
+	ps.setConnIdentity(conn, identity)
+
+	codec := newTunnelCodec(ps.config.TunnelMaxFrameSize)
+
+	// 如果没有预设的 firstFrame，尝试读取第一帧数据（仅 SOCKS5），和裸
+	// WebSocket 路径保持一致
+	if firstFrame == "" && mode == modeSOCKS5 {
+		_ = conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		buffer := make([]byte, 8192)
+		n, _ := conn.Read(buffer)
+		_ = conn.SetReadDeadline(time.Time{})
+		if n > 0 {
+			firstFrame = string(buffer[:n])
+		}
+	}
+
+	connectMsg := fmt.Sprintf("CONNECT:%s|%s", target, firstFrame)
+	if err := codec.WriteFrame(stream, []byte(connectMsg)); err != nil {
+		sendErrorResponse(conn, mode)
+		return TunnelStats{}, err
+	}
+
+	respFrame, err := codec.ReadFrame(stream)
+	if err != nil {
+		sendErrorResponse(conn, mode)
+		return TunnelStats{}, err
+	}
+
+	response := string(respFrame)
+	if strings.HasPrefix(response, "ERROR:") {
+		sendErrorResponse(conn, mode)
+		return TunnelStats{}, errors.New(response)
+	}
+	if response != "CONNECTED" {
+		sendErrorResponse(conn, mode)
+		return TunnelStats{}, fmt.Errorf("意外响应: %s", response)
+	}
+
+	if err := sendSuccessResponse(conn, mode); err != nil {
+		return TunnelStats{}, err
+	}
+
+	if identity != nil {
+		ps.logf("[代理] %s (用户 %s) 已连接(连接池): %s", clientAddr, identity.User, target)
+	} else {
+		ps.logf("[代理] %s 已连接(连接池): %s", clientAddr, target)
+	}
+
+	// 双向转发，语义和 handleTunnel 的半关闭一致：一个方向结束后不整条
+	// 断开，用 WaitGroup 等两边都完成。流上没有 WS 的 TextMessage/CLOSE
+	// 可用，约定一个长度为 0 的帧表示"这个方向没有更多数据了"。
+	var stats TunnelStats
+	var statsMu sync.Mutex
+	recordErr := func(err error) {
+		if err == nil || isNormalCloseError(err) {
+			return
+		}
+		statsMu.Lock()
+		if stats.Err == nil {
+			stats.Err = err
+		}
+		statsMu.Unlock()
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	// Client -> Server
+	go func() {
+		defer wg.Done()
+		buf := make([]byte, 8192)
+		for {
+			n, err := conn.Read(buf)
+			if n > 0 {
+				if werr := codec.WriteFrame(stream, buf[:n]); werr != nil {
+					recordErr(werr)
+					break
+				}
+				atomic.AddInt64(&stats.BytesUp, int64(n))
+				ps.addBytesOut(conn, n)
+			}
+			if err != nil {
+				recordErr(err)
+				break
+			}
+		}
+		// 半关闭：发一个空帧表示这个方向已经没有更多数据
+		codec.WriteFrame(stream, nil)
+	}()
+
+	// Server -> Client
+	go func() {
+		defer wg.Done()
+		for {
+			payload, err := codec.ReadFrame(stream)
+			if err != nil {
+				recordErr(err)
+				break
+			}
+			if len(payload) == 0 {
+				break
+			}
+			if _, werr := conn.Write(payload); werr != nil {
+				recordErr(werr)
+				break
+			}
+			atomic.AddInt64(&stats.BytesDown, int64(len(payload)))
+			ps.addBytesIn(conn, len(payload))
+		}
+		closeWrite(conn)
+	}()
+
+	wg.Wait()
+	ps.logf("[代理] %s 已断开(连接池): %s (上行 %d 字节, 下行 %d 字节)", clientAddr, target, stats.BytesUp, stats.BytesDown)
+	return stats, nil
+}
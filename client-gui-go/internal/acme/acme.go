@@ -0,0 +1,410 @@
+// Package acme obtains and auto-renews TLS certificates via
+// github.com/go-acme/lego/v4 for domains the embedded proxy server or a
+// future HTTPS/reverse-proxy listener fronts. A Manager caches its ACME
+// account key and issued certificates under the user's config directory
+// so a client restart doesn't re-register with the CA or re-issue a
+// certificate before it actually needs renewing.
+package acme
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/go-acme/lego/v4/certcrypto"
+	"github.com/go-acme/lego/v4/certificate"
+	"github.com/go-acme/lego/v4/challenge/http01"
+	"github.com/go-acme/lego/v4/challenge/tlsalpn01"
+	"github.com/go-acme/lego/v4/lego"
+	"github.com/go-acme/lego/v4/registration"
+)
+
+// renewBefore is how long before expiry a certificate gets renewed,
+// matching the industry-standard ~30 day margin certbot/lego use.
+const renewBefore = 30 * 24 * time.Hour
+
+// renewCheckInterval is how often the background goroutine wakes up to
+// check whether the current certificate is within renewBefore of expiry.
+const renewCheckInterval = 12 * time.Hour
+
+// Config describes one set of domains to obtain/renew a certificate for.
+// It carries every field of config.ACME under the same name so callers can
+// build it directly from the saved config without a separate conversion
+// type living here, plus CADirURL and CacheDir, which config.ACME lacks.
+type Config struct {
+	Domains []string
+	Email   string
+
+	// Challenge selects how Domains' ownership is proven: "http-01"
+	// (default), "tls-alpn-01" or "dns-01".
+	Challenge string
+
+	// HTTPChallengePort/TLSALPNPort are the local ports the respective
+	// challenge provider binds; 0 falls back to lego's own defaults
+	// (80/443).
+	HTTPChallengePort int
+	TLSALPNPort       int
+
+	// DNSProvider/DNSProviderCredentials configure the "dns-01" path,
+	// see newDNSProvider in providers.go.
+	DNSProvider            string
+	DNSProviderCredentials map[string]string
+
+	// KeyType selects the certificate's private key algorithm: "RSA2048",
+	// "RSA4096", "EC256" or "EC384"; empty defaults to "EC256".
+	KeyType string
+
+	// CADirURL overrides the ACME directory URL; empty defaults to
+	// Let's Encrypt production (lego.LEDirectoryProduction).
+	CADirURL string
+
+	// CacheDir overrides where the account key and issued certificates
+	// are cached; empty defaults to DefaultCacheDir().
+	CacheDir string
+}
+
+// Manager owns one Config's ACME account, current certificate and
+// background renewal loop.
+type Manager struct {
+	cfg      Config
+	cacheDir string
+	logf     func(string)
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+
+	stopOnce sync.Once
+	stopCh   chan struct{}
+	wg       sync.WaitGroup
+}
+
+// DefaultCacheDir returns "%APPDATA%\ECHWorkersClient\acme", mirroring
+// config.NewManager's use of APPDATA for the main config file.
+func DefaultCacheDir() (string, error) {
+	appdata := os.Getenv("APPDATA")
+	if appdata == "" {
+		return "", errors.New("APPDATA is not set")
+	}
+	return filepath.Join(appdata, "ECHWorkersClient", "acme"), nil
+}
+
+// NewManager validates cfg and prepares the cache directory, but doesn't
+// talk to the CA yet; call Start for that.
+func NewManager(cfg Config, logf func(string)) (*Manager, error) {
+	if len(cfg.Domains) == 0 {
+		return nil, errors.New("acme: 至少需要一个域名")
+	}
+	if cfg.Challenge == "" {
+		cfg.Challenge = "http-01"
+	}
+	if cfg.KeyType == "" {
+		cfg.KeyType = "EC256"
+	}
+	if logf == nil {
+		logf = func(string) {}
+	}
+
+	cacheDir := cfg.CacheDir
+	if cacheDir == "" {
+		dir, err := DefaultCacheDir()
+		if err != nil {
+			return nil, err
+		}
+		cacheDir = dir
+	}
+	if err := os.MkdirAll(cacheDir, 0o755); err != nil {
+		return nil, fmt.Errorf("创建 ACME 缓存目录失败: %w", err)
+	}
+
+	return &Manager{
+		cfg:      cfg,
+		cacheDir: cacheDir,
+		logf:     logf,
+		stopCh:   make(chan struct{}),
+	}, nil
+}
+
+// Start loads a cached certificate if it's still valid past renewBefore,
+// otherwise obtains a new one synchronously, then launches the background
+// renewal loop. Callers plug GetCertificate into tls.Config.GetCertificate
+// once Start has returned successfully.
+func (m *Manager) Start() error {
+	if cert, err := m.loadCachedCert(); err == nil && !certNeedsRenewal(cert) {
+		m.mu.Lock()
+		m.cert = cert
+		m.mu.Unlock()
+		m.logf(fmt.Sprintf("[ACME] 使用缓存证书: %s", m.cfg.Domains[0]))
+	} else if err := m.obtainOrRenew(); err != nil {
+		return err
+	}
+
+	m.wg.Add(1)
+	go m.renewLoop()
+	return nil
+}
+
+// Close stops the background renewal loop. It does not revoke the
+// certificate or remove it from the cache.
+func (m *Manager) Close() {
+	m.stopOnce.Do(func() { close(m.stopCh) })
+	m.wg.Wait()
+}
+
+// GetCertificate implements the signature of tls.Config.GetCertificate,
+// returning the currently cached certificate regardless of
+// ClientHelloInfo.ServerName since a Manager only ever serves Domains[0..].
+func (m *Manager) GetCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.cert == nil {
+		return nil, errors.New("acme: 证书尚未就绪")
+	}
+	return m.cert, nil
+}
+
+func (m *Manager) renewLoop() {
+	defer m.wg.Done()
+	ticker := time.NewTicker(renewCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.stopCh:
+			return
+		case <-ticker.C:
+			m.mu.RLock()
+			cert := m.cert
+			m.mu.RUnlock()
+			if cert != nil && !certNeedsRenewal(cert) {
+				continue
+			}
+			if err := m.obtainOrRenew(); err != nil {
+				m.logf(fmt.Sprintf("[ACME] 续期证书失败: %v", err))
+			}
+		}
+	}
+}
+
+// certNeedsRenewal reports whether cert is within renewBefore of expiry.
+func certNeedsRenewal(cert *tls.Certificate) bool {
+	leaf := cert.Leaf
+	if leaf == nil {
+		parsed, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return true
+		}
+		leaf = parsed
+	}
+	return time.Until(leaf.NotAfter) < renewBefore
+}
+
+// acmeUser implements registration.User, backed by an account key cached
+// under cacheDir.
+type acmeUser struct {
+	email        string
+	registration *registration.Resource
+	key          crypto.PrivateKey
+}
+
+func (u *acmeUser) GetEmail() string                       { return u.email }
+func (u *acmeUser) GetRegistration() *registration.Resource { return u.registration }
+func (u *acmeUser) GetPrivateKey() crypto.PrivateKey        { return u.key }
+
+func (m *Manager) obtainOrRenew() error {
+	user, err := m.loadOrRegisterUser()
+	if err != nil {
+		return fmt.Errorf("加载/注册 ACME 账户失败: %w", err)
+	}
+
+	legoConfig := lego.NewConfig(user)
+	if m.cfg.CADirURL != "" {
+		legoConfig.CADirURL = m.cfg.CADirURL
+	}
+	legoConfig.Certificate.KeyType = keyType(m.cfg.KeyType)
+
+	client, err := lego.NewClient(legoConfig)
+	if err != nil {
+		return fmt.Errorf("创建 ACME 客户端失败: %w", err)
+	}
+
+	switch m.cfg.Challenge {
+	case "tls-alpn-01":
+		port := m.cfg.TLSALPNPort
+		provider := tlsalpn01.NewProviderServer("", portString(port, 443))
+		if err := client.Challenge.SetTLSALPN01Provider(provider); err != nil {
+			return err
+		}
+	case "dns-01":
+		provider, err := newDNSProvider(m.cfg.DNSProvider, m.cfg.DNSProviderCredentials)
+		if err != nil {
+			return err
+		}
+		if err := client.Challenge.SetDNS01Provider(provider); err != nil {
+			return err
+		}
+	default: // "http-01"
+		port := m.cfg.HTTPChallengePort
+		provider := http01.NewProviderServer("", portString(port, 80))
+		if err := client.Challenge.SetHTTP01Provider(provider); err != nil {
+			return err
+		}
+	}
+
+	if user.registration == nil {
+		reg, err := client.Registration.Register(registration.RegisterOptions{TermsOfServiceAgreed: true})
+		if err != nil {
+			return fmt.Errorf("向 CA 注册账户失败: %w", err)
+		}
+		user.registration = reg
+		if err := m.saveUser(user); err != nil {
+			m.logf(fmt.Sprintf("[ACME] 保存账户信息失败: %v", err))
+		}
+	}
+
+	result, err := client.Certificate.Obtain(certificate.ObtainRequest{
+		Domains: m.cfg.Domains,
+		Bundle:  true,
+	})
+	if err != nil {
+		return fmt.Errorf("签发证书失败: %w", err)
+	}
+
+	cert, err := tls.X509KeyPair(result.Certificate, result.PrivateKey)
+	if err != nil {
+		return fmt.Errorf("解析签发的证书失败: %w", err)
+	}
+	if leaf, err := x509.ParseCertificate(cert.Certificate[0]); err == nil {
+		cert.Leaf = leaf
+	}
+
+	if err := m.saveCert(result); err != nil {
+		m.logf(fmt.Sprintf("[ACME] 缓存证书失败: %v", err))
+	}
+
+	m.mu.Lock()
+	m.cert = &cert
+	m.mu.Unlock()
+	m.logf(fmt.Sprintf("[ACME] 证书已签发/续期: %s", m.cfg.Domains[0]))
+	return nil
+}
+
+func keyType(name string) certcrypto.KeyType {
+	switch name {
+	case "RSA2048":
+		return certcrypto.RSA2048
+	case "RSA4096":
+		return certcrypto.RSA4096
+	case "EC384":
+		return certcrypto.EC384
+	default:
+		return certcrypto.EC256
+	}
+}
+
+func portString(port, fallback int) string {
+	if port <= 0 {
+		port = fallback
+	}
+	return fmt.Sprintf("%d", port)
+}
+
+// --- account/cert cache ---
+
+func (m *Manager) accountKeyPath() string { return filepath.Join(m.cacheDir, "account.key") }
+func (m *Manager) accountMetaPath() string {
+	return filepath.Join(m.cacheDir, "account.json")
+}
+func (m *Manager) certPath(ext string) string {
+	return filepath.Join(m.cacheDir, m.cfg.Domains[0]+ext)
+}
+
+type accountMeta struct {
+	Email        string                 `json:"email"`
+	Registration *registration.Resource `json:"registration,omitempty"`
+}
+
+func (m *Manager) loadOrRegisterUser() (*acmeUser, error) {
+	keyBytes, err := os.ReadFile(m.accountKeyPath())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+		return m.newUser()
+	}
+
+	key, err := x509.ParseECPrivateKey(keyBytes)
+	if err != nil {
+		return nil, fmt.Errorf("解析 ACME 账户私钥失败: %w", err)
+	}
+
+	user := &acmeUser{email: m.cfg.Email, key: key}
+	if metaBytes, err := os.ReadFile(m.accountMetaPath()); err == nil {
+		var meta accountMeta
+		if err := json.Unmarshal(metaBytes, &meta); err == nil {
+			user.email = meta.Email
+			user.registration = meta.Registration
+		}
+	}
+	return user, nil
+}
+
+func (m *Manager) newUser() (*acmeUser, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	keyBytes, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(m.accountKeyPath(), keyBytes, 0o600); err != nil {
+		return nil, err
+	}
+	return &acmeUser{email: m.cfg.Email, key: key}, nil
+}
+
+func (m *Manager) saveUser(u *acmeUser) error {
+	meta := accountMeta{Email: u.email, Registration: u.registration}
+	b, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(m.accountMetaPath(), b, 0o644)
+}
+
+func (m *Manager) saveCert(res *certificate.Resource) error {
+	if err := os.WriteFile(m.certPath(".crt"), res.Certificate, 0o644); err != nil {
+		return err
+	}
+	return os.WriteFile(m.certPath(".key"), res.PrivateKey, 0o600)
+}
+
+func (m *Manager) loadCachedCert() (*tls.Certificate, error) {
+	certBytes, err := os.ReadFile(m.certPath(".crt"))
+	if err != nil {
+		return nil, err
+	}
+	keyBytes, err := os.ReadFile(m.certPath(".key"))
+	if err != nil {
+		return nil, err
+	}
+	cert, err := tls.X509KeyPair(certBytes, keyBytes)
+	if err != nil {
+		return nil, err
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+	cert.Leaf = leaf
+	return &cert, nil
+}
@@ -0,0 +1,42 @@
+package acme
+
+import (
+	"fmt"
+
+	"github.com/go-acme/lego/v4/challenge"
+	"github.com/go-acme/lego/v4/providers/dns/alidns"
+	"github.com/go-acme/lego/v4/providers/dns/cloudflare"
+	"github.com/go-acme/lego/v4/providers/dns/tencentcloud"
+)
+
+// newDNSProvider builds a lego DNS challenge.Provider for name from creds
+// (config.ACME.DNSProviderCredentials). The keys it reads are lowercase
+// names, not the providers' environment variable names: "api_token",
+// "email" and "api_key" for cloudflare; "access_key_id" and
+// "access_key_secret" for alidns; "secret_id" and "secret_key" for
+// tencentcloud.
+func newDNSProvider(name string, creds map[string]string) (challenge.Provider, error) {
+	switch name {
+	case "cloudflare":
+		cfg := cloudflare.NewDefaultConfig()
+		cfg.AuthToken = creds["api_token"]
+		cfg.AuthEmail = creds["email"]
+		cfg.AuthKey = creds["api_key"]
+		return cloudflare.NewDNSProviderConfig(cfg)
+
+	case "alidns":
+		cfg := alidns.NewDefaultConfig()
+		cfg.APIKey = creds["access_key_id"]
+		cfg.SecretKey = creds["access_key_secret"]
+		return alidns.NewDNSProviderConfig(cfg)
+
+	case "tencentcloud":
+		cfg := tencentcloud.NewDefaultConfig()
+		cfg.SecretID = creds["secret_id"]
+		cfg.SecretKey = creds["secret_key"]
+		return tencentcloud.NewDNSProviderConfig(cfg)
+
+	default:
+		return nil, fmt.Errorf("不支持的 DNS 提供商: %q", name)
+	}
+}
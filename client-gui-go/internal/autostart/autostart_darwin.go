@@ -4,6 +4,7 @@ package autostart
 
 import (
 	"os"
+	"os/exec"
 	"path/filepath"
 	"text/template"
 )
@@ -24,6 +25,26 @@ const plistTemplate = `<?xml version="1.0" encoding="UTF-8"?>
 </plist>
 `
 
+const daemonPlistTemplate = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key>
+	<string>com.juerson.echworkersclient.daemon</string>
+	<key>ProgramArguments</key>
+	<array>
+		<string>{{.ExePath}}</string>
+	</array>
+	<key>RunAtLoad</key>
+	<true/>
+	<key>KeepAlive</key>
+	<true/>
+</dict>
+</plist>
+`
+
+const daemonLabel = "com.juerson.echworkersclient.daemon"
+
 func getPlistPath() (string, error) {
 	home, err := os.UserHomeDir()
 	if err != nil {
@@ -32,7 +53,32 @@ func getPlistPath() (string, error) {
 	return filepath.Join(home, "Library", "LaunchAgents", "com.juerson.echworkersclient.plist"), nil
 }
 
-func Enable() error {
+func getDaemonPlistPath() string {
+	return filepath.Join("/Library/LaunchDaemons", daemonLabel+".plist")
+}
+
+func Enable(mode Mode) error {
+	if mode == ModeService {
+		return enableService()
+	}
+	return enableLoginItem()
+}
+
+func Disable(mode Mode) error {
+	if mode == ModeService {
+		return disableService()
+	}
+	return disableLoginItem()
+}
+
+func IsEnabled(mode Mode) (bool, error) {
+	if mode == ModeService {
+		return isServiceEnabled()
+	}
+	return isLoginItemEnabled()
+}
+
+func enableLoginItem() error {
 	exe, err := os.Executable()
 	if err != nil {
 		return err
@@ -57,7 +103,7 @@ func Enable() error {
 	return t.Execute(f, map[string]string{"ExePath": exe})
 }
 
-func Disable() error {
+func disableLoginItem() error {
 	plistPath, err := getPlistPath()
 	if err != nil {
 		return err
@@ -68,7 +114,7 @@ func Disable() error {
 	return nil
 }
 
-func IsEnabled() (bool, error) {
+func isLoginItemEnabled() (bool, error) {
 	plistPath, err := getPlistPath()
 	if err != nil {
 		return false, err
@@ -81,3 +127,52 @@ func IsEnabled() (bool, error) {
 	}
 	return true, nil
 }
+
+// enableService installs the running executable as a launchd
+// LaunchDaemon (vs. the per-user LaunchAgent used by ModeLoginItem), so
+// it starts at boot under root and keeps running after logout. Writing
+// to /Library/LaunchDaemons requires root; callers should expect
+// Enable(ModeService) to fail with a permission error when not elevated.
+func enableService() error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	exe, err = filepath.Abs(exe)
+	if err != nil {
+		return err
+	}
+
+	plistPath := getDaemonPlistPath()
+	f, err := os.Create(plistPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	t := template.Must(template.New("daemon-plist").Parse(daemonPlistTemplate))
+	if err := t.Execute(f, map[string]string{"ExePath": exe}); err != nil {
+		return err
+	}
+
+	return exec.Command("launchctl", "load", "-w", plistPath).Run()
+}
+
+func disableService() error {
+	plistPath := getDaemonPlistPath()
+	_ = exec.Command("launchctl", "unload", "-w", plistPath).Run()
+	if err := os.Remove(plistPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func isServiceEnabled() (bool, error) {
+	if _, err := os.Stat(getDaemonPlistPath()); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
@@ -1,10 +1,15 @@
 package config
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"time"
+
+	"github.com/juerson/ech-wk/client-gui-go/internal/subscription"
 )
 
 type LastState struct {
@@ -24,12 +29,243 @@ type Server struct {
 	DNS         string `json:"dns"`
 	ECH         string `json:"ech"`
 	RoutingMode string `json:"routing_mode"`
+
+	// SubscriptionID is set when this entry was created by fetching a
+	// subscription (see Subscription); such entries are read-only in
+	// the form and pruned automatically once they drop out of the
+	// subscription's content.
+	SubscriptionID string `json:"subscription_id,omitempty"`
+
+	// ACME configures automatic TLS certificate issuance/renewal for this
+	// server's embedded HTTPS listener or reverse-proxy front-end (see
+	// internal/acme). Empty Domains means ACME is off.
+	ACME ACME `json:"acme,omitempty"`
+
+	// ReverseRules exposes the embedded ECH tunnel as one or more
+	// HTTP(S) reverse-proxy front-ends (see internal/reverseproxy),
+	// independent of the SOCKS5/HTTP proxy listener configured by Listen.
+	ReverseRules []ReverseRule `json:"reverse_rules,omitempty"`
+
+	// Peers are LAN machines this server entry is commonly used
+	// alongside - e.g. a home NAS woken before connecting through the
+	// proxy and put back to sleep after (see internal/wol).
+	Peers []PeerDevice `json:"peers,omitempty"`
+}
+
+// PeerDevice is one Wake-on-LAN/remote-shutdown target (see
+// internal/wol.Wake/Shutdown). AgentEndpoint/AgentSecret are only
+// needed for Shutdown - Wake only needs MAC and Broadcast.
+type PeerDevice struct {
+	Name      string   `json:"name"`
+	MAC       string   `json:"mac"`
+	Broadcast []string `json:"broadcast,omitempty"`
+
+	// AgentEndpoint is the base URL of an ech-wk-agent instance running
+	// on this peer (e.g. "http://192.168.1.20:9090"); empty disables
+	// Shutdown for this peer. AgentSecret authenticates the request.
+	AgentEndpoint string `json:"agent_endpoint,omitempty"`
+	AgentSecret   string `json:"agent_secret,omitempty"`
+}
+
+// ReverseRule is one HTTP(S) reverse-proxy front-end, started alongside
+// the embedded proxy (see process.Runner.Start).
+type ReverseRule struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	ListenAddr string `json:"listen_addr"`
+
+	// TLS is either a static cert/key pair, or ACMEDomain naming one of
+	// this Server's ACME.Domains whose certificate should be served
+	// instead; both empty serves plain HTTP.
+	TLSCertFile string `json:"tls_cert_file,omitempty"`
+	TLSKeyFile  string `json:"tls_key_file,omitempty"`
+	ACMEDomain  string `json:"acme_domain,omitempty"`
+
+	// Routes maps a host/path-prefix match to one or more upstream URLs;
+	// more than one upstream enables load balancing per Balance.
+	Routes []ReverseRoute `json:"routes"`
+	// Balance selects how a route's multiple upstreams are picked
+	// between: "round_robin" (default) or "weighted".
+	Balance string `json:"balance,omitempty"`
+
+	AddRequestHeaders     map[string]string `json:"add_request_headers,omitempty"`
+	RemoveRequestHeaders  []string          `json:"remove_request_headers,omitempty"`
+	AddResponseHeaders    map[string]string `json:"add_response_headers,omitempty"`
+	RemoveResponseHeaders []string          `json:"remove_response_headers,omitempty"`
+
+	// CookieRewrites renames a cookie set by the upstream before it
+	// reaches the client, keyed by the upstream's cookie name.
+	CookieRewrites map[string]string `json:"cookie_rewrites,omitempty"`
+
+	// BasicAuthUser/Pass require HTTP Basic auth on every request when
+	// BasicAuthUser is non-empty.
+	BasicAuthUser string `json:"basic_auth_user,omitempty"`
+	BasicAuthPass string `json:"basic_auth_pass,omitempty"`
+
+	// Allow/Deny are CIDR lists in the same format as SysProxy's bypass
+	// list (see sysproxy.PACConfig.Bypass). Deny is checked first; a
+	// non-empty Allow then makes every other source implicitly denied.
+	Allow []string `json:"allow,omitempty"`
+	Deny  []string `json:"deny,omitempty"`
+}
+
+// ReverseRoute matches a request's host and path prefix to a set of
+// candidate upstreams.
+type ReverseRoute struct {
+	// Match is "host" or "host/path-prefix", e.g. "example.com" or
+	// "example.com/api".
+	Match     string            `json:"match"`
+	Upstreams []ReverseUpstream `json:"upstreams"`
+}
+
+// ReverseUpstream is one backend URL a route can forward to.
+type ReverseUpstream struct {
+	URL string `json:"url"`
+	// Weight is only consulted when the owning ReverseRule.Balance is
+	// "weighted"; <=0 is treated as 1.
+	Weight int `json:"weight,omitempty"`
+}
+
+// ACME holds the settings internal/acme.Manager needs to obtain and
+// auto-renew a certificate via github.com/go-acme/lego/v4. Domains being
+// empty means ACME is disabled for this server; every other field is
+// only consulted once Domains is non-empty.
+type ACME struct {
+	Domains []string `json:"domains,omitempty"`
+	Email   string   `json:"email,omitempty"`
+
+	// Challenge selects how ownership of Domains is proven: "http-01"
+	// (default), "tls-alpn-01" or "dns-01".
+	Challenge string `json:"challenge,omitempty"`
+
+	// HTTPChallengePort/TLSALPNPort are the local ports bound for
+	// "http-01"/"tls-alpn-01"; 0 falls back to lego's own defaults (80/443).
+	HTTPChallengePort int `json:"http_challenge_port,omitempty"`
+	TLSALPNPort       int `json:"tls_alpn_port,omitempty"`
+
+	// DNSProvider selects a lego DNS provider for "dns-01" ("cloudflare",
+	// "alidns" or "tencentcloud"); DNSProviderCredentials holds that
+	// provider's API credential fields (see internal/acme/providers.go).
+	DNSProvider            string            `json:"dns_provider,omitempty"`
+	DNSProviderCredentials map[string]string `json:"dns_provider_credentials,omitempty"`
+
+	// KeyType selects the certificate's private key algorithm: "RSA2048",
+	// "RSA4096", "EC256" or "EC384"; empty defaults to "EC256".
+	KeyType string `json:"key_type,omitempty"`
+}
+
+// ScheduleRule is a time-window rule driving automatic connect/disconnect.
+// Spec is a standard 5-field cron expression ("0 8 * * MON-FRI"); Action
+// is one of "start", "stop", "switch-to" (with TargetServerID set) or
+// "toggle-system-proxy".
+type ScheduleRule struct {
+	ID             string `json:"id"`
+	Name           string `json:"name"`
+	Spec           string `json:"spec"`
+	Action         string `json:"action"`
+	TargetServerID string `json:"target_server_id,omitempty"`
+	Enabled        bool   `json:"enabled"`
+}
+
+// Logging holds the rotating file sink's settings. Zero values mean
+// "use the sink's built-in defaults" (see internal/logsink.NewFileSink).
+// Disabled defaults to false (not Enabled defaulting to true) so that
+// configs saved before this field existed keep logging turned on.
+type Logging struct {
+	Disabled   bool   `json:"disabled,omitempty"`
+	Dir        string `json:"dir,omitempty"`
+	Format     string `json:"format,omitempty"` // "text" or "json"
+	MaxSizeMB  int    `json:"max_size_mb,omitempty"`
+	MaxAgeDays int    `json:"max_age_days,omitempty"`
+	MaxBackups int    `json:"max_backups,omitempty"`
+}
+
+// SysProxy holds how the "系统代理" checkbox configures the OS: a
+// blanket global proxy (see sysproxy.Set) or a generated PAC script
+// (see sysproxy.PACServer/SetPAC). Bypass is only consulted in PAC
+// mode; the global mode's bypass list is fixed to "<local>".
+type SysProxy struct {
+	Mode   string   `json:"mode,omitempty"` // "global" (default) or "pac"
+	Bypass []string `json:"bypass,omitempty"`
+}
+
+// Supervisor holds auto-restart settings for the external-mode proxy
+// child. When Enabled, an unexpected exit is respawned after an
+// exponentially growing backoff (see process.Runner.SetAutoRestart)
+// instead of just being reported via onProcessExit.
+type Supervisor struct {
+	Enabled       bool `json:"enabled"`
+	MaxBackoffSec int  `json:"max_backoff_sec,omitempty"`
+	HealthySec    int  `json:"healthy_sec,omitempty"`
+}
+
+// RemoteControl holds the optional HTTP+WebSocket control API's
+// settings. It is off by default; BindAddr/Token are only meaningful
+// once Enabled is true.
+type RemoteControl struct {
+	Enabled  bool   `json:"enabled"`
+	BindAddr string `json:"bind_addr,omitempty"`
+	Token    string `json:"token,omitempty"`
+}
+
+// NotifyChannel holds one notification adapter's settings. Only the
+// fields relevant to Kind ("desktop", "webhook", "telegram", "bark",
+// "serverchan", "smtp") are used; the rest are ignored.
+type NotifyChannel struct {
+	Kind    string `json:"kind"`
+	Enabled bool   `json:"enabled"`
+
+	// MutedEvents lists notify.Event.Type values this channel should
+	// silently drop (e.g. "log-warn"), independent of the manager's
+	// global per-event-type rate limiter.
+	MutedEvents []string `json:"muted_events,omitempty"`
+
+	WebhookURL string `json:"webhook_url,omitempty"`
+
+	TelegramBotToken string `json:"telegram_bot_token,omitempty"`
+	TelegramChatID   string `json:"telegram_chat_id,omitempty"`
+
+	BarkServerURL string `json:"bark_server_url,omitempty"` // empty uses the public api.day.app
+	BarkKey       string `json:"bark_key,omitempty"`
+
+	ServerChanKey string `json:"serverchan_key,omitempty"`
+
+	SMTPHost string   `json:"smtp_host,omitempty"`
+	SMTPPort int      `json:"smtp_port,omitempty"`
+	SMTPUser string   `json:"smtp_user,omitempty"`
+	SMTPPass string   `json:"smtp_pass,omitempty"`
+	SMTPFrom string   `json:"smtp_from,omitempty"`
+	SMTPTo   []string `json:"smtp_to,omitempty"`
+}
+
+// Notify holds the pluggable notification subsystem's settings.
+type Notify struct {
+	Channels       []NotifyChannel `json:"channels,omitempty"`
+	MinIntervalSec int             `json:"min_interval_sec,omitempty"` // 0 = use built-in default
+}
+
+// Subscription is a remote URL that supplies a bulk list of servers
+// (see internal/subscription), fetched on demand or on a periodic
+// interval via the cron scheduler.
+type Subscription struct {
+	ID              string `json:"id"`
+	Name            string `json:"name"`
+	URL             string `json:"url"`
+	IntervalMinutes int    `json:"interval_minutes,omitempty"` // 0 = manual fetch only
+	LastFetchedUnix int64  `json:"last_fetched_unix,omitempty"`
 }
 
 type FileModel struct {
-	Servers         []Server  `json:"servers"`
-	CurrentServerID string    `json:"current_server_id"`
-	LastState       LastState `json:"last_state"`
+	Servers         []Server       `json:"servers"`
+	CurrentServerID string         `json:"current_server_id"`
+	LastState       LastState      `json:"last_state"`
+	Rules           []ScheduleRule `json:"rules,omitempty"`
+	Logging         Logging        `json:"logging,omitempty"`
+	RemoteControl   RemoteControl  `json:"remote_control,omitempty"`
+	Notify          Notify         `json:"notify,omitempty"`
+	Subscriptions   []Subscription `json:"subscriptions,omitempty"`
+	Supervisor      Supervisor     `json:"supervisor,omitempty"`
+	SysProxy        SysProxy       `json:"sys_proxy,omitempty"`
 }
 
 type Manager struct {
@@ -125,3 +361,150 @@ func (m *Manager) DeleteServer(id string) {
 		}
 	}
 }
+
+func (m *Manager) UpsertRule(r ScheduleRule) {
+	for i := range m.Model.Rules {
+		if m.Model.Rules[i].ID == r.ID {
+			m.Model.Rules[i] = r
+			return
+		}
+	}
+	m.Model.Rules = append(m.Model.Rules, r)
+}
+
+func (m *Manager) DeleteRule(id string) {
+	out := make([]ScheduleRule, 0, len(m.Model.Rules))
+	for _, r := range m.Model.Rules {
+		if r.ID != id {
+			out = append(out, r)
+		}
+	}
+	m.Model.Rules = out
+}
+
+func (m *Manager) UpsertSubscription(s Subscription) {
+	for i := range m.Model.Subscriptions {
+		if m.Model.Subscriptions[i].ID == s.ID {
+			m.Model.Subscriptions[i] = s
+			return
+		}
+	}
+	m.Model.Subscriptions = append(m.Model.Subscriptions, s)
+}
+
+// DeleteSubscription removes the subscription and every server entry it
+// owns.
+func (m *Manager) DeleteSubscription(id string) {
+	out := make([]Subscription, 0, len(m.Model.Subscriptions))
+	for _, s := range m.Model.Subscriptions {
+		if s.ID != id {
+			out = append(out, s)
+		}
+	}
+	m.Model.Subscriptions = out
+
+	servers := make([]Server, 0, len(m.Model.Servers))
+	for _, s := range m.Model.Servers {
+		if s.SubscriptionID != id {
+			servers = append(servers, s)
+		}
+	}
+	m.Model.Servers = servers
+}
+
+// RefreshSubscriptions fetches every configured Subscription and merges
+// its entries into Model.Servers via UpsertServer, pruning any
+// subscription-owned server no longer present in the fetched content.
+// It's the config-layer equivalent of internal/ui's own fetchSubscription,
+// usable without a running UI; it does not call Save, same as every
+// other Model-mutating method here.
+func (m *Manager) RefreshSubscriptions(ctx context.Context) error {
+	var firstErr error
+	for i := range m.Model.Subscriptions {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := m.refreshSubscription(&m.Model.Subscriptions[i]); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// refreshSubscription fetches sub.URL and merges it into Model.Servers,
+// matching internal/ui.fetchSubscription's dedup/prune logic.
+func (m *Manager) refreshSubscription(sub *Subscription) error {
+	entries, err := subscription.Fetch(sub.URL)
+	if err != nil {
+		return fmt.Errorf("拉取订阅 %s 失败: %w", sub.Name, err)
+	}
+
+	seen := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		id := subscription.StableID(e.Server, e.Token, e.ECH)
+		seen[id] = true
+		m.UpsertServer(Server{
+			ID:             id,
+			Name:           e.Name,
+			Server:         e.Server,
+			Listen:         e.Listen,
+			Token:          e.Token,
+			IP:             e.IP,
+			DNS:            e.DNS,
+			ECH:            e.ECH,
+			RoutingMode:    e.RoutingMode,
+			SubscriptionID: sub.ID,
+		})
+	}
+
+	kept := make([]Server, 0, len(m.Model.Servers))
+	for _, s := range m.Model.Servers {
+		if s.SubscriptionID == sub.ID && !seen[s.ID] {
+			continue
+		}
+		kept = append(kept, s)
+	}
+	m.Model.Servers = kept
+	sub.LastFetchedUnix = time.Now().Unix()
+	return nil
+}
+
+// StartSubscriptionTicker launches a background goroutine that checks
+// once a minute for any Subscription whose IntervalMinutes has elapsed
+// since LastFetchedUnix and refreshes it; IntervalMinutes <= 0 means
+// manual-fetch-only and is never picked up here. Call the returned stop
+// func to end it.
+//
+// internal/ui drives its own subscription fetches off a cron rule
+// instead (see subscriptionRuleID) - this ticker is for callers with no
+// UI/scheduler of their own and is not started by MainWindow, so using
+// both together on the same Manager would double-fetch.
+func (m *Manager) StartSubscriptionTicker(onErr func(error)) (stop func()) {
+	ticker := time.NewTicker(time.Minute)
+	done := make(chan struct{})
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				now := time.Now()
+				for i := range m.Model.Subscriptions {
+					sub := &m.Model.Subscriptions[i]
+					if sub.IntervalMinutes <= 0 {
+						continue
+					}
+					due := time.Unix(sub.LastFetchedUnix, 0).Add(time.Duration(sub.IntervalMinutes) * time.Minute)
+					if sub.LastFetchedUnix != 0 && now.Before(due) {
+						continue
+					}
+					if err := m.refreshSubscription(sub); err != nil && onErr != nil {
+						onErr(err)
+					}
+				}
+			}
+		}
+	}()
+	return func() { close(done) }
+}
@@ -1,18 +1,33 @@
 package process
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
 	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
 
 	"github.com/juerson/ech-wk/client-gui-go/core"
+	"github.com/juerson/ech-wk/client-gui-go/internal/config"
 )
 
+// configReloadDebounce absorbs the burst of Create/Write/Rename events a
+// single editor save produces when it does an atomic replace-and-rename.
+const configReloadDebounce = 200 * time.Millisecond
+
 // EmbeddedRunner 内嵌代理运行器
 type EmbeddedRunner struct {
 	mu          sync.Mutex
 	server      *core.ProxyServer
 	isRunning   bool
 	logCallback func(string)
+	lastConfig  Config
+
+	watcher *fsnotify.Watcher
 }
 
 // NewEmbeddedRunner 创建新的内嵌运行器
@@ -58,6 +73,8 @@ func (r *EmbeddedRunner) Start(c Config, onLog func(string)) error {
 	}
 
 	r.isRunning = true
+	r.lastConfig = c
+	r.logCallback = onLog
 	onLog("[系统] 内嵌代理服务器已启动\n")
 	return nil
 }
@@ -79,3 +96,162 @@ func (r *EmbeddedRunner) Stop() {
 		r.logCallback("[系统] 内嵌代理服务器已停止\n")
 	}
 }
+
+// WatchConfig starts watching the config file at path and hot-reloads the
+// running proxy whenever it changes: fields that don't need a restart
+// (routing mode, DNS, ECH domain, token) are hot-swapped via setters on
+// core.ProxyServer, while a changed listen address or upstream server
+// falls back to Stop+Start. It watches the file's parent directory
+// rather than the file itself, since fsnotify can't follow a watch
+// across the delete-and-recreate many editors do on save; Rename events
+// re-arm the watch once the file reappears.
+func (r *EmbeddedRunner) WatchConfig(path string) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("创建配置监视器失败: %w", err)
+	}
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		watcher.Close()
+		return fmt.Errorf("监视配置目录失败: %w", err)
+	}
+
+	r.mu.Lock()
+	if r.watcher != nil {
+		r.watcher.Close()
+	}
+	r.watcher = watcher
+	r.mu.Unlock()
+
+	go r.watchConfigLoop(watcher, path)
+	return nil
+}
+
+// CloseWatch stops a previously started WatchConfig, if any.
+func (r *EmbeddedRunner) CloseWatch() error {
+	r.mu.Lock()
+	w := r.watcher
+	r.watcher = nil
+	r.mu.Unlock()
+
+	if w == nil {
+		return nil
+	}
+	return w.Close()
+}
+
+func (r *EmbeddedRunner) watchConfigLoop(watcher *fsnotify.Watcher, path string) {
+	target := filepath.Clean(path)
+	var debounce *time.Timer
+
+	for {
+		select {
+		case ev, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if filepath.Clean(ev.Name) != target {
+				continue
+			}
+			if ev.Op&(fsnotify.Create|fsnotify.Write|fsnotify.Rename) == 0 {
+				continue
+			}
+			if ev.Op&fsnotify.Rename != 0 {
+				_ = watcher.Add(filepath.Dir(path))
+			}
+			if debounce != nil {
+				debounce.Stop()
+			}
+			debounce = time.AfterFunc(configReloadDebounce, func() {
+				r.reloadConfig(path)
+			})
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			r.mu.Lock()
+			onLog := r.logCallback
+			r.mu.Unlock()
+			if onLog != nil {
+				onLog(fmt.Sprintf("[系统] 配置监视器错误: %v\n", err))
+			}
+		}
+	}
+}
+
+func (r *EmbeddedRunner) reloadConfig(path string) {
+	r.mu.Lock()
+	running := r.isRunning
+	server := r.server
+	last := r.lastConfig
+	onLog := r.logCallback
+	r.mu.Unlock()
+
+	if !running || server == nil {
+		return
+	}
+
+	next, err := loadCurrentServerConfig(path)
+	if err != nil {
+		if onLog != nil {
+			onLog(fmt.Sprintf("[系统] 重载配置失败: %v\n", err))
+		}
+		return
+	}
+
+	if next.Listen != last.Listen || next.Server != last.Server || next.IP != last.IP {
+		if onLog != nil {
+			onLog("[系统] 监听端口变化,重启代理\n")
+		}
+		r.Stop()
+		_ = r.Start(next, onLog)
+		return
+	}
+
+	server.SetRoutingMode(next.RoutingMode)
+	server.SetDNSServer(next.DNS)
+	server.SetECHDomain(next.ECH)
+	server.SetToken(next.Token)
+
+	r.mu.Lock()
+	r.lastConfig = next
+	r.mu.Unlock()
+
+	if onLog != nil {
+		onLog("[系统] 配置已重载\n")
+	}
+}
+
+// loadCurrentServerConfig reads path as a config.FileModel and returns
+// the currently selected server converted to a process.Config, mirroring
+// config.Manager.GetCurrentServer's fallback to the first entry.
+func loadCurrentServerConfig(path string) (Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+	var model config.FileModel
+	if err := json.Unmarshal(b, &model); err != nil {
+		return Config{}, err
+	}
+	if len(model.Servers) == 0 {
+		return Config{}, errors.New("配置文件中没有服务器")
+	}
+
+	chosen := model.Servers[0]
+	for _, s := range model.Servers {
+		if s.ID == model.CurrentServerID {
+			chosen = s
+			break
+		}
+	}
+
+	return Config{
+		Server:      chosen.Server,
+		Listen:      chosen.Listen,
+		Token:       chosen.Token,
+		IP:          chosen.IP,
+		DNS:         chosen.DNS,
+		ECH:         chosen.ECH,
+		RoutingMode: chosen.RoutingMode,
+	}, nil
+}
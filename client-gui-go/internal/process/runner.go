@@ -3,6 +3,7 @@ package process
 import (
 	"bufio"
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
@@ -10,6 +11,17 @@ import (
 	"os/exec"
 	"path/filepath"
 	"sync"
+	"time"
+
+	"github.com/juerson/ech-wk/client-gui-go/internal/acme"
+	"github.com/juerson/ech-wk/client-gui-go/internal/config"
+	"github.com/juerson/ech-wk/client-gui-go/internal/reverseproxy"
+)
+
+const (
+	defaultRestartBackoff = time.Second
+	defaultMaxBackoff     = 5 * time.Minute
+	defaultHealthyAfter   = 5 * time.Minute
 )
 
 type RunnerMode int
@@ -28,6 +40,18 @@ type Config struct {
 	ECH         string
 	RoutingMode string
 	Mode        RunnerMode // 运行模式
+
+	// ACME configures automatic TLS certificate issuance/renewal for the
+	// embedded server's HTTPS listener or reverse-proxy front-end (see
+	// internal/acme); zero value (empty Domains) leaves it off. Only
+	// consulted for ModeEmbedded - ModeExternal's child binary has no
+	// ACME support of its own to wire this into.
+	ACME config.ACME
+
+	// ReverseRules starts one internal/reverseproxy.Server per entry
+	// alongside the embedded proxy; empty leaves reverse-proxying off.
+	// Only consulted for ModeEmbedded, same reasoning as ACME.
+	ReverseRules []config.ReverseRule
 }
 
 type Runner struct {
@@ -38,6 +62,101 @@ type Runner struct {
 
 	// 内嵌模式
 	embedded *EmbeddedRunner
+
+	stopRequested bool
+	onExit        func()
+	onCrash       func(crashCount int, reason string)
+
+	// Auto-restart (ModeExternal only): on an unexpected exit the child
+	// is respawned after an exponentially growing backoff, capped at
+	// maxBackoff and reset once the process has stayed up for
+	// healthyAfter. lastConfig/lastOnLog are the arguments of the Start
+	// call being supervised, reused for every respawn.
+	autoRestart  bool
+	maxBackoff   time.Duration
+	healthyAfter time.Duration
+	backoff      time.Duration
+	crashCount   int
+	lastReason   string
+	lastConfig   Config
+	lastOnLog    func(string)
+	healthyTimer *time.Timer
+	restartTimer *time.Timer
+
+	// exited is closed by the Wait goroutine right before it returns,
+	// letting Stop wait for a graceful exit before escalating to Kill.
+	exited chan struct{}
+
+	// acmeMgr is non-nil once Start has launched ACME certificate
+	// issuance/renewal for a ModeEmbedded run with Config.ACME set (see
+	// internal/acme). GetCertificate exposes it to HTTPS listeners.
+	acmeMgr *acme.Manager
+
+	// reverseServers holds the reverse-proxy front-ends launched for a
+	// ModeEmbedded run's Config.ReverseRules (see internal/reverseproxy).
+	reverseServers []*reverseproxy.Server
+}
+
+// gracefulStopTimeout is how long Stop waits for the child to exit on
+// its own after an interrupt before it escalates to Kill.
+const gracefulStopTimeout = 5 * time.Second
+
+// SetOnExit registers a callback fired when the external-mode child
+// process exits without a preceding Stop() call (i.e. it crashed or was
+// killed externally). Embedded mode has no such async exit path, so
+// onExit is only ever invoked for ModeExternal.
+func (r *Runner) SetOnExit(fn func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onExit = fn
+}
+
+// SetOnCrash registers a callback fired on every unexpected exit,
+// including ones that auto-restart recovers from - unlike onExit,
+// which only fires once the child is considered finally down (no
+// restart scheduled, or the restart attempt itself failed to launch).
+// Use it to surface crash counts/last-exit reason in the UI without
+// tearing down running state on a transient crash.
+func (r *Runner) SetOnCrash(fn func(crashCount int, reason string)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onCrash = fn
+}
+
+// SetAutoRestart enables or disables crash auto-restart for
+// ModeExternal. maxBackoff/healthyAfter of zero fall back to sane
+// defaults (5 min cap, 5 min healthy-reset window).
+func (r *Runner) SetAutoRestart(enabled bool, maxBackoff, healthyAfter time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.autoRestart = enabled
+	if maxBackoff <= 0 {
+		maxBackoff = defaultMaxBackoff
+	}
+	if healthyAfter <= 0 {
+		healthyAfter = defaultHealthyAfter
+	}
+	r.maxBackoff = maxBackoff
+	r.healthyAfter = healthyAfter
+	if !enabled && r.restartTimer != nil {
+		r.restartTimer.Stop()
+	}
+}
+
+// CrashCount reports how many unexpected exits have occurred since the
+// backoff was last reset by a healthy run.
+func (r *Runner) CrashCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.crashCount
+}
+
+// LastExitReason describes the most recent unexpected exit, or "" if
+// none has happened yet.
+func (r *Runner) LastExitReason() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.lastReason
 }
 
 func NewRunner() *Runner {
@@ -46,6 +165,101 @@ func NewRunner() *Runner {
 	}
 }
 
+// GetCertificate implements the signature of tls.Config.GetCertificate,
+// delegating to the ACME manager started alongside the current run, if
+// any. It's meant to be plugged straight into a future HTTPS listener's
+// or reverse-proxy front-end's tls.Config.GetCertificate.
+func (r *Runner) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	mgr := r.acmeMgr
+	r.mu.Unlock()
+	if mgr == nil {
+		return nil, errors.New("ACME 未启用")
+	}
+	return mgr.GetCertificate(hello)
+}
+
+// startACME launches the ACME manager for c.ACME, if it has any domains
+// configured; a no-op otherwise. Caller must hold r.mu.
+func (r *Runner) startACME(c Config, onLog func(string)) {
+	if len(c.ACME.Domains) == 0 {
+		return
+	}
+	mgr, err := acme.NewManager(acme.Config{
+		Domains:                c.ACME.Domains,
+		Email:                  c.ACME.Email,
+		Challenge:              c.ACME.Challenge,
+		HTTPChallengePort:      c.ACME.HTTPChallengePort,
+		TLSALPNPort:            c.ACME.TLSALPNPort,
+		DNSProvider:            c.ACME.DNSProvider,
+		DNSProviderCredentials: c.ACME.DNSProviderCredentials,
+		KeyType:                c.ACME.KeyType,
+	}, onLog)
+	if err != nil {
+		onLog(fmt.Sprintf("[ACME] 初始化失败: %v\n", err))
+		return
+	}
+	if err := mgr.Start(); err != nil {
+		onLog(fmt.Sprintf("[ACME] 签发证书失败: %v\n", err))
+		return
+	}
+	r.acmeMgr = mgr
+}
+
+// startReverseProxies launches one internal/reverseproxy.Server per entry
+// in c.ReverseRules; a rule that fails to start is logged and skipped
+// rather than aborting the rest. Caller must hold r.mu.
+func (r *Runner) startReverseProxies(c Config, onLog func(string)) {
+	for _, rule := range c.ReverseRules {
+		routes := make([]reverseproxy.Route, 0, len(rule.Routes))
+		for _, route := range rule.Routes {
+			upstreams := make([]reverseproxy.Upstream, 0, len(route.Upstreams))
+			for _, u := range route.Upstreams {
+				upstreams = append(upstreams, reverseproxy.Upstream{URL: u.URL, Weight: u.Weight})
+			}
+			routes = append(routes, reverseproxy.Route{Match: route.Match, Upstreams: upstreams})
+		}
+
+		rpCfg := reverseproxy.Config{
+			ListenAddr:            rule.ListenAddr,
+			TLSCertFile:           rule.TLSCertFile,
+			TLSKeyFile:            rule.TLSKeyFile,
+			Routes:                routes,
+			Balance:               rule.Balance,
+			AddRequestHeaders:     rule.AddRequestHeaders,
+			RemoveRequestHeaders:  rule.RemoveRequestHeaders,
+			AddResponseHeaders:    rule.AddResponseHeaders,
+			RemoveResponseHeaders: rule.RemoveResponseHeaders,
+			CookieRewrites:        rule.CookieRewrites,
+			BasicAuthUser:         rule.BasicAuthUser,
+			BasicAuthPass:         rule.BasicAuthPass,
+			Allow:                 rule.Allow,
+			Deny:                  rule.Deny,
+		}
+		if rule.ACMEDomain != "" {
+			rpCfg.GetCertificate = r.GetCertificate
+		}
+
+		srv, err := reverseproxy.NewServer(rpCfg, onLog)
+		if err != nil {
+			onLog(fmt.Sprintf("[反向代理] %s 配置有误: %v\n", rule.Name, err))
+			continue
+		}
+		if err := srv.Start(); err != nil {
+			onLog(fmt.Sprintf("[反向代理] %s 启动失败: %v\n", rule.Name, err))
+			continue
+		}
+		r.reverseServers = append(r.reverseServers, srv)
+	}
+}
+
+// WatchConfig hot-reloads the embedded-mode proxy when the config file at
+// path changes; it has no effect in ModeExternal, where the child process
+// reads its own config independently. See EmbeddedRunner.WatchConfig.
+func (r *Runner) WatchConfig(path string) error {
+	return r.embedded.WatchConfig(path)
+}
+
 func (r *Runner) IsRunning() bool {
 	r.mu.Lock()
 	defer r.mu.Unlock()
@@ -103,6 +317,7 @@ func (r *Runner) Start(c Config, onLog func(string)) error {
 
 	// 设置模式
 	r.mode = c.Mode
+	r.stopRequested = false
 
 	switch r.mode {
 	case ModeEmbedded:
@@ -110,12 +325,20 @@ func (r *Runner) Start(c Config, onLog func(string)) error {
 		if r.embedded.IsRunning() {
 			return errors.New("embedded server is already running")
 		}
-		return r.embedded.Start(c, onLog)
+		if err := r.embedded.Start(c, onLog); err != nil {
+			return err
+		}
+		r.startACME(c, onLog)
+		r.startReverseProxies(c, onLog)
+		return nil
 	default:
 		// 外部进程模式（原有逻辑）
 		if r.cmd != nil {
 			return errors.New("process already running")
 		}
+		r.lastConfig = c
+		r.lastOnLog = onLog
+
 		exe, err := FindEchWorkersExe()
 		if err != nil {
 			return err
@@ -140,26 +363,103 @@ func (r *Runner) Start(c Config, onLog func(string)) error {
 			return err
 		}
 		r.cmd = cmd
+		exited := make(chan struct{})
+		r.exited = exited
+
+		if r.healthyTimer != nil {
+			r.healthyTimer.Stop()
+		}
+		r.healthyTimer = time.AfterFunc(r.healthyAfterOrDefault(), func() {
+			r.mu.Lock()
+			r.crashCount = 0
+			r.backoff = 0
+			r.mu.Unlock()
+		})
 
 		go streamLines(stdout, onLog)
 		go streamLines(stderr, onLog)
 
 		go func() {
 			_ = cmd.Wait()
+			close(exited)
 			r.mu.Lock()
 			r.cmd = nil
 			if r.cancel != nil {
 				r.cancel()
 				r.cancel = nil
 			}
+			if r.healthyTimer != nil {
+				r.healthyTimer.Stop()
+			}
+			unexpected := !r.stopRequested
+			onExit := r.onExit
+			onCrash := r.onCrash
+			var restartIn time.Duration
+			if unexpected {
+				r.crashCount++
+				r.lastReason = "进程意外退出"
+				if r.autoRestart {
+					restartIn = r.nextBackoffLocked()
+				}
+			}
+			crashCount, reason := r.crashCount, r.lastReason
+			cfg, restartLog := r.lastConfig, r.lastOnLog
 			r.mu.Unlock()
+
 			onLog("[系统] 进程已停止。\n")
+			if unexpected {
+				if onCrash != nil {
+					onCrash(crashCount, reason)
+				}
+				if restartIn <= 0 && onExit != nil {
+					onExit()
+				}
+			}
+			if restartIn > 0 {
+				onLog(fmt.Sprintf("[系统] 将在 %s 后自动重启代理进程（第 %d 次）\n", restartIn, crashCount))
+				r.restartTimer = time.AfterFunc(restartIn, func() {
+					if err := r.Start(cfg, restartLog); err != nil {
+						restartLog(fmt.Sprintf("[错误] 自动重启失败: %v\n", err))
+						r.mu.Lock()
+						finalOnExit := r.onExit
+						r.mu.Unlock()
+						if finalOnExit != nil {
+							finalOnExit()
+						}
+					}
+				})
+			}
 		}()
 
 		return nil
 	}
 }
 
+// nextBackoffLocked advances and returns the respawn delay for the
+// current crash streak; caller must hold r.mu.
+func (r *Runner) nextBackoffLocked() time.Duration {
+	if r.backoff <= 0 {
+		r.backoff = defaultRestartBackoff
+	} else {
+		r.backoff *= 2
+	}
+	maxDelay := r.maxBackoff
+	if maxDelay <= 0 {
+		maxDelay = defaultMaxBackoff
+	}
+	if r.backoff > maxDelay {
+		r.backoff = maxDelay
+	}
+	return r.backoff
+}
+
+func (r *Runner) healthyAfterOrDefault() time.Duration {
+	if r.healthyAfter <= 0 {
+		return defaultHealthyAfter
+	}
+	return r.healthyAfter
+}
+
 func streamLines(rc io.ReadCloser, onLog func(string)) {
 	scanner := bufio.NewScanner(rc)
 	buf := make([]byte, 0, 64*1024)
@@ -169,21 +469,57 @@ func streamLines(rc io.ReadCloser, onLog func(string)) {
 	}
 }
 
+// Stop requests a shutdown. For ModeExternal it first asks the child to
+// exit gracefully (os.Interrupt) and gives it gracefulStopTimeout to do
+// so before escalating to Kill; on Windows, where os.Interrupt isn't
+// supported, this falls straight through to Kill.
 func (r *Runner) Stop() {
 	r.mu.Lock()
-	defer r.mu.Unlock()
+	r.stopRequested = true
+	if r.restartTimer != nil {
+		r.restartTimer.Stop()
+	}
+	mode := r.mode
+	cmd := r.cmd
+	exited := r.exited
+	acmeMgr := r.acmeMgr
+	r.acmeMgr = nil
+	reverseServers := r.reverseServers
+	r.reverseServers = nil
+	r.mu.Unlock()
 
-	switch r.mode {
-	case ModeEmbedded:
-		// 内嵌模式
+	if acmeMgr != nil {
+		acmeMgr.Close()
+	}
+	for _, srv := range reverseServers {
+		srv.Stop()
+	}
+
+	if mode == ModeEmbedded {
 		r.embedded.Stop()
-	default:
-		// 外部进程模式
-		if r.cancel != nil {
-			r.cancel()
-		}
-		if r.cmd != nil && r.cmd.Process != nil {
-			_ = r.cmd.Process.Kill()
+		return
+	}
+
+	if cmd == nil || cmd.Process == nil {
+		return
+	}
+	if err := cmd.Process.Signal(os.Interrupt); err != nil {
+		// Platform doesn't support a graceful interrupt (e.g. Windows) -
+		// go straight to Kill instead of waiting out the timeout for an
+		// exit that will never come on its own.
+		_ = cmd.Process.Kill()
+	} else {
+		select {
+		case <-exited:
+		case <-time.After(gracefulStopTimeout):
+			_ = cmd.Process.Kill()
 		}
 	}
+
+	r.mu.Lock()
+	if r.cancel != nil {
+		r.cancel()
+		r.cancel = nil
+	}
+	r.mu.Unlock()
 }
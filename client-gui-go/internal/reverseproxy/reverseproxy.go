@@ -0,0 +1,400 @@
+// Package reverseproxy exposes the embedded ECH tunnel as one or more
+// HTTP(S) reverse-proxy front-ends, built on net/http/httputil.ReverseProxy
+// with a custom Director/ModifyResponse. It has no dependency on
+// core.ProxyServer - each Server just forwards to whatever upstream URLs
+// its Config names, which may or may not themselves be reached through
+// the ECH tunnel depending on how the caller configured those upstreams.
+package reverseproxy
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Upstream is one backend URL a Route can forward to.
+type Upstream struct {
+	URL string
+	// Weight is only consulted when the owning Config.Balance is
+	// "weighted"; <=0 is treated as 1.
+	Weight int
+}
+
+// Route matches a request's host and path prefix to a set of candidate
+// upstreams.
+type Route struct {
+	// Match is "host" or "host/path-prefix", e.g. "example.com" or
+	// "example.com/api".
+	Match     string
+	Upstreams []Upstream
+}
+
+// Config carries config.ReverseRule's listener, TLS, routing, header,
+// cookie, auth and allow/deny fields under the same names so callers can
+// build it directly from the saved config. It has no ID or Name, and takes
+// a GetCertificate callback in place of ReverseRule.ACMEDomain.
+type Config struct {
+	ListenAddr string
+
+	// TLSCertFile/TLSKeyFile serve a static certificate; GetCertificate
+	// (set by process.Runner for an ACMEDomain rule) takes priority when
+	// both are present. Neither set means plain HTTP.
+	TLSCertFile    string
+	TLSKeyFile     string
+	GetCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)
+
+	Routes  []Route
+	Balance string // "round_robin" (default) or "weighted"
+
+	AddRequestHeaders     map[string]string
+	RemoveRequestHeaders  []string
+	AddResponseHeaders    map[string]string
+	RemoveResponseHeaders []string
+
+	// CookieRewrites renames a cookie set by the upstream before it
+	// reaches the client, keyed by the upstream's cookie name.
+	CookieRewrites map[string]string
+
+	BasicAuthUser string
+	BasicAuthPass string
+
+	// Allow/Deny are CIDRs in the same format as sysproxy.PACConfig.Bypass.
+	// Deny is checked first; a non-empty Allow then makes every other
+	// source implicitly denied.
+	Allow []string
+	Deny  []string
+}
+
+// Server is one running reverse-proxy front-end.
+type Server struct {
+	cfg   Config
+	onLog func(string)
+
+	srv *http.Server
+	ln  net.Listener
+
+	routes []compiledRoute
+	allow  []*net.IPNet
+	deny   []*net.IPNet
+}
+
+type compiledRoute struct {
+	host string // "" matches any host
+	path string // "" matches any path; otherwise a prefix, always starting with "/"
+	lb   *loadBalancer
+}
+
+// NewServer compiles cfg's routes and CIDR lists; call Start to bind and
+// begin serving. onLog receives one line per request (access log) plus
+// any listener-level errors, matching the onLog callback convention used
+// by process.Runner/core.ProxyServer.
+func NewServer(cfg Config, onLog func(string)) (*Server, error) {
+	if cfg.ListenAddr == "" {
+		return nil, fmt.Errorf("reverseproxy: 未配置监听地址")
+	}
+	if onLog == nil {
+		onLog = func(string) {}
+	}
+
+	s := &Server{cfg: cfg, onLog: onLog}
+
+	for _, r := range cfg.Routes {
+		route, err := compileRoute(r, cfg.Balance)
+		if err != nil {
+			return nil, err
+		}
+		s.routes = append(s.routes, route)
+	}
+	if len(s.routes) == 0 {
+		return nil, fmt.Errorf("reverseproxy: 未配置任何路由")
+	}
+
+	var err error
+	if s.allow, err = compileCIDRs(cfg.Allow); err != nil {
+		return nil, err
+	}
+	if s.deny, err = compileCIDRs(cfg.Deny); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func compileRoute(r Route, balance string) (compiledRoute, error) {
+	if len(r.Upstreams) == 0 {
+		return compiledRoute{}, fmt.Errorf("reverseproxy: 路由 %q 未配置上游地址", r.Match)
+	}
+	host, path := r.Match, ""
+	if i := strings.IndexByte(r.Match, '/'); i >= 0 {
+		host, path = r.Match[:i], r.Match[i:]
+	}
+
+	lb, err := newLoadBalancer(r.Upstreams, balance)
+	if err != nil {
+		return compiledRoute{}, fmt.Errorf("reverseproxy: 路由 %q: %w", r.Match, err)
+	}
+	return compiledRoute{host: host, path: path, lb: lb}, nil
+}
+
+func compileCIDRs(list []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(list))
+	for _, c := range list {
+		c = strings.TrimSpace(c)
+		if c == "" {
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(c)
+		if err != nil {
+			return nil, fmt.Errorf("reverseproxy: 无效的 CIDR %q: %w", c, err)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+// Start binds cfg.ListenAddr and begins serving in the background.
+func (s *Server) Start() error {
+	ln, err := net.Listen("tcp", s.cfg.ListenAddr)
+	if err != nil {
+		return fmt.Errorf("reverseproxy: 监听失败: %w", err)
+	}
+
+	if s.cfg.GetCertificate != nil || (s.cfg.TLSCertFile != "" && s.cfg.TLSKeyFile != "") {
+		tlsConfig := &tls.Config{}
+		if s.cfg.GetCertificate != nil {
+			tlsConfig.GetCertificate = s.cfg.GetCertificate
+		} else {
+			cert, err := tls.LoadX509KeyPair(s.cfg.TLSCertFile, s.cfg.TLSKeyFile)
+			if err != nil {
+				ln.Close()
+				return fmt.Errorf("reverseproxy: 加载证书失败: %w", err)
+			}
+			tlsConfig.Certificates = []tls.Certificate{cert}
+		}
+		ln = tls.NewListener(ln, tlsConfig)
+	}
+
+	s.ln = ln
+	s.srv = &http.Server{Handler: http.HandlerFunc(s.serveHTTP)}
+	go func() {
+		if err := s.srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			s.onLog(fmt.Sprintf("[反向代理] %s 监听结束: %v\n", s.cfg.ListenAddr, err))
+		}
+	}()
+	s.onLog(fmt.Sprintf("[反向代理] 已启动: %s\n", s.cfg.ListenAddr))
+	return nil
+}
+
+// Stop gracefully shuts the listener down: in-flight requests are given
+// up to 5 seconds to finish, after which any still running are cut off.
+func (s *Server) Stop() {
+	if s.srv == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.srv.Shutdown(ctx); err != nil {
+		s.srv.Close()
+	}
+	s.onLog(fmt.Sprintf("[反向代理] 已停止: %s\n", s.cfg.ListenAddr))
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	remoteIP := remoteIP(r.RemoteAddr)
+	if !s.allowed(remoteIP) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		s.onLog(fmt.Sprintf("[反向代理] %s %s %s -> 拒绝(IP 不在允许列表)\n", remoteIP, r.Method, r.Host+r.URL.Path))
+		return
+	}
+
+	if s.cfg.BasicAuthUser != "" && !s.checkBasicAuth(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="ech-wk"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	route, ok := s.matchRoute(r.Host, r.URL.Path)
+	if !ok {
+		http.NotFound(w, r)
+		s.onLog(fmt.Sprintf("[反向代理] %s %s %s -> 404 (无匹配路由)\n", remoteIP, r.Method, r.Host+r.URL.Path))
+		return
+	}
+
+	target := route.lb.next()
+	proxy := &httputil.ReverseProxy{
+		Director:       s.director(target),
+		ModifyResponse: s.modifyResponse,
+	}
+
+	start := time.Now()
+	proxy.ServeHTTP(w, r)
+	s.onLog(fmt.Sprintf("[反向代理] %s %s %s -> %s (%s)\n", remoteIP, r.Method, r.Host+r.URL.Path, target, time.Since(start)))
+}
+
+func (s *Server) director(target *url.URL) func(*http.Request) {
+	return func(req *http.Request) {
+		req.URL.Scheme = target.Scheme
+		req.URL.Host = target.Host
+		req.Host = target.Host
+
+		for k, v := range s.cfg.AddRequestHeaders {
+			req.Header.Set(k, v)
+		}
+		for _, k := range s.cfg.RemoveRequestHeaders {
+			req.Header.Del(k)
+		}
+	}
+}
+
+func (s *Server) modifyResponse(resp *http.Response) error {
+	for k, v := range s.cfg.AddResponseHeaders {
+		resp.Header.Set(k, v)
+	}
+	for _, k := range s.cfg.RemoveResponseHeaders {
+		resp.Header.Del(k)
+	}
+
+	if len(s.cfg.CookieRewrites) > 0 {
+		cookies := resp.Cookies()
+		if len(cookies) > 0 {
+			resp.Header.Del("Set-Cookie")
+			for _, c := range cookies {
+				if newName, ok := s.cfg.CookieRewrites[c.Name]; ok {
+					c.Name = newName
+				}
+				resp.Header.Add("Set-Cookie", c.String())
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Server) checkBasicAuth(r *http.Request) bool {
+	user, pass, ok := r.BasicAuth()
+	if !ok {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(user), []byte(s.cfg.BasicAuthUser)) == 1 &&
+		subtle.ConstantTimeCompare([]byte(pass), []byte(s.cfg.BasicAuthPass)) == 1
+}
+
+func (s *Server) allowed(ip net.IP) bool {
+	if ip == nil {
+		return len(s.allow) == 0
+	}
+	for _, d := range s.deny {
+		if d.Contains(ip) {
+			return false
+		}
+	}
+	if len(s.allow) == 0 {
+		return true
+	}
+	for _, a := range s.allow {
+		if a.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchRoute returns the first route whose host (ignoring port) equals
+// host or is empty, and whose path is a prefix of reqPath or is empty.
+// Routes are tried in declaration order, same as core.RoutingEngine.
+func (s *Server) matchRoute(host, reqPath string) (compiledRoute, bool) {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	for _, r := range s.routes {
+		if r.host != "" && !strings.EqualFold(r.host, host) {
+			continue
+		}
+		if r.path != "" && !strings.HasPrefix(reqPath, r.path) {
+			continue
+		}
+		return r, true
+	}
+	return compiledRoute{}, false
+}
+
+func remoteIP(remoteAddr string) net.IP {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+// loadBalancer picks one of a route's upstreams per request, either in a
+// cycling round-robin order or weighted-random proportional to Weight.
+type loadBalancer struct {
+	mu          sync.Mutex
+	upstreams   []*url.URL
+	weights     []int
+	totalWeight int
+	cursor      int
+	weighted    bool
+	randState   uint64
+}
+
+func newLoadBalancer(upstreams []Upstream, balance string) (*loadBalancer, error) {
+	lb := &loadBalancer{weighted: balance == "weighted", randState: 0x9e3779b97f4a7c15}
+	for _, u := range upstreams {
+		parsed, err := url.Parse(u.URL)
+		if err != nil {
+			return nil, fmt.Errorf("无效的上游地址 %q: %w", u.URL, err)
+		}
+		weight := u.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		lb.upstreams = append(lb.upstreams, parsed)
+		lb.weights = append(lb.weights, weight)
+		lb.totalWeight += weight
+	}
+	return lb, nil
+}
+
+func (lb *loadBalancer) next() *url.URL {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	if len(lb.upstreams) == 1 {
+		return lb.upstreams[0]
+	}
+
+	if !lb.weighted {
+		u := lb.upstreams[lb.cursor%len(lb.upstreams)]
+		lb.cursor++
+		return u
+	}
+
+	pick := int(lb.nextRand() % uint64(lb.totalWeight))
+	for i, w := range lb.weights {
+		if pick < w {
+			return lb.upstreams[i]
+		}
+		pick -= w
+	}
+	return lb.upstreams[len(lb.upstreams)-1]
+}
+
+// nextRand is a tiny xorshift64* generator - good enough for spreading
+// weighted picks across upstreams, and avoids pulling in math/rand just
+// for this.
+func (lb *loadBalancer) nextRand() uint64 {
+	x := lb.randState
+	x ^= x >> 12
+	x ^= x << 25
+	x ^= x >> 27
+	lb.randState = x
+	return x * 0x2545F4914F6CDD1D
+}
@@ -0,0 +1,163 @@
+// Package wol sends Wake-on-LAN magic packets and talks to the
+// companion ech-wk-agent binary (cmd/ech-wk-agent) to shut a peer back
+// down, for the config.Server.Peers list set in internal/config.
+//
+// The shutdown request is authenticated (HMAC over path + timestamp,
+// see Sign) but sent in the clear - it must only ever be pointed at a
+// TLS-terminating proxy in front of ech-wk-agent, or kept on a trusted
+// LAN where nothing can intercept or inject it.
+package wol
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/juerson/ech-wk/client-gui-go/internal/config"
+)
+
+// magicPacketPort is the conventional UDP port for Wake-on-LAN magic
+// packets; most NICs listen on it regardless of what's actually bound
+// there, so broadcasting to it needs no cooperation from the target.
+const magicPacketPort = 9
+
+// shutdownTimeout bounds how long Shutdown waits for the agent to
+// respond before giving up.
+const shutdownTimeout = 5 * time.Second
+
+// shutdownSignatureWindow is how far a request's X-Agent-Timestamp may
+// drift from the agent's own clock before it's rejected as stale (and
+// thus, incidentally, how long a captured request stays replayable).
+// cmd/ech-wk-agent enforces this window; Shutdown just has to generate
+// a fresh timestamp on every call.
+const shutdownSignatureWindow = 30 * time.Second
+
+// Wake sends a standard magic packet (6x 0xFF followed by the MAC
+// repeated 16 times) over UDP to every address in peer.Broadcast. It
+// returns the first send error encountered, but still attempts every
+// address rather than stopping at the first failure - it's common for
+// a LAN to have more than one broadcast-capable interface.
+func Wake(peer config.PeerDevice) error {
+	packet, err := magicPacket(peer.MAC)
+	if err != nil {
+		return err
+	}
+	if len(peer.Broadcast) == 0 {
+		return errors.New("未配置广播地址")
+	}
+
+	var firstErr error
+	for _, addr := range peer.Broadcast {
+		if err := sendMagicPacket(packet, addr); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func sendMagicPacket(packet []byte, broadcastAddr string) error {
+	addr := broadcastAddr
+	if !strings.Contains(addr, ":") {
+		addr = fmt.Sprintf("%s:%d", addr, magicPacketPort)
+	}
+	udpAddr, err := net.ResolveUDPAddr("udp4", addr)
+	if err != nil {
+		return fmt.Errorf("解析广播地址 %q 失败: %w", broadcastAddr, err)
+	}
+	conn, err := net.DialUDP("udp4", nil, udpAddr)
+	if err != nil {
+		return fmt.Errorf("发送魔术包到 %q 失败: %w", broadcastAddr, err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write(packet); err != nil {
+		return fmt.Errorf("发送魔术包到 %q 失败: %w", broadcastAddr, err)
+	}
+	return nil
+}
+
+// magicPacket builds the 102-byte Wake-on-LAN payload for mac.
+func magicPacket(mac string) ([]byte, error) {
+	hw, err := net.ParseMAC(mac)
+	if err != nil {
+		return nil, fmt.Errorf("无效的 MAC 地址 %q: %w", mac, err)
+	}
+
+	var buf bytes.Buffer
+	buf.Write(bytes.Repeat([]byte{0xFF}, 6))
+	for i := 0; i < 16; i++ {
+		buf.Write(hw)
+	}
+	return buf.Bytes(), nil
+}
+
+// Shutdown asks the ech-wk-agent running at peer.AgentEndpoint to power
+// the peer off, authenticating with an HMAC-SHA256 over the request
+// path and a fresh timestamp, keyed by peer.AgentSecret (see
+// cmd/ech-wk-agent for the server side). The agent endpoint carries no
+// transport security of its own - peer.AgentEndpoint must point at a
+// TLS-terminating reverse proxy or otherwise be reachable only from a
+// trusted LAN, since anything on-path can read the request (and, within
+// the validity window, replay it verbatim).
+func Shutdown(peer config.PeerDevice) error {
+	if peer.AgentEndpoint == "" {
+		return errors.New("未配置关机代理地址")
+	}
+
+	const path = "/shutdown"
+	req, err := http.NewRequest(http.MethodPost, strings.TrimRight(peer.AgentEndpoint, "/")+path, nil)
+	if err != nil {
+		return fmt.Errorf("构造关机请求失败: %w", err)
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("X-Agent-Timestamp", timestamp)
+	req.Header.Set("X-Agent-Signature", Sign(peer.AgentSecret, path, timestamp))
+
+	client := &http.Client{Timeout: shutdownTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("调用关机代理失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("关机代理返回状态码 %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Sign computes the HMAC-SHA256 signature Shutdown sends in its
+// X-Agent-Signature header, binding both the request path and the
+// X-Agent-Timestamp value so a captured request can't be replayed once
+// that timestamp falls outside cmd/ech-wk-agent's validity window.
+func Sign(secret, path, timestamp string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(path))
+	mac.Write([]byte{0})
+	mac.Write([]byte(timestamp))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// CheckTimestamp reports whether timestamp (an X-Agent-Timestamp
+// header value, seconds since the Unix epoch) is within
+// shutdownSignatureWindow of now, so cmd/ech-wk-agent can reject stale
+// or malformed values before even comparing signatures.
+func CheckTimestamp(timestamp string, now time.Time) bool {
+	sec, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	delta := now.Sub(time.Unix(sec, 0))
+	if delta < 0 {
+		delta = -delta
+	}
+	return delta <= shutdownSignatureWindow
+}
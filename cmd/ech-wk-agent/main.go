@@ -0,0 +1,78 @@
+// Command ech-wk-agent is the lightweight companion binary
+// internal/wol.Shutdown talks to: it listens for an authenticated
+// HTTP request and powers the machine it runs on down. It carries no
+// other ech-wk functionality and has no dependency on the tray client
+// or the proxy core, so it can be deployed standalone onto any peer
+// named in a config.Server's Peers list.
+//
+// -listen is served as plain HTTP with no built-in transport security;
+// deploy it behind a TLS-terminating reverse proxy, or restrict it to a
+// trusted LAN, same as internal/wol's package doc notes on the client
+// side.
+package main
+
+import (
+	"crypto/hmac"
+	"flag"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/juerson/ech-wk/client-gui-go/internal/wol"
+)
+
+func main() {
+	addr := flag.String("listen", "0.0.0.0:9090", "监听地址")
+	secret := flag.String("secret", "", "共享密钥，必须与 PeerDevice.AgentSecret 一致")
+	flag.Parse()
+
+	if *secret == "" {
+		log.Fatal("必须通过 -secret 指定共享密钥")
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/shutdown", withAuth(*secret, handleShutdown))
+
+	log.Printf("ech-wk-agent 正在监听 %s", *addr)
+	if err := http.ListenAndServe(*addr, mux); err != nil {
+		log.Fatalf("启动失败: %v", err)
+	}
+}
+
+// withAuth rejects any request whose X-Agent-Timestamp is missing,
+// malformed, or stale (see wol.CheckTimestamp), or whose
+// X-Agent-Signature doesn't match wol.Sign(secret, r.URL.Path,
+// timestamp) - the same value internal/wol.Shutdown sends. Binding the
+// signature to the timestamp, and rejecting stale timestamps, keeps a
+// captured request from being replayed once it falls outside the
+// validity window.
+func withAuth(secret string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		timestamp := r.Header.Get("X-Agent-Timestamp")
+		if !wol.CheckTimestamp(timestamp, time.Now()) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		want := wol.Sign(secret, r.URL.Path, timestamp)
+		got := r.Header.Get("X-Agent-Signature")
+		if !hmac.Equal([]byte(want), []byte(got)) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func handleShutdown(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	log.Printf("收到关机请求，来自 %s", r.RemoteAddr)
+	if err := shutdownNow(); err != nil {
+		log.Printf("执行关机命令失败: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
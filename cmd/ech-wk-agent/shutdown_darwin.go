@@ -0,0 +1,9 @@
+//go:build darwin
+
+package main
+
+import "os/exec"
+
+func shutdownNow() error {
+	return exec.Command("shutdown", "-h", "now").Run()
+}
@@ -0,0 +1,9 @@
+//go:build linux
+
+package main
+
+import "os/exec"
+
+func shutdownNow() error {
+	return exec.Command("poweroff").Run()
+}
@@ -0,0 +1,9 @@
+//go:build windows
+
+package main
+
+import "os/exec"
+
+func shutdownNow() error {
+	return exec.Command("shutdown", "/s", "/t", "0").Run()
+}
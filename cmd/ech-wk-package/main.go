@@ -0,0 +1,269 @@
+// Command ech-wk-package stages OS-native distribution trees for the
+// ech-wk tray client: a macOS .app bundle, a Linux .deb staging tree
+// with a desktop entry and autostart file, and an NSIS installer script
+// next to the Windows executable and icon. Like fyne's own
+// cmd/fyne/package.go it lays out a directory tree next to the
+// already-built executable; it stops there. It builds no AppImage, writes
+// no Windows version-info resource, and does not run a native packer on
+// the staged tree.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"text/template"
+)
+
+const appName = "ECH Workers Client"
+
+func main() {
+	target := flag.String("os", "", "目标平台: darwin, linux, windows")
+	exe := flag.String("exe", "", "已构建的可执行文件路径")
+	icon := flag.String("icon", "", "图标文件路径（.png）")
+	version := flag.String("version", "0.0.0", "发布版本号")
+	out := flag.String("out", "dist", "输出目录")
+	flag.Parse()
+
+	if *exe == "" {
+		log.Fatal("必须通过 -exe 指定已构建的可执行文件")
+	}
+	if err := os.MkdirAll(*out, 0o755); err != nil {
+		log.Fatalf("创建输出目录失败: %v", err)
+	}
+
+	var err error
+	switch *target {
+	case "darwin":
+		err = packageDarwin(*exe, *icon, *version, *out)
+	case "linux":
+		err = packageLinux(*exe, *icon, *version, *out)
+	case "windows":
+		err = packageWindows(*exe, *icon, *version, *out)
+	default:
+		log.Fatalf("未知平台 %q，支持: darwin, linux, windows", *target)
+	}
+	if err != nil {
+		log.Fatalf("打包失败: %v", err)
+	}
+	fmt.Printf("已生成 %s 平台的发布包，输出目录: %s\n", *target, *out)
+}
+
+func copyFile(src, dst string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, in)
+	return err
+}
+
+// ---------------------------------------------------------------- darwin
+
+const darwinPlistTemplate = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>CFBundleName</key>
+	<string>{{.Name}}</string>
+	<key>CFBundleExecutable</key>
+	<string>{{.ExecName}}</string>
+	<key>CFBundleIdentifier</key>
+	<string>com.juerson.echworkersclient</string>
+	<key>CFBundleVersion</key>
+	<string>{{.Version}}</string>
+	<key>CFBundleShortVersionString</key>
+	<string>{{.Version}}</string>
+	<key>CFBundleIconFile</key>
+	<string>icon.icns</string>
+	<key>CFBundleURLTypes</key>
+	<array>
+		<dict>
+			<key>CFBundleURLName</key>
+			<string>com.juerson.echworkersclient.ech</string>
+			<key>CFBundleURLSchemes</key>
+			<array>
+				<string>ech</string>
+			</array>
+		</dict>
+	</array>
+	<key>LSMinimumSystemVersion</key>
+	<string>10.14</string>
+</dict>
+</plist>
+`
+
+func packageDarwin(exe, icon, version, out string) error {
+	execName := filepath.Base(exe)
+	bundle := filepath.Join(out, appName+".app")
+	contents := filepath.Join(bundle, "Contents")
+	macos := filepath.Join(contents, "MacOS")
+	resources := filepath.Join(contents, "Resources")
+
+	if err := os.MkdirAll(macos, 0o755); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(resources, 0o755); err != nil {
+		return err
+	}
+
+	if err := copyFile(exe, filepath.Join(macos, execName), 0o755); err != nil {
+		return fmt.Errorf("复制可执行文件失败: %w", err)
+	}
+
+	if icon != "" {
+		// A real .icns needs multi-resolution conversion (sips/iconutil);
+		// ship the source PNG under that name as a placeholder so the
+		// bundle is still valid, and let the release pipeline post-process it.
+		if err := copyFile(icon, filepath.Join(resources, "icon.icns"), 0o644); err != nil {
+			return fmt.Errorf("复制图标失败: %w", err)
+		}
+	}
+
+	plistPath := filepath.Join(contents, "Info.plist")
+	f, err := os.Create(plistPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	t := template.Must(template.New("plist").Parse(darwinPlistTemplate))
+	return t.Execute(f, map[string]string{"Name": appName, "ExecName": execName, "Version": version})
+}
+
+// ----------------------------------------------------------------- linux
+
+const desktopEntryTemplate = `[Desktop Entry]
+Type=Application
+Name={{.Name}}
+Exec=/opt/ech-wk/{{.ExecName}} %u
+Icon=ech-wk
+Categories=Network;
+MimeType=x-scheme-handler/ech;
+X-GNOME-Autostart-enabled=true
+`
+
+const debControlTemplate = `Package: ech-wk-client
+Version: {{.Version}}
+Section: net
+Priority: optional
+Architecture: amd64
+Maintainer: juerson
+Description: {{.Name}}
+ ECH Workers 的跨平台托盘客户端。
+`
+
+func packageLinux(exe, icon, version, out string) error {
+	execName := filepath.Base(exe)
+	stage := filepath.Join(out, "ech-wk-client")
+	binDir := filepath.Join(stage, "opt", "ech-wk")
+	debianDir := filepath.Join(stage, "DEBIAN")
+	applicationsDir := filepath.Join(stage, "usr", "share", "applications")
+	autostartDir := filepath.Join(stage, "etc", "xdg", "autostart")
+
+	for _, d := range []string{binDir, debianDir, applicationsDir, autostartDir} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			return err
+		}
+	}
+
+	if err := copyFile(exe, filepath.Join(binDir, execName), 0o755); err != nil {
+		return fmt.Errorf("复制可执行文件失败: %w", err)
+	}
+	if icon != "" {
+		if err := copyFile(icon, filepath.Join(binDir, "ech-wk.png"), 0o644); err != nil {
+			return fmt.Errorf("复制图标失败: %w", err)
+		}
+	}
+
+	data := map[string]string{"Name": appName, "ExecName": execName, "Version": version}
+
+	desktopTpl := template.Must(template.New("desktop").Parse(desktopEntryTemplate))
+	for _, path := range []string{
+		filepath.Join(applicationsDir, "ech-wk-client.desktop"),
+		filepath.Join(autostartDir, "ech-wk-client.desktop"),
+	} {
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		err = desktopTpl.Execute(f, data)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	controlTpl := template.Must(template.New("control").Parse(debControlTemplate))
+	cf, err := os.Create(filepath.Join(debianDir, "control"))
+	if err != nil {
+		return err
+	}
+	defer cf.Close()
+	return controlTpl.Execute(cf, data)
+}
+
+// --------------------------------------------------------------- windows
+
+const nsisScriptTemplate = `; Auto-generated by cmd/ech-wk-package, do not edit by hand.
+!define APP_NAME "{{.Name}}"
+!define APP_VERSION "{{.Version}}"
+!define APP_EXE "{{.ExecName}}"
+
+Name "${APP_NAME}"
+OutFile "ech-wk-client-setup-${APP_VERSION}.exe"
+InstallDir "$PROGRAMFILES\ECHWorkersClient"
+
+Section "Install"
+	SetOutPath "$INSTDIR"
+	File "${APP_EXE}"
+	WriteRegStr HKCR "ech" "URL Protocol" ""
+	WriteRegStr HKCR "ech\shell\open\command" "" '"$INSTDIR\${APP_EXE}" "%1"'
+	WriteUninstaller "$INSTDIR\uninstall.exe"
+SectionEnd
+
+Section "Uninstall"
+	Delete "$INSTDIR\${APP_EXE}"
+	Delete "$INSTDIR\uninstall.exe"
+	DeleteRegKey HKCR "ech"
+SectionEnd
+`
+
+func packageWindows(exe, icon, version, out string) error {
+	execName := filepath.Base(exe)
+	stage := filepath.Join(out, "windows")
+	if err := os.MkdirAll(stage, 0o755); err != nil {
+		return err
+	}
+
+	if err := copyFile(exe, filepath.Join(stage, execName), 0o755); err != nil {
+		return fmt.Errorf("复制可执行文件失败: %w", err)
+	}
+	if icon != "" {
+		if err := copyFile(icon, filepath.Join(stage, "icon.ico"), 0o644); err != nil {
+			return fmt.Errorf("复制图标失败: %w", err)
+		}
+	}
+
+	t := template.Must(template.New("nsis").Parse(nsisScriptTemplate))
+	f, err := os.Create(filepath.Join(stage, "installer.nsi"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return t.Execute(f, map[string]string{"Name": appName, "ExecName": execName, "Version": version})
+}
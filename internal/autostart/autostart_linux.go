@@ -4,6 +4,7 @@ package autostart
 
 import (
 	"os"
+	"os/exec"
 	"path/filepath"
 	"text/template"
 )
@@ -17,6 +18,20 @@ NoDisplay=false
 X-GNOME-Autostart-enabled=true
 `
 
+const systemdUnitTemplate = `[Unit]
+Description=ECH Workers Client
+After=network.target
+
+[Service]
+ExecStart={{.ExePath}}
+Restart=on-failure
+
+[Install]
+WantedBy=multi-user.target
+`
+
+const systemdUnitName = "ech-workers-client.service"
+
 func getDesktopFilePath() (string, error) {
 	home, err := os.UserHomeDir()
 	if err != nil {
@@ -29,7 +44,32 @@ func getDesktopFilePath() (string, error) {
 	return filepath.Join(dir, "ech-workers-client.desktop"), nil
 }
 
-func Enable() error {
+func getSystemdUnitPath() string {
+	return filepath.Join("/etc/systemd/system", systemdUnitName)
+}
+
+func Enable(mode Mode) error {
+	if mode == ModeService {
+		return enableService()
+	}
+	return enableLoginItem()
+}
+
+func Disable(mode Mode) error {
+	if mode == ModeService {
+		return disableService()
+	}
+	return disableLoginItem()
+}
+
+func IsEnabled(mode Mode) (bool, error) {
+	if mode == ModeService {
+		return isServiceEnabled()
+	}
+	return isLoginItemEnabled()
+}
+
+func enableLoginItem() error {
 	exe, err := os.Executable()
 	if err != nil {
 		return err
@@ -54,7 +94,7 @@ func Enable() error {
 	return t.Execute(f, map[string]string{"ExePath": exe})
 }
 
-func Disable() error {
+func disableLoginItem() error {
 	path, err := getDesktopFilePath()
 	if err != nil {
 		return err
@@ -65,7 +105,7 @@ func Disable() error {
 	return nil
 }
 
-func IsEnabled() (bool, error) {
+func isLoginItemEnabled() (bool, error) {
 	path, err := getDesktopFilePath()
 	if err != nil {
 		return false, err
@@ -78,3 +118,53 @@ func IsEnabled() (bool, error) {
 	}
 	return true, nil
 }
+
+// enableService installs the running executable as a systemd system
+// unit (vs. the per-user autostart .desktop entry used by ModeLoginItem),
+// so it starts at boot and keeps running after logout. Writing to
+// /etc/systemd/system requires root; callers should expect
+// Enable(ModeService) to fail with a permission error when not elevated.
+func enableService() error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	exe, err = filepath.Abs(exe)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(getSystemdUnitPath())
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	t := template.Must(template.New("systemd").Parse(systemdUnitTemplate))
+	if err := t.Execute(f, map[string]string{"ExePath": exe}); err != nil {
+		return err
+	}
+
+	if err := exec.Command("systemctl", "daemon-reload").Run(); err != nil {
+		return err
+	}
+	return exec.Command("systemctl", "enable", "--now", systemdUnitName).Run()
+}
+
+func disableService() error {
+	_ = exec.Command("systemctl", "disable", "--now", systemdUnitName).Run()
+	if err := os.Remove(getSystemdUnitPath()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return exec.Command("systemctl", "daemon-reload").Run()
+}
+
+func isServiceEnabled() (bool, error) {
+	if _, err := os.Stat(getSystemdUnitPath()); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
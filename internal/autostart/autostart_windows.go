@@ -8,14 +8,38 @@ import (
 	"path/filepath"
 
 	"golang.org/x/sys/windows/registry"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
 )
 
 const (
-	runKeyPath = `Software\Microsoft\Windows\CurrentVersion\Run`
-	appName    = "ECHWorkersClient"
+	runKeyPath  = `Software\Microsoft\Windows\CurrentVersion\Run`
+	appName     = "ECHWorkersClient"
+	ServiceName = "ECHWorkersClient"
 )
 
-func Enable() error {
+func Enable(mode Mode) error {
+	if mode == ModeService {
+		return enableService()
+	}
+	return enableLoginItem()
+}
+
+func Disable(mode Mode) error {
+	if mode == ModeService {
+		return disableService()
+	}
+	return disableLoginItem()
+}
+
+func IsEnabled(mode Mode) (bool, error) {
+	if mode == ModeService {
+		return isServiceEnabled()
+	}
+	return isLoginItemEnabled()
+}
+
+func enableLoginItem() error {
 	exe, err := os.Executable()
 	if err != nil {
 		return err
@@ -34,7 +58,7 @@ func Enable() error {
 	return k.SetStringValue(appName, cmd)
 }
 
-func Disable() error {
+func disableLoginItem() error {
 	k, err := registry.OpenKey(registry.CURRENT_USER, runKeyPath, registry.SET_VALUE)
 	if err != nil {
 		return err
@@ -49,7 +73,7 @@ func Disable() error {
 	return nil
 }
 
-func IsEnabled() (bool, error) {
+func isLoginItemEnabled() (bool, error) {
 	k, err := registry.OpenKey(registry.CURRENT_USER, runKeyPath, registry.QUERY_VALUE)
 	if err != nil {
 		return false, err
@@ -64,3 +88,75 @@ func IsEnabled() (bool, error) {
 	}
 	return true, nil
 }
+
+// enableService installs the running executable as a Windows Service
+// (see ServiceName) that starts automatically at boot. The SCM invokes
+// the same executable with no arguments; main detects svc.IsWindowsService
+// and runs the embedded proxy under a svc.Handler instead of the GUI.
+func enableService() error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	exe, err = filepath.Abs(exe)
+	if err != nil {
+		return err
+	}
+
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("连接服务控制管理器失败: %w", err)
+	}
+	defer m.Disconnect()
+
+	if s, err := m.OpenService(ServiceName); err == nil {
+		s.Close()
+		return nil
+	}
+
+	s, err := m.CreateService(ServiceName, exe, mgr.Config{
+		DisplayName: "ECH Workers Client",
+		Description: "ECH Workers 代理客户端后台服务",
+		StartType:   mgr.StartAutomatic,
+	})
+	if err != nil {
+		return fmt.Errorf("创建 Windows 服务失败: %w", err)
+	}
+	defer s.Close()
+	return nil
+}
+
+func disableService() error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("连接服务控制管理器失败: %w", err)
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(ServiceName)
+	if err != nil {
+		return nil
+	}
+	defer s.Close()
+
+	_, _ = s.Control(svc.Stop)
+	if err := s.Delete(); err != nil {
+		return fmt.Errorf("删除 Windows 服务失败: %w", err)
+	}
+	return nil
+}
+
+func isServiceEnabled() (bool, error) {
+	m, err := mgr.Connect()
+	if err != nil {
+		return false, fmt.Errorf("连接服务控制管理器失败: %w", err)
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(ServiceName)
+	if err != nil {
+		return false, nil
+	}
+	s.Close()
+	return true, nil
+}
@@ -0,0 +1,15 @@
+package autostart
+
+// Mode selects which OS mechanism Enable, Disable and IsEnabled target.
+type Mode int
+
+const (
+	// ModeLoginItem runs the app only after interactive login (HKCU Run,
+	// a user LaunchAgent, or an XDG autostart .desktop entry) and exits
+	// along with the session.
+	ModeLoginItem Mode = iota
+	// ModeService installs the app as a background service (a Windows
+	// Service, a launchd LaunchDaemon, or a systemd system unit) that
+	// survives logout and starts at boot.
+	ModeService
+)
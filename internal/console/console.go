@@ -0,0 +1,315 @@
+// Package console implements the embedded terminal panel shown in the
+// main window: a scrollback view that mirrors everything the process
+// sends through the standard log package, plus a small REPL for
+// ECH-related diagnostic commands (keypair generation, ECHConfigList
+// inspection, HTTPS-RR probing). It borrows the "dock a console next to
+// the app" idea from editor IDEs rather than anything ECH-specific.
+package console
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+)
+
+// Handler answers one REPL command. args excludes the command name
+// itself; the returned string is appended to the console as-is.
+type Handler func(args []string) string
+
+// ansiPattern strips SGR escape sequences before they reach the
+// widget.Entry backing the view, since Fyne's Entry has no ANSI
+// renderer; RichText would let us keep color, but the rest of this
+// file's sibling (ui.MainWindow's log box) already standardized on a
+// plain Entry, so we match that instead of introducing a second style.
+var ansiPattern = regexp.MustCompile("\x1b\\[[0-9;]*[a-zA-Z]")
+
+// Console is a dockable panel: a read-only scrollback view fed by
+// log.SetOutput, and a single-line command entry dispatching to
+// registered Handlers.
+type Console struct {
+	mu       sync.Mutex
+	view     *widget.Entry
+	scroll   *container.Scroll
+	input    *widget.Entry
+	handlers map[string]Handler
+	logFile  *os.File
+	maxLines int
+	lines    []string
+}
+
+// New creates a console panel and installs it as an additional
+// log.Output writer, so every log.Printf already scattered through the
+// codebase shows up here as well as on stderr. logDir, if non-empty, is
+// where every log line is also appended to ech-wk.log so users can export
+// a support bundle. maxLines caps only the in-memory scrollback; the file
+// is never truncated.
+func New(logDir string, maxLines int) *Console {
+	if maxLines <= 0 {
+		maxLines = 2000
+	}
+	c := &Console{
+		view:     widget.NewMultiLineEntry(),
+		input:    widget.NewEntry(),
+		handlers: map[string]Handler{},
+		maxLines: maxLines,
+	}
+	c.view.Wrapping = fyne.TextWrapWord
+	c.view.Disable() // read-only scrollback
+	c.scroll = container.NewVScroll(c.view)
+
+	c.registerBuiltins()
+
+	if logDir != "" {
+		if err := os.MkdirAll(logDir, 0o755); err != nil {
+			log.Printf("[控制台] 创建日志目录失败: %v", err)
+		} else if f, err := os.OpenFile(filepath.Join(logDir, "ech-wk.log"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644); err != nil {
+			log.Printf("[控制台] 打开日志文件失败: %v", err)
+		} else {
+			c.logFile = f
+		}
+	}
+
+	writers := []io.Writer{os.Stderr, c}
+	if c.logFile != nil {
+		writers = append(writers, c.logFile)
+	}
+	log.SetOutput(io.MultiWriter(writers...))
+
+	c.input.SetPlaceHolder("输入命令，例如: help")
+	c.input.OnSubmitted = func(s string) {
+		c.runCommand(s)
+		c.input.SetText("")
+	}
+
+	return c
+}
+
+// Write implements io.Writer so *Console can be passed straight to
+// log.SetOutput / io.MultiWriter.
+func (c *Console) Write(p []byte) (int, error) {
+	n := len(p)
+	clean := ansiPattern.ReplaceAllString(string(p), "")
+	for _, line := range strings.Split(strings.TrimRight(clean, "\n"), "\n") {
+		c.appendLine(line)
+	}
+	return n, nil
+}
+
+func (c *Console) appendLine(line string) {
+	c.mu.Lock()
+	c.lines = append(c.lines, line)
+	if len(c.lines) > c.maxLines {
+		c.lines = c.lines[len(c.lines)-c.maxLines:]
+	}
+	text := strings.Join(c.lines, "\n")
+	c.mu.Unlock()
+
+	fyne.Do(func() {
+		c.view.SetText(text)
+		c.scroll.ScrollToBottom()
+	})
+}
+
+// RegisterHandler adds or replaces the handler invoked for name.
+func (c *Console) RegisterHandler(name string, h Handler) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.handlers[name] = h
+}
+
+func (c *Console) runCommand(line string) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return
+	}
+	c.appendLine("> " + line)
+
+	fields := strings.Fields(line)
+	name := fields[0]
+
+	c.mu.Lock()
+	h, ok := c.handlers[name]
+	c.mu.Unlock()
+
+	if !ok {
+		c.appendLine(fmt.Sprintf("未知命令: %s（输入 help 查看命令列表）", name))
+		return
+	}
+	c.appendLine(h(fields[1:]))
+}
+
+// CanvasObject returns the dockable panel: scrollback on top, command
+// entry pinned to the bottom.
+func (c *Console) CanvasObject() fyne.CanvasObject {
+	return container.NewBorder(nil, c.input, nil, nil, c.scroll)
+}
+
+// Close releases the backing log file, if one was opened.
+func (c *Console) Close() error {
+	if c.logFile != nil {
+		return c.logFile.Close()
+	}
+	return nil
+}
+
+// ---------------------------------------------------------- builtin commands
+
+func (c *Console) registerBuiltins() {
+	c.RegisterHandler("help", c.cmdHelp)
+	c.RegisterHandler("genkey", c.cmdGenKey)
+	c.RegisterHandler("parse", c.cmdParse)
+	c.RegisterHandler("probe", c.cmdProbe)
+}
+
+func (c *Console) cmdHelp(_ []string) string {
+	c.mu.Lock()
+	names := make([]string, 0, len(c.handlers))
+	for name := range c.handlers {
+		names = append(names, name)
+	}
+	c.mu.Unlock()
+	sort.Strings(names)
+
+	return "可用命令: " + strings.Join(names, ", ") + "\n" +
+		"  genkey                生成一对 X25519 密钥（用于 ECH HPKE）\n" +
+		"  parse <base64>        解析一个 ECHConfigList\n" +
+		"  probe <host>          查询某域名的 HTTPS 资源记录"
+}
+
+// cmdGenKey generates an X25519 key pair, the KEM this ECH deployment
+// uses, and prints both halves hex-encoded so they can be pasted into a
+// server-side ECHConfig.
+func (c *Console) cmdGenKey(_ []string) string {
+	priv, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return fmt.Sprintf("生成密钥失败: %v", err)
+	}
+	return fmt.Sprintf("private: %s\npublic:  %s",
+		hex.EncodeToString(priv.Bytes()),
+		hex.EncodeToString(priv.PublicKey().Bytes()))
+}
+
+// cmdParse performs a structural walk of a base64-encoded ECHConfigList
+// (RFC 9460 wire format: a 2-byte overall length followed by one or more
+// ECHConfig entries, each itself version(2) + length(2) + body). It
+// reports the entries found rather than fully decoding every extension,
+// which is enough to tell a well-formed config apart from a corrupt one.
+func (c *Console) cmdParse(args []string) string {
+	if len(args) != 1 {
+		return "用法: parse <base64 ECHConfigList>"
+	}
+	raw, err := base64.StdEncoding.DecodeString(args[0])
+	if err != nil {
+		return fmt.Sprintf("base64 解码失败: %v", err)
+	}
+	if len(raw) < 2 {
+		return "数据过短，不是合法的 ECHConfigList"
+	}
+
+	total := int(raw[0])<<8 | int(raw[1])
+	body := raw[2:]
+	if total != len(body) {
+		return fmt.Sprintf("长度字段(%d)与实际数据长度(%d)不符", total, len(body))
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "ECHConfigList: %d 字节\n", len(raw))
+	idx := 0
+	count := 0
+	for len(body) >= 4 {
+		version := int(body[0])<<8 | int(body[1])
+		length := int(body[2])<<8 | int(body[3])
+		if 4+length > len(body) {
+			fmt.Fprintf(&sb, "  [%d] version=0x%04x 声明长度=%d 但剩余数据不足，截断\n", idx, version, length)
+			break
+		}
+		fmt.Fprintf(&sb, "  [%d] version=0x%04x length=%d\n", idx, version, length)
+		body = body[4+length:]
+		idx++
+		count++
+	}
+	fmt.Fprintf(&sb, "共解析到 %d 个 ECHConfig 条目", count)
+	return sb.String()
+}
+
+// cmdProbe queries Cloudflare's DoH resolver for the HTTPS resource
+// record of host and prints whether one was returned, without fully
+// decoding the wire-format answer (the proxy core already owns that
+// parser for the connection path; this is a quick yes/no diagnostic).
+func (c *Console) cmdProbe(args []string) string {
+	if len(args) != 1 {
+		return "用法: probe <host>"
+	}
+	host := args[0]
+
+	query := buildDNSQuery(host)
+	encoded := base64.RawURLEncoding.EncodeToString(query)
+	url := fmt.Sprintf("https://cloudflare-dns.com/dns-query?dns=%s", encoded)
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Sprintf("构造请求失败: %v", err)
+	}
+	req.Header.Set("Accept", "application/dns-message")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Sprintf("DoH 查询失败: %v", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Sprintf("读取响应失败: %v", err)
+	}
+	if len(data) < 12 {
+		return "响应过短"
+	}
+
+	ancount := int(data[6])<<8 | int(data[7])
+	if ancount == 0 {
+		return fmt.Sprintf("%s: 未找到 HTTPS 资源记录", host)
+	}
+	return fmt.Sprintf("%s: 找到 %d 条应答记录（HTTP 状态 %d）", host, ancount, resp.StatusCode)
+}
+
+// buildDNSQuery builds a minimal DNS query for the HTTPS (type 65)
+// record of host.
+func buildDNSQuery(host string) []byte {
+	var buf bytes.Buffer
+	buf.Write([]byte{0xab, 0xcd}) // transaction ID
+	buf.Write([]byte{0x01, 0x00}) // flags: recursion desired
+	buf.Write([]byte{0x00, 0x01}) // qdcount = 1
+	buf.Write([]byte{0x00, 0x00}) // ancount
+	buf.Write([]byte{0x00, 0x00}) // nscount
+	buf.Write([]byte{0x00, 0x00}) // arcount
+
+	for _, label := range strings.Split(host, ".") {
+		if label == "" {
+			continue
+		}
+		buf.WriteByte(byte(len(label)))
+		buf.WriteString(label)
+	}
+	buf.WriteByte(0x00)
+
+	buf.Write([]byte{0x00, 0x41}) // qtype = 65 (HTTPS)
+	buf.Write([]byte{0x00, 0x01}) // qclass = IN
+	return buf.Bytes()
+}
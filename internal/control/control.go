@@ -0,0 +1,340 @@
+// Package control implements an optional, token-protected HTTP+WebSocket
+// API that mirrors what the Fyne UI lets a user do locally: list
+// servers, start/stop the proxy, switch the current server and routing
+// mode, read/replace the persisted config, toggle the system proxy, and
+// stream the running log (optionally filtered to a minimum level via
+// `/logs?level=`). It's off by default; the GUI wires a Handlers value
+// backed by the exact same code paths its own buttons call, so driving
+// the app over HTTP behaves identically to clicking in the window.
+package control
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// ServerSummary is the JSON shape returned by GET /servers.
+type ServerSummary struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// StatusSnapshot is the JSON shape returned by GET /status.
+type StatusSnapshot struct {
+	Running            bool   `json:"running"`
+	CurrentServerID    string `json:"current_server_id"`
+	CurrentServerName  string `json:"current_server_name"`
+	SystemProxyEnabled bool   `json:"system_proxy_enabled"`
+}
+
+// LogEvent is one line published to every connected /logs websocket
+// client. It's deliberately a standalone type (not ui.LogEntry) so this
+// package has no dependency on the UI layer.
+type LogEvent struct {
+	Timestamp string            `json:"ts"`
+	Level     string            `json:"level"`
+	Message   string            `json:"msg"`
+	Fields    map[string]string `json:"fields,omitempty"`
+}
+
+// Handlers are the callbacks the GUI wires to its own Start/Stop/系统
+// proxy code paths. Server never mutates app state directly.
+type Handlers struct {
+	ListServers      func() []ServerSummary
+	StartServer      func(id string) error
+	StopServer       func() error
+	Status           func() StatusSnapshot
+	SetSystemProxy   func(enabled bool) error
+	SetCurrentServer func(id string) error
+	SetRouting       func(mode string) error
+	GetConfig        func() ([]byte, error)
+	SetConfig        func(raw []byte) error
+}
+
+// Broker fans LogEvents out to every subscribed /logs websocket client.
+type Broker struct {
+	mu   sync.Mutex
+	subs map[chan LogEvent]struct{}
+}
+
+// NewBroker creates an empty event broker.
+func NewBroker() *Broker {
+	return &Broker{subs: map[chan LogEvent]struct{}{}}
+}
+
+// Publish fans out ev to every current subscriber without blocking on a
+// slow one (a full channel just drops the event for that subscriber).
+func (b *Broker) Publish(ev LogEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subs {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+func (b *Broker) subscribe() chan LogEvent {
+	ch := make(chan LogEvent, 64)
+	b.mu.Lock()
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+	return ch
+}
+
+func (b *Broker) unsubscribe(ch chan LogEvent) {
+	b.mu.Lock()
+	delete(b.subs, ch)
+	b.mu.Unlock()
+	close(ch)
+}
+
+// Server is the optional remote-control HTTP server.
+type Server struct {
+	srv    *http.Server
+	broker *Broker
+	token  string
+}
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	// The control API is opened deliberately by the user for remote
+	// access from a browser or script; origin checks would just get in
+	// the way of that, and the bearer token is the actual guard.
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// New creates a remote-control server bound to addr, guarded by token
+// (required on every request, via `Authorization: Bearer <token>` or a
+// `?token=` query parameter, which every endpoint accepts and the
+// websocket endpoint relies on). An empty token disables the check.
+func New(addr, token string, broker *Broker, h Handlers) *Server {
+	s := &Server{broker: broker, token: token}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/servers/", s.auth(func(w http.ResponseWriter, r *http.Request) {
+		s.handleServerAction(w, r, h)
+	}))
+	mux.HandleFunc("/servers", s.auth(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, h.ListServers())
+	}))
+	mux.HandleFunc("/status", s.auth(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, h.Status())
+	}))
+	mux.HandleFunc("/system-proxy", s.auth(func(w http.ResponseWriter, r *http.Request) {
+		s.handleSystemProxy(w, r, h)
+	}))
+	mux.HandleFunc("/servers/current", s.auth(func(w http.ResponseWriter, r *http.Request) {
+		s.handleCurrentServer(w, r, h)
+	}))
+	mux.HandleFunc("/routing", s.auth(func(w http.ResponseWriter, r *http.Request) {
+		s.handleRouting(w, r, h)
+	}))
+	mux.HandleFunc("/config", s.auth(func(w http.ResponseWriter, r *http.Request) {
+		s.handleConfig(w, r, h)
+	}))
+	mux.HandleFunc("/logs", s.handleLogsWS)
+
+	s.srv = &http.Server{Addr: addr, Handler: mux}
+	return s
+}
+
+// Start begins serving in the background. Listen errors (e.g. the
+// address is already in use) surface asynchronously via the returned
+// channel's single value.
+func (s *Server) Start() <-chan error {
+	errCh := make(chan error, 1)
+	go func() {
+		if err := s.srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			errCh <- err
+		}
+	}()
+	return errCh
+}
+
+// Stop closes the listener and every open connection at once
+// (http.Server.Close); in-flight requests are not waited for.
+func (s *Server) Stop() error {
+	return s.srv.Close()
+}
+
+func (s *Server) auth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.authorized(r) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	if s.token == "" {
+		return true
+	}
+	if tok := r.URL.Query().Get("token"); tok == s.token {
+		return true
+	}
+	h := r.Header.Get("Authorization")
+	return strings.TrimPrefix(h, "Bearer ") == s.token && h != ""
+}
+
+func (s *Server) handleServerAction(w http.ResponseWriter, r *http.Request, h Handlers) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	// Path shape: /servers/{id}/start or /servers/{id}/stop
+	rest := strings.TrimPrefix(r.URL.Path, "/servers/")
+	parts := strings.Split(rest, "/")
+	if len(parts) != 2 {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	id, action := parts[0], parts[1]
+
+	var err error
+	switch action {
+	case "start":
+		err = h.StartServer(id)
+	case "stop":
+		err = h.StopServer()
+	default:
+		http.Error(w, "unknown action", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]bool{"ok": true})
+}
+
+func (s *Server) handleSystemProxy(w http.ResponseWriter, r *http.Request, h Handlers) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var body struct {
+		Enabled bool `json:"enabled"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, fmt.Sprintf("invalid body: %v", err), http.StatusBadRequest)
+		return
+	}
+	if err := h.SetSystemProxy(body.Enabled); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]bool{"ok": true})
+}
+
+func (s *Server) handleCurrentServer(w http.ResponseWriter, r *http.Request, h Handlers) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var body struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, fmt.Sprintf("invalid body: %v", err), http.StatusBadRequest)
+		return
+	}
+	if err := h.SetCurrentServer(body.ID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]bool{"ok": true})
+}
+
+func (s *Server) handleRouting(w http.ResponseWriter, r *http.Request, h Handlers) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var body struct {
+		Mode string `json:"mode"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, fmt.Sprintf("invalid body: %v", err), http.StatusBadRequest)
+		return
+	}
+	if err := h.SetRouting(body.Mode); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]bool{"ok": true})
+}
+
+func (s *Server) handleConfig(w http.ResponseWriter, r *http.Request, h Handlers) {
+	switch r.Method {
+	case http.MethodGet:
+		raw, err := h.GetConfig()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(raw)
+	case http.MethodPut:
+		raw, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("read body: %v", err), http.StatusBadRequest)
+			return
+		}
+		if err := h.SetConfig(raw); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, map[string]bool{"ok": true})
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// logLevelRank orders the levels appendLog classifies via parseLogLevel
+// so /logs?level= can mean "this severity or above", matching how a
+// human reads a minimum-level filter.
+var logLevelRank = map[string]int{
+	"INFO": 0, "SYSTEM": 0, "SCHEDULE": 0, "WARN": 1, "ERROR": 2,
+}
+
+func (s *Server) handleLogsWS(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	minRank, filtered := logLevelRank[strings.ToUpper(r.URL.Query().Get("level"))]
+
+	ch := s.broker.subscribe()
+	defer s.broker.unsubscribe(ch)
+
+	for ev := range ch {
+		if filtered && logLevelRank[ev.Level] < minRank {
+			continue
+		}
+		if err := conn.WriteJSON(ev); err != nil {
+			return
+		}
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,251 @@
+// Package importer turns a dropped file's content into a list of
+// import candidates. It recognizes three formats: this app's native
+// config JSON (config.Server's on-disk shape), the `ech://` URI scheme
+// (internal/schema), and a compatibility format used by common proxy
+// client exports (name/server/port/token fields, JSON or a Clash-style
+// YAML proxy list). It has no dependency on config.Manager or the UI —
+// the caller maps Candidate onto whatever it persists.
+package importer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"path/filepath"
+	"strings"
+
+	"github.com/juerson/ech-wk/client-gui-go/internal/schema"
+)
+
+// Candidate is one server parsed out of a dropped file.
+type Candidate struct {
+	Name        string
+	Server      string // host:port
+	Listen      string
+	Token       string
+	IP          string
+	DNS         string
+	ECH         string
+	RoutingMode string
+}
+
+// DetectAndParse sniffs name's extension and data's leading bytes to
+// pick a parser.
+func DetectAndParse(name string, data []byte) ([]Candidate, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 {
+		return nil, fmt.Errorf("文件内容为空")
+	}
+
+	ext := strings.ToLower(filepath.Ext(name))
+
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("ech://")):
+		return parseURILines(trimmed)
+	case trimmed[0] == '{' || trimmed[0] == '[':
+		return parseJSON(trimmed)
+	case ext == ".yaml" || ext == ".yml":
+		return parseSimpleYAML(trimmed)
+	default:
+		if c, err := parseURILines(trimmed); err == nil {
+			return c, nil
+		}
+		return parseJSON(trimmed)
+	}
+}
+
+func parseURILines(data []byte) ([]Candidate, error) {
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	var out []Candidate
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		u, err := schema.Parse(line)
+		if err != nil {
+			continue
+		}
+		out = append(out, Candidate{
+			Name:        u.Name,
+			Server:      net.JoinHostPort(u.Host, u.Port),
+			Listen:      u.Listen,
+			Token:       u.Token,
+			IP:          u.IP,
+			DNS:         u.DNS,
+			ECH:         u.ECH,
+			RoutingMode: u.RoutingMode,
+		})
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("未解析出任何 ech:// 条目")
+	}
+	return out, nil
+}
+
+// nativeServer mirrors config.Server's on-disk JSON shape without
+// importing the config package, matching the rest of this package's
+// dependency-free internal packages.
+type nativeServer struct {
+	Name        string `json:"name"`
+	Server      string `json:"server"`
+	Listen      string `json:"listen"`
+	Token       string `json:"token"`
+	IP          string `json:"ip"`
+	DNS         string `json:"dns"`
+	ECH         string `json:"ech"`
+	RoutingMode string `json:"routing_mode"`
+}
+
+// compatEntry covers the field names common proxy clients export
+// under: separate host/port instead of a combined address, and either
+// "token" or "password" for the credential.
+type compatEntry struct {
+	Name     string `json:"name"`
+	Server   string `json:"server"`
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+func parseJSON(data []byte) ([]Candidate, error) {
+	var wrapper struct {
+		Servers []nativeServer `json:"servers"`
+	}
+	if err := json.Unmarshal(data, &wrapper); err == nil && len(wrapper.Servers) > 0 {
+		return fromNative(wrapper.Servers), nil
+	}
+
+	var natives []nativeServer
+	if err := json.Unmarshal(data, &natives); err == nil && len(natives) > 0 && natives[0].Server != "" {
+		return fromNative(natives), nil
+	}
+
+	var compats []compatEntry
+	if err := json.Unmarshal(data, &compats); err == nil && len(compats) > 0 {
+		if out := fromCompat(compats); len(out) > 0 {
+			return out, nil
+		}
+	}
+
+	var one compatEntry
+	if err := json.Unmarshal(data, &one); err == nil && (one.Server != "" || one.Host != "") {
+		return fromCompat([]compatEntry{one}), nil
+	}
+
+	return nil, fmt.Errorf("无法识别的 JSON 格式")
+}
+
+func fromNative(list []nativeServer) []Candidate {
+	out := make([]Candidate, 0, len(list))
+	for _, s := range list {
+		if s.Server == "" {
+			continue
+		}
+		out = append(out, Candidate{
+			Name: s.Name, Server: s.Server, Listen: s.Listen, Token: s.Token,
+			IP: s.IP, DNS: s.DNS, ECH: s.ECH, RoutingMode: s.RoutingMode,
+		})
+	}
+	return out
+}
+
+func fromCompat(list []compatEntry) []Candidate {
+	out := make([]Candidate, 0, len(list))
+	for _, c := range list {
+		host := c.Server
+		if host == "" {
+			host = c.Host
+		}
+		if host == "" {
+			continue
+		}
+		server := host
+		if c.Port != 0 {
+			server = net.JoinHostPort(host, fmt.Sprintf("%d", c.Port))
+		}
+		out = append(out, Candidate{
+			Name:   c.Name,
+			Server: server,
+			Token:  firstNonEmpty(c.Token, c.Password),
+		})
+	}
+	return out
+}
+
+// parseSimpleYAML handles the common Clash-style proxy list export: a
+// top-level `proxies:` key followed by a block sequence of flat maps
+// (`- name: ...` / `  server: ...` / ...). This is not a general YAML
+// parser — anchors, nested structures and multi-document files are out
+// of scope; anything else just yields no candidates, which
+// DetectAndParse reports as an error to its caller.
+func parseSimpleYAML(data []byte) ([]Candidate, error) {
+	var items []map[string]string
+	var cur map[string]string
+	inProxies := false
+
+	for _, raw := range strings.Split(string(data), "\n") {
+		trimmed := strings.TrimSpace(strings.TrimRight(raw, "\r"))
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if !inProxies {
+			if trimmed == "proxies:" {
+				inProxies = true
+			}
+			continue
+		}
+		if strings.HasPrefix(trimmed, "- ") {
+			if cur != nil {
+				items = append(items, cur)
+			}
+			cur = map[string]string{}
+			trimmed = strings.TrimPrefix(trimmed, "- ")
+		} else if cur == nil {
+			continue
+		}
+		kv := strings.SplitN(trimmed, ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		cur[strings.TrimSpace(kv[0])] = strings.Trim(strings.TrimSpace(kv[1]), `"'`)
+	}
+	if cur != nil {
+		items = append(items, cur)
+	}
+	if len(items) == 0 {
+		return nil, fmt.Errorf("未找到 proxies 列表")
+	}
+
+	out := make([]Candidate, 0, len(items))
+	for _, m := range items {
+		host := m["server"]
+		if host == "" {
+			continue
+		}
+		server := host
+		if port := m["port"]; port != "" {
+			server = net.JoinHostPort(host, port)
+		}
+		out = append(out, Candidate{
+			Name:   m["name"],
+			Server: server,
+			Token:  firstNonEmpty(m["password"], m["token"], m["uuid"]),
+		})
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("未解析出任何服务器条目")
+	}
+	return out, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
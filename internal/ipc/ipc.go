@@ -0,0 +1,139 @@
+// Package ipc implements a single-instance guard for the tray client: the
+// first process to start binds a per-user IPC endpoint and keeps serving
+// it for its whole lifetime, while later launches detect the existing
+// endpoint, forward their command-line arguments to it, and exit.
+package ipc
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+)
+
+// Handler wires IPC commands into the running MainWindow.
+type Handler struct {
+	Show   func()
+	Hide   func()
+	Reload func() error
+	Apply  func(uri string) error
+}
+
+// Server is a bound IPC endpoint accepting commands from later launches.
+type Server struct {
+	ln net.Listener
+	h  *Handler
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// TryNotifyRunning attempts to reach an already-running instance and, if one
+// answers, forwards args as commands and returns true. When no instance is
+// reachable it returns false so the caller can become the primary instance.
+func TryNotifyRunning(args []string) bool {
+	conn, err := dialExisting()
+	if err != nil {
+		return false
+	}
+	defer conn.Close()
+
+	cmd := "SHOW"
+	if uri := firstURIArg(args); uri != "" {
+		cmd = "OPEN " + uri
+	} else if hasFlag(args, "--show") {
+		cmd = "SHOW"
+	} else if hasFlag(args, "--hide") {
+		cmd = "HIDE"
+	}
+
+	fmt.Fprintln(conn, cmd)
+	return true
+}
+
+// Serve binds the per-user IPC endpoint and serves commands in the
+// background until Close is called. Stale endpoints left behind by a
+// crashed previous instance are cleaned up automatically.
+func Serve(h *Handler) (*Server, error) {
+	ln, err := listen()
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{ln: ln, h: h}
+	go s.acceptLoop()
+	return s, nil
+}
+
+func (s *Server) acceptLoop() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return
+			}
+			continue
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+	scanner := bufio.NewScanner(conn)
+	if !scanner.Scan() {
+		return
+	}
+	line := strings.TrimSpace(scanner.Text())
+	s.dispatch(line)
+}
+
+func (s *Server) dispatch(line string) {
+	switch {
+	case line == "SHOW":
+		if s.h.Show != nil {
+			s.h.Show()
+		}
+	case line == "HIDE":
+		if s.h.Hide != nil {
+			s.h.Hide()
+		}
+	case line == "RELOAD":
+		if s.h.Reload != nil {
+			_ = s.h.Reload()
+		}
+	case strings.HasPrefix(line, "OPEN "):
+		if s.h.Apply != nil {
+			_ = s.h.Apply(strings.TrimSpace(strings.TrimPrefix(line, "OPEN ")))
+		}
+	}
+}
+
+// Close stops serving and releases the IPC endpoint.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+	return s.ln.Close()
+}
+
+func firstURIArg(args []string) string {
+	for _, a := range args {
+		if strings.HasPrefix(a, "ech://") {
+			return a
+		}
+	}
+	return ""
+}
+
+func hasFlag(args []string, flag string) bool {
+	for _, a := range args {
+		if a == flag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,35 @@
+//go:build linux || darwin
+
+package ipc
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+)
+
+func socketPath() string {
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "ech-wk.sock")
+}
+
+func dialExisting() (net.Conn, error) {
+	return net.Dial("unix", socketPath())
+}
+
+func listen() (net.Listener, error) {
+	path := socketPath()
+
+	// A stale socket file left behind by a crashed instance prevents
+	// binding; only remove it once we've confirmed nothing is listening.
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+	} else {
+		_ = os.Remove(path)
+	}
+
+	return net.Listen("unix", path)
+}
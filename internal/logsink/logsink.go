@@ -0,0 +1,423 @@
+// Package logsink persists the tray client's log entries to disk,
+// independent of the in-memory LogBuffer the UI renders from. It
+// rotates daily and once a size cap is hit, and supports two on-disk
+// formats: human-readable lines and JSON-lines for external log
+// processors.
+package logsink
+
+import (
+	"archive/zip"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// writeQueueSize bounds how many records may be pending for the
+// background writer before Write starts dropping them rather than
+// blocking its caller (appendLog, on the Fyne UI thread).
+const writeQueueSize = 256
+
+// Format selects how records are serialized on disk.
+type Format string
+
+const (
+	FormatText Format = "text"
+	FormatJSON Format = "json"
+)
+
+// Record is one log line plus whatever structured context the caller
+// has available (server name, listen address, routing mode, ...).
+type Record struct {
+	Time    time.Time         `json:"ts"`
+	Level   string            `json:"level"`
+	Message string            `json:"msg"`
+	Fields  map[string]string `json:"fields,omitempty"`
+}
+
+// FileSink is a rotating on-disk log sink: one file per day, named
+// ech-wk-YYYY-MM-DD.log (or .jsonl for FormatJSON), rolled to a
+// numbered backup once it exceeds MaxSizeBytes, with MaxBackups total
+// kept and anything older than MaxAge pruned.
+type FileSink struct {
+	mu sync.Mutex
+
+	dir          string
+	format       Format
+	maxSizeBytes int64
+	maxAge       time.Duration
+	maxBackups   int
+
+	f        *os.File
+	curDay   string
+	curSize  int64
+	curIndex int
+
+	queue chan Record
+	done  chan struct{}
+
+	// minLevel is read with atomic-free mu locking like everything else
+	// here; SetLevel lets the UI raise/lower verbosity without restarting
+	// the sink.
+	minLevel string
+}
+
+// NewFileSink creates (or reopens) today's log file under dir.
+func NewFileSink(dir string, format Format, maxSizeMB, maxAgeDays, maxBackups int) (*FileSink, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("创建日志目录失败: %w", err)
+	}
+	if maxSizeMB <= 0 {
+		maxSizeMB = 10
+	}
+	if maxAgeDays <= 0 {
+		maxAgeDays = 7
+	}
+	if maxBackups <= 0 {
+		maxBackups = 5
+	}
+	if format != FormatJSON {
+		format = FormatText
+	}
+
+	s := &FileSink{
+		dir:          dir,
+		format:       format,
+		maxSizeBytes: int64(maxSizeMB) * 1024 * 1024,
+		maxAge:       time.Duration(maxAgeDays) * 24 * time.Hour,
+		maxBackups:   maxBackups,
+	}
+	if err := s.openForToday(); err != nil {
+		return nil, err
+	}
+
+	s.queue = make(chan Record, writeQueueSize)
+	s.done = make(chan struct{})
+	go s.loop()
+
+	return s, nil
+}
+
+// loop is the background writer goroutine; it owns all disk I/O so
+// Write never blocks its caller on a slow or stalled filesystem.
+func (s *FileSink) loop() {
+	for r := range s.queue {
+		if err := s.writeSync(r); err != nil {
+			log.Printf("[日志] 写入日志文件失败: %v", err)
+		}
+	}
+	close(s.done)
+}
+
+func (s *FileSink) ext() string {
+	if s.format == FormatJSON {
+		return ".jsonl"
+	}
+	return ".log"
+}
+
+func (s *FileSink) basePath(day string) string {
+	return filepath.Join(s.dir, "ech-wk-"+day+s.ext())
+}
+
+func (s *FileSink) openForToday() error {
+	day := time.Now().Format("2006-01-02")
+	path := s.basePath(day)
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("打开日志文件失败: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	s.f = f
+	s.curDay = day
+	s.curSize = info.Size()
+	s.curIndex = 0
+	s.prune()
+	return nil
+}
+
+// levelRank orders levels from least to most severe; an unrecognized
+// level (including "") ranks as DEBUG so it's never filtered out by a
+// misconfigured MinLevel.
+func levelRank(level string) int {
+	switch strings.ToUpper(level) {
+	case "ERROR", "FATAL":
+		return 3
+	case "WARN":
+		return 2
+	case "INFO", "SYSTEM", "SCHEDULE":
+		return 1
+	default:
+		return 0
+	}
+}
+
+// SetLevel changes the minimum level written from now on; records
+// below it are silently dropped by Write. An empty level (the zero
+// value) disables filtering, writing everything.
+func (s *FileSink) SetLevel(level string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.minLevel = level
+}
+
+// Write enqueues r for the background writer and returns immediately;
+// it never touches disk itself. If the writer is falling behind and
+// the queue is full, the record is dropped rather than blocking the
+// caller (appendLog, on the Fyne UI thread).
+func (s *FileSink) Write(r Record) error {
+	s.mu.Lock()
+	minLevel := s.minLevel
+	s.mu.Unlock()
+	if minLevel != "" && levelRank(r.Level) < levelRank(minLevel) {
+		return nil
+	}
+
+	select {
+	case s.queue <- r:
+		return nil
+	default:
+		return fmt.Errorf("日志队列已满，已丢弃一条记录")
+	}
+}
+
+// writeSync appends r to the current file, rotating to a new file
+// first if the day has changed or the current file has exceeded the
+// size cap. Only loop calls this.
+func (s *FileSink) writeSync(r Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.f == nil {
+		return fmt.Errorf("日志文件未打开")
+	}
+	if time.Now().Format("2006-01-02") != s.curDay {
+		if err := s.rotate(true); err != nil {
+			return err
+		}
+	} else if s.curSize >= s.maxSizeBytes {
+		if err := s.rotate(false); err != nil {
+			return err
+		}
+	}
+
+	line, err := s.format_(r)
+	if err != nil {
+		return err
+	}
+	n, err := s.f.WriteString(line)
+	s.curSize += int64(n)
+	return err
+}
+
+// rotate closes the current file. newDay starts a fresh day file;
+// otherwise the current day's file is renamed to a numbered backup,
+// gzipped, and a fresh file for the same day is opened.
+func (s *FileSink) rotate(newDay bool) error {
+	s.f.Close()
+
+	if !newDay {
+		s.curIndex++
+		backup := s.basePath(fmt.Sprintf("%s.%d", s.curDay, s.curIndex))
+		if err := os.Rename(s.basePath(s.curDay), backup); err != nil {
+			return fmt.Errorf("日志轮转失败: %w", err)
+		}
+		if err := gzipAndRemove(backup); err != nil {
+			log.Printf("[日志] 压缩轮转文件失败: %v", err)
+		}
+	}
+	return s.openForToday()
+}
+
+// gzipAndRemove compresses path to path+".gz" and removes the original,
+// so rotated backups don't accumulate uncompressed on disk.
+func gzipAndRemove(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.Create(path + ".gz")
+	if err != nil {
+		return err
+	}
+	gw := gzip.NewWriter(dst)
+	if _, err := io.Copy(gw, src); err != nil {
+		gw.Close()
+		dst.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := gw.Close(); err != nil {
+		dst.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(path + ".gz")
+		return err
+	}
+	return os.Remove(path)
+}
+
+func (s *FileSink) format_(r Record) (string, error) {
+	if s.format == FormatJSON {
+		b, err := json.Marshal(r)
+		if err != nil {
+			return "", err
+		}
+		return string(b) + "\n", nil
+	}
+
+	var fields string
+	if len(r.Fields) > 0 {
+		parts := make([]string, 0, len(r.Fields))
+		for k, v := range r.Fields {
+			parts = append(parts, k+"="+v)
+		}
+		sort.Strings(parts)
+		fields = " {" + strings.Join(parts, ", ") + "}"
+	}
+	return fmt.Sprintf("[%s] %s %s%s\n", r.Level, r.Time.Format("2006-01-02 15:04:05"), r.Message, fields), nil
+}
+
+// prune removes backup files older than maxAge or beyond maxBackups,
+// keeping the most recent ones.
+func (s *FileSink) prune() {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return
+	}
+
+	type fileInfo struct {
+		path    string
+		modTime time.Time
+	}
+	var backups []fileInfo
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasPrefix(e.Name(), "ech-wk-") {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		backups = append(backups, fileInfo{path: filepath.Join(s.dir, e.Name()), modTime: info.ModTime()})
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].modTime.After(backups[j].modTime) })
+
+	cutoff := time.Now().Add(-s.maxAge)
+	for i, b := range backups {
+		if i >= s.maxBackups || b.modTime.Before(cutoff) {
+			os.Remove(b.path)
+		}
+	}
+}
+
+// Flush fsyncs the current file, so a crash immediately after returns
+// from this call loses no previously-written log lines. It does not
+// drain the write queue — call Close (or wait for it to empty) first
+// if pending records must be on disk too.
+func (s *FileSink) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.f == nil {
+		return nil
+	}
+	return s.f.Sync()
+}
+
+// Close stops accepting new writes, waits for the background writer
+// to drain the queue, then flushes and closes the current file.
+func (s *FileSink) Close() error {
+	close(s.queue)
+	<-s.done
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.f == nil {
+		return nil
+	}
+	err := s.f.Close()
+	s.f = nil
+	return err
+}
+
+// Bundle zips every log file under the sink's directory (current file
+// included, after an explicit Flush) into w, for a "download logs
+// bundle" support action in the UI.
+func (s *FileSink) Bundle(w io.Writer) error {
+	if err := s.Flush(); err != nil {
+		log.Printf("[日志] 打包前刷新日志文件失败: %v", err)
+	}
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return fmt.Errorf("读取日志目录失败: %w", err)
+	}
+
+	zw := zip.NewWriter(w)
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasPrefix(e.Name(), "ech-wk-") {
+			continue
+		}
+		if err := addFileToZip(zw, filepath.Join(s.dir, e.Name()), e.Name()); err != nil {
+			return fmt.Errorf("打包日志文件 %s 失败: %w", e.Name(), err)
+		}
+	}
+	return zw.Close()
+}
+
+func addFileToZip(zw *zip.Writer, path, name string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	zf, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(zf, f)
+	return err
+}
+
+// DetectLevel guesses a Record's level from a raw log line, for
+// callers (such as process.Runner's child-process output) that only
+// have an unstructured string to go on. It recognizes both this app's
+// own "[系统]"/"[错误]"/"[警告]" prefixes and the "[INFO]"/"[WARN]"/
+// "[ERROR]"/"[DEBUG]"/"[FATAL]" style prefixes an upstream child
+// process might emit; anything unrecognized defaults to "INFO".
+func DetectLevel(line string) string {
+	line = strings.TrimSpace(line)
+	upper := strings.ToUpper(line)
+	switch {
+	case strings.HasPrefix(line, "[错误]"), strings.Contains(upper, "[ERROR]"), strings.Contains(upper, "[FATAL]"):
+		return "ERROR"
+	case strings.HasPrefix(line, "[警告]"), strings.Contains(upper, "[WARN]"):
+		return "WARN"
+	case strings.HasPrefix(line, "[定时任务]"), strings.Contains(upper, "[SCHEDULE]"):
+		return "SCHEDULE"
+	case strings.HasPrefix(line, "[系统]"), strings.Contains(upper, "[SYSTEM]"):
+		return "SYSTEM"
+	case strings.Contains(upper, "[DEBUG]"):
+		return "DEBUG"
+	default:
+		return "INFO"
+	}
+}
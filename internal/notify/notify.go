@@ -0,0 +1,282 @@
+// Package notify fans connection-state events out to user-configured
+// channels (desktop toast, webhook, Telegram bot, Bark, Server酱, SMTP
+// email). It has no dependency on the ui package — the GUI wires a
+// slice of Notifiers built from config.Notify and calls
+// Manager.Dispatch from the same places it already calls appendLog.
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+)
+
+// Event is one connection-state change to report. Type is one of
+// "connected", "disconnected", "crash", "restart", "proxy-on",
+// "proxy-off", "autostart-on", "autostart-off", "log-error", "log-warn"
+// or "test".
+type Event struct {
+	Type    string
+	Server  string
+	Message string
+	Time    time.Time
+}
+
+// Notifier delivers one Event over a single channel.
+type Notifier interface {
+	Name() string
+	Notify(ev Event) error
+}
+
+// DesktopNotifier shows a native toast via fyne.App.SendNotification.
+type DesktopNotifier struct {
+	App fyne.App
+}
+
+func (n *DesktopNotifier) Name() string { return "desktop" }
+
+func (n *DesktopNotifier) Notify(ev Event) error {
+	if n.App == nil {
+		return fmt.Errorf("没有可用的应用实例")
+	}
+	n.App.SendNotification(fyne.NewNotification(titleFor(ev), ev.Message))
+	return nil
+}
+
+// WebhookNotifier POSTs a JSON body {event, server, timestamp, message}.
+type WebhookNotifier struct {
+	URL string
+}
+
+func (n *WebhookNotifier) Name() string { return "webhook" }
+
+func (n *WebhookNotifier) Notify(ev Event) error {
+	body, err := json.Marshal(struct {
+		Event     string `json:"event"`
+		Server    string `json:"server"`
+		Timestamp string `json:"timestamp"`
+		Message   string `json:"message"`
+	}{ev.Type, ev.Server, ev.Time.Format(time.RFC3339), ev.Message})
+	if err != nil {
+		return err
+	}
+	resp, err := http.Post(n.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook 返回状态码 %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// TelegramNotifier sends a message via the Telegram Bot API.
+type TelegramNotifier struct {
+	BotToken string
+	ChatID   string
+}
+
+func (n *TelegramNotifier) Name() string { return "telegram" }
+
+func (n *TelegramNotifier) Notify(ev Event) error {
+	api := fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage", n.BotToken)
+	form := url.Values{
+		"chat_id": {n.ChatID},
+		"text":    {fmt.Sprintf("%s\n%s", titleFor(ev), ev.Message)},
+	}
+	resp, err := http.PostForm(api, form)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("telegram 返回状态码 %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// BarkNotifier pushes a notification via the Bark iOS app's server API
+// (https://api.day.app/<key>/<title>/<body>).
+type BarkNotifier struct {
+	ServerURL string // base URL, e.g. "https://api.day.app"; empty uses the default
+	Key       string
+}
+
+func (n *BarkNotifier) Name() string { return "bark" }
+
+func (n *BarkNotifier) Notify(ev Event) error {
+	base := n.ServerURL
+	if base == "" {
+		base = "https://api.day.app"
+	}
+	api := fmt.Sprintf("%s/%s/%s/%s", strings.TrimRight(base, "/"),
+		url.PathEscape(n.Key), url.PathEscape(titleFor(ev)), url.PathEscape(ev.Message))
+	resp, err := http.Get(api)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("bark 返回状态码 %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// ServerChanNotifier pushes a notification via Server酱 (sctapi.ftqq.com).
+type ServerChanNotifier struct {
+	SendKey string
+}
+
+func (n *ServerChanNotifier) Name() string { return "serverchan" }
+
+func (n *ServerChanNotifier) Notify(ev Event) error {
+	api := fmt.Sprintf("https://sctapi.ftqq.com/%s.send", n.SendKey)
+	form := url.Values{
+		"title": {titleFor(ev)},
+		"desp":  {ev.Message},
+	}
+	resp, err := http.PostForm(api, form)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("server酱 返回状态码 %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// SMTPNotifier sends a plain-text email via net/smtp.
+type SMTPNotifier struct {
+	Host string
+	Port int
+	User string
+	Pass string
+	From string
+	To   []string
+}
+
+func (n *SMTPNotifier) Name() string { return "smtp" }
+
+func (n *SMTPNotifier) Notify(ev Event) error {
+	addr := fmt.Sprintf("%s:%d", n.Host, n.Port)
+	auth := smtp.PlainAuth("", n.User, n.Pass, n.Host)
+	msg := fmt.Sprintf("Subject: %s\r\n\r\n%s\r\n", titleFor(ev), ev.Message)
+	return smtp.SendMail(addr, auth, n.From, n.To, []byte(msg))
+}
+
+func titleFor(ev Event) string {
+	return fmt.Sprintf("ECH Workers: %s", ev.Type)
+}
+
+// MutedNotifier wraps a Notifier and silently drops events whose Type
+// is in Muted, giving each channel its own per-event-type mute list
+// independent of the Manager's global per-type rate limiter.
+type MutedNotifier struct {
+	Notifier
+	Muted map[string]bool
+}
+
+func (n *MutedNotifier) Notify(ev Event) error {
+	if n.Muted[ev.Type] {
+		return nil
+	}
+	return n.Notifier.Notify(ev)
+}
+
+// limiter enforces a minimum interval between dispatches of the same
+// event type, so a flapping backend doesn't spam every channel.
+type limiter struct {
+	mu          sync.Mutex
+	minInterval time.Duration
+	last        map[string]time.Time
+}
+
+func (l *limiter) allow(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if t, ok := l.last[key]; ok && now.Sub(t) < l.minInterval {
+		return false
+	}
+	l.last[key] = now
+	return true
+}
+
+// Manager fans an Event out to every configured Notifier, rate-limited
+// per event type. Delivery runs in background goroutines; failures are
+// reported via onError rather than returned, matching the fire-and-
+// forget style the rest of the UI uses for background work.
+type Manager struct {
+	notifiers []Notifier
+	limiter   *limiter
+	onError   func(string)
+}
+
+// NewManager builds a dispatcher for notifiers, rate-limited to at most
+// one dispatch per event type every minInterval (0 disables limiting).
+func NewManager(notifiers []Notifier, minInterval time.Duration, onError func(string)) *Manager {
+	return &Manager{
+		notifiers: notifiers,
+		limiter:   &limiter{minInterval: minInterval, last: map[string]time.Time{}},
+		onError:   onError,
+	}
+}
+
+// Dispatch sends ev to every notifier, dropping it if the same event
+// type fired too recently.
+func (m *Manager) Dispatch(ev Event) {
+	if !m.limiter.allow(ev.Type) {
+		return
+	}
+	m.send(ev)
+}
+
+// Test sends ev to every notifier immediately, bypassing the rate
+// limiter, so the "测试通知" button always fans out.
+func (m *Manager) Test(ev Event) {
+	m.send(ev)
+}
+
+// deliveryAttempts and deliveryBackoff bound the retry+backoff each
+// delivery gets before it's given up on and reported via onError.
+const (
+	deliveryAttempts = 3
+	deliveryBackoff  = 2 * time.Second
+)
+
+func (m *Manager) send(ev Event) {
+	for _, n := range m.notifiers {
+		n := n
+		go m.deliver(n, ev)
+	}
+}
+
+// deliver calls n.Notify up to deliveryAttempts times in all (the first
+// try plus deliveryAttempts-1 retries) with a doubling backoff, entirely off the caller's goroutine, so a slow or failing
+// channel never blocks Dispatch/Test.
+func (m *Manager) deliver(n Notifier, ev Event) {
+	backoff := deliveryBackoff
+	var err error
+	for attempt := 1; attempt <= deliveryAttempts; attempt++ {
+		if err = n.Notify(ev); err == nil {
+			return
+		}
+		if attempt < deliveryAttempts {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+	if m.onError != nil {
+		m.onError(fmt.Sprintf("[警告] 通知渠道 %s 发送失败（已重试 %d 次）: %v\n", n.Name(), deliveryAttempts-1, err))
+	}
+}
@@ -0,0 +1,227 @@
+// Package scheduler implements a minimal cron-style time-window
+// scheduler for automatic connect/disconnect, in the spirit of
+// robfig/cron/v3's API without pulling in the dependency: a Spec
+// parsed once from a 5-field cron expression, and a Cron engine that
+// ticks once a minute and fires rules whose Spec matches.
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var weekdayNames = map[string]time.Weekday{
+	"SUN": time.Sunday, "MON": time.Monday, "TUE": time.Tuesday,
+	"WED": time.Wednesday, "THU": time.Thursday, "FRI": time.Friday, "SAT": time.Saturday,
+}
+
+// Spec is a parsed 5-field cron expression: minute hour dom month dow.
+// Matching is a plain AND across all five fields; unlike a full cron
+// implementation this does not special-case "OR" semantics when both
+// day-of-month and day-of-week are restricted, which is enough for the
+// connect/disconnect windows this scheduler targets ("0 8 * * MON-FRI").
+type Spec struct {
+	raw     string
+	minute  map[int]bool
+	hour    map[int]bool
+	dom     map[int]bool
+	month   map[int]bool
+	weekday map[time.Weekday]bool
+}
+
+// Parse parses a 5-field cron expression ("0 8 * * MON-FRI").
+func Parse(spec string) (*Spec, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron 表达式需要 5 个字段，实际 %d 个: %q", len(fields), spec)
+	}
+
+	minute, err := parseField(fields[0], 0, 59, nil)
+	if err != nil {
+		return nil, fmt.Errorf("分钟字段无效: %w", err)
+	}
+	hour, err := parseField(fields[1], 0, 23, nil)
+	if err != nil {
+		return nil, fmt.Errorf("小时字段无效: %w", err)
+	}
+	dom, err := parseField(fields[2], 1, 31, nil)
+	if err != nil {
+		return nil, fmt.Errorf("日期字段无效: %w", err)
+	}
+	month, err := parseField(fields[3], 1, 12, nil)
+	if err != nil {
+		return nil, fmt.Errorf("月份字段无效: %w", err)
+	}
+	dowInts, err := parseField(fields[4], 0, 6, weekdayNames)
+	if err != nil {
+		return nil, fmt.Errorf("星期字段无效: %w", err)
+	}
+	weekday := make(map[time.Weekday]bool, len(dowInts))
+	for d := range dowInts {
+		weekday[time.Weekday(d%7)] = true
+	}
+
+	return &Spec{raw: spec, minute: minute, hour: hour, dom: dom, month: month, weekday: weekday}, nil
+}
+
+// parseField parses one comma-separated cron field, each part being
+// "*", a number, or a "a-b" range. names, if non-nil, additionally
+// resolves case-insensitive symbolic names (e.g. MON) before falling
+// back to numeric parsing.
+func parseField(field string, min, max int, names map[string]time.Weekday) (map[int]bool, error) {
+	out := map[int]bool{}
+	if field == "*" {
+		for i := min; i <= max; i++ {
+			out[i] = true
+		}
+		return out, nil
+	}
+
+	resolve := func(tok string) (int, error) {
+		if names != nil {
+			if d, ok := names[strings.ToUpper(tok)]; ok {
+				return int(d), nil
+			}
+		}
+		return strconv.Atoi(tok)
+	}
+
+	for _, part := range strings.Split(field, ",") {
+		if lo, hi, ok := strings.Cut(part, "-"); ok {
+			loN, err := resolve(lo)
+			if err != nil {
+				return nil, err
+			}
+			hiN, err := resolve(hi)
+			if err != nil {
+				return nil, err
+			}
+			if loN > hiN {
+				return nil, fmt.Errorf("无效范围: %s", part)
+			}
+			for i := loN; i <= hiN; i++ {
+				out[i] = true
+			}
+			continue
+		}
+		n, err := resolve(part)
+		if err != nil {
+			return nil, err
+		}
+		if n < min || n > max {
+			return nil, fmt.Errorf("值 %d 超出范围 [%d, %d]", n, min, max)
+		}
+		out[n] = true
+	}
+	return out, nil
+}
+
+// Matches reports whether t (truncated to the minute) satisfies every
+// field of the spec.
+func (s *Spec) Matches(t time.Time) bool {
+	return s.minute[t.Minute()] && s.hour[t.Hour()] &&
+		s.dom[t.Day()] && s.month[int(t.Month())] && s.weekday[t.Weekday()]
+}
+
+// Next returns the next time after `after` (exclusive) that matches
+// the spec, searching at most one year ahead.
+func (s *Spec) Next(after time.Time) (time.Time, bool) {
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	limit := after.AddDate(1, 0, 0)
+	for t.Before(limit) {
+		if s.Matches(t) {
+			return t, true
+		}
+		t = t.Add(time.Minute)
+	}
+	return time.Time{}, false
+}
+
+// Rule binds a parsed Spec to an opaque ID an engine hands back to its
+// fire callback; callers decide what the ID/action mean.
+type Rule struct {
+	ID   string
+	Spec *Spec
+}
+
+// Cron ticks once a minute and invokes onFire for every enabled rule
+// whose spec matches the current minute.
+type Cron struct {
+	mu      sync.Mutex
+	rules   []Rule
+	onFire  func(id string)
+	ticker  *time.Ticker
+	stop    chan struct{}
+	running bool
+}
+
+// New creates a Cron engine. onFire is invoked (from the engine's own
+// goroutine) once per matching rule per minute.
+func New(onFire func(id string)) *Cron {
+	return &Cron{onFire: onFire}
+}
+
+// SetRules replaces the active rule set.
+func (c *Cron) SetRules(rules []Rule) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rules = rules
+}
+
+// Start begins the once-a-minute tick loop. Calling Start twice is a no-op.
+func (c *Cron) Start() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.running {
+		return
+	}
+	c.running = true
+	c.ticker = time.NewTicker(time.Minute)
+	c.stop = make(chan struct{})
+	go c.loop(c.ticker, c.stop)
+}
+
+func (c *Cron) loop(ticker *time.Ticker, stop chan struct{}) {
+	for {
+		select {
+		case now := <-ticker.C:
+			c.fireMatching(now)
+		case <-stop:
+			ticker.Stop()
+			return
+		}
+	}
+}
+
+func (c *Cron) fireMatching(now time.Time) {
+	c.mu.Lock()
+	rules := make([]Rule, len(c.rules))
+	copy(rules, c.rules)
+	c.mu.Unlock()
+
+	for _, r := range rules {
+		if r.Spec.Matches(now) {
+			c.onFire(r.ID)
+		}
+	}
+}
+
+// RunNow fires the rule with the given id immediately, regardless of
+// its schedule, backing the UI's manual "run now" button.
+func (c *Cron) RunNow(id string) {
+	c.onFire(id)
+}
+
+// Stop halts the tick loop. Safe to call even if Start was never called.
+func (c *Cron) Stop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.running {
+		return
+	}
+	close(c.stop)
+	c.running = false
+}
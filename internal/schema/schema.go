@@ -0,0 +1,102 @@
+// Package schema defines the `ech://` server URI used inside a
+// subscription payload: one line per server, as
+// ech://<name>:<token>@<host>:<port>?ip=&ech=&dns=&listen=&routing=
+//
+// This is unrelated to internal/uri's `ech://import?...` deep-link
+// scheme — that one is handled by the OS when the user clicks a link;
+// this one appears inside subscription content fetched over HTTP (see
+// internal/subscription) and in server lists dropped onto the window
+// (see internal/importer).
+package schema
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+)
+
+// ServerURI is one parsed `ech://` subscription entry.
+type ServerURI struct {
+	Name        string
+	Token       string
+	Host        string
+	Port        string
+	IP          string
+	ECH         string
+	DNS         string
+	Listen      string
+	RoutingMode string
+}
+
+// Parse decodes raw as a `ech://` subscription server URI.
+func Parse(raw string) (*ServerURI, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("解析订阅条目失败: %w", err)
+	}
+	if u.Scheme != "ech" {
+		return nil, fmt.Errorf("不支持的协议: %s", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, errors.New("缺少服务器地址")
+	}
+
+	var name, token string
+	if u.User != nil {
+		name = u.User.Username()
+		token, _ = u.User.Password()
+	}
+
+	host := u.Hostname()
+	if host == "" {
+		return nil, errors.New("缺少服务器地址")
+	}
+
+	q := u.Query()
+	return &ServerURI{
+		Name:        name,
+		Token:       token,
+		Host:        host,
+		Port:        u.Port(),
+		IP:          q.Get("ip"),
+		ECH:         q.Get("ech"),
+		DNS:         q.Get("dns"),
+		Listen:      q.Get("listen"),
+		RoutingMode: q.Get("routing"),
+	}, nil
+}
+
+// Encode serializes s back to a `ech://` subscription server URI.
+func (s ServerURI) Encode() string {
+	host := s.Host
+	if s.Port != "" {
+		host = net.JoinHostPort(s.Host, s.Port)
+	}
+
+	u := url.URL{
+		Scheme: "ech",
+		User:   url.UserPassword(s.Name, s.Token),
+		Host:   host,
+	}
+
+	q := url.Values{}
+	if s.IP != "" {
+		q.Set("ip", s.IP)
+	}
+	if s.ECH != "" {
+		q.Set("ech", s.ECH)
+	}
+	if s.DNS != "" {
+		q.Set("dns", s.DNS)
+	}
+	if s.Listen != "" {
+		q.Set("listen", s.Listen)
+	}
+	if s.RoutingMode != "" {
+		q.Set("routing", s.RoutingMode)
+	}
+	u.RawQuery = q.Encode()
+
+	return u.String()
+}
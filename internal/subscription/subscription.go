@@ -0,0 +1,252 @@
+// Package subscription fetches and decodes a subscription URL's
+// content into a flat list of server entries. It has no dependency on
+// config.Server or the UI layer — the caller (internal/ui) maps Entry
+// onto whatever shape it persists.
+package subscription
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/juerson/ech-wk/client-gui-go/internal/schema"
+)
+
+// Entry is one server parsed out of a subscription's content.
+type Entry struct {
+	Name        string
+	Server      string // host:port
+	Listen      string
+	Token       string
+	IP          string
+	DNS         string
+	ECH         string
+	RoutingMode string
+}
+
+var httpClient = &http.Client{Timeout: 15 * time.Second}
+
+// Fetch downloads url and decodes its body via Decode.
+func Fetch(url string) ([]Entry, error) {
+	resp, err := httpClient.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("拉取订阅失败: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("订阅地址返回状态码 %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("读取订阅内容失败: %w", err)
+	}
+	return Decode(body)
+}
+
+// Decode accepts a JSON array of Entry, a Clash-style `proxies:` YAML
+// block, or a base64-encoded newline-separated list of `ech://`,
+// `vmess://`, `vless://` or `trojan://` URIs.
+func Decode(body []byte) ([]Entry, error) {
+	trimmed := strings.TrimSpace(string(body))
+	if trimmed == "" {
+		return nil, fmt.Errorf("订阅内容为空")
+	}
+
+	var entries []Entry
+	if err := json.Unmarshal([]byte(trimmed), &entries); err == nil {
+		return entries, nil
+	}
+
+	if strings.Contains(trimmed, "proxies:") {
+		if parsed, err := decodeClashYAML(trimmed); err == nil {
+			return parsed, nil
+		}
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(trimmed)
+	if err != nil {
+		return nil, fmt.Errorf("订阅内容既不是 JSON 数组、Clash YAML 也不是合法的 base64: %w", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(decoded)), "\n")
+	entries = make([]Entry, 0, len(lines))
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if e, ok := decodeURILine(line); ok {
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
+
+// decodeURILine parses one subscription line as `ech://` (the only
+// scheme this app's own Server model fully represents) or, failing
+// that, one of the common `vmess://`/`vless://`/`trojan://` formats,
+// keeping only the fields this app has a use for (address and
+// credential) and dropping the rest (AEAD cipher, transport, etc.).
+func decodeURILine(line string) (Entry, bool) {
+	if u, err := schema.Parse(line); err == nil {
+		return Entry{
+			Name:        u.Name,
+			Server:      net.JoinHostPort(u.Host, u.Port),
+			Listen:      u.Listen,
+			Token:       u.Token,
+			IP:          u.IP,
+			DNS:         u.DNS,
+			ECH:         u.ECH,
+			RoutingMode: u.RoutingMode,
+		}, true
+	}
+
+	switch {
+	case strings.HasPrefix(line, "vmess://"):
+		return decodeVMess(line)
+	case strings.HasPrefix(line, "vless://"):
+		return decodeVLESSOrTrojan(line)
+	case strings.HasPrefix(line, "trojan://"):
+		return decodeVLESSOrTrojan(line)
+	default:
+		return Entry{}, false
+	}
+}
+
+// decodeVMess parses the common `vmess://<base64 JSON>` format, where
+// the JSON blob uses the field names popularized by v2rayN (ps/add/
+// port/id).
+func decodeVMess(line string) (Entry, bool) {
+	payload, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(line, "vmess://"))
+	if err != nil {
+		if payload, err = base64.RawStdEncoding.DecodeString(strings.TrimPrefix(line, "vmess://")); err != nil {
+			return Entry{}, false
+		}
+	}
+
+	var v struct {
+		PS   string `json:"ps"`
+		Add  string `json:"add"`
+		Port string `json:"port"`
+		ID   string `json:"id"`
+		SNI  string `json:"sni"`
+	}
+	if err := json.Unmarshal(payload, &v); err != nil || v.Add == "" {
+		return Entry{}, false
+	}
+
+	return Entry{
+		Name:   v.PS,
+		Server: net.JoinHostPort(v.Add, v.Port),
+		Token:  v.ID,
+		ECH:    v.SNI,
+	}, true
+}
+
+// decodeVLESSOrTrojan parses `vless://uuid-or-password@host:port?...#name`,
+// which vless:// and trojan:// share the shape of.
+func decodeVLESSOrTrojan(line string) (Entry, bool) {
+	u, err := url.Parse(line)
+	if err != nil || u.Host == "" || u.User == nil {
+		return Entry{}, false
+	}
+
+	name := u.Fragment
+	sni := u.Query().Get("sni")
+	return Entry{
+		Name:   name,
+		Server: u.Host,
+		Token:  u.User.Username(),
+		ECH:    sni,
+	}, true
+}
+
+// decodeClashYAML handles the common Clash-style proxy list export: a
+// top-level `proxies:` key followed by a block sequence of flat maps
+// (`- name: ...` / `  server: ...` / ...). This is not a general YAML
+// parser - anchors, nested structures and multi-document files are out
+// of scope - matching the same convention internal/importer.
+// parseSimpleYAML already uses for dropped-file imports.
+func decodeClashYAML(content string) ([]Entry, error) {
+	var items []map[string]string
+	var cur map[string]string
+	inProxies := false
+
+	for _, raw := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(strings.TrimRight(raw, "\r"))
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if !inProxies {
+			if trimmed == "proxies:" {
+				inProxies = true
+			}
+			continue
+		}
+		if strings.HasPrefix(trimmed, "- ") {
+			if cur != nil {
+				items = append(items, cur)
+			}
+			cur = map[string]string{}
+			trimmed = strings.TrimPrefix(trimmed, "- ")
+		} else if cur == nil {
+			continue
+		}
+		kv := strings.SplitN(trimmed, ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		cur[strings.TrimSpace(kv[0])] = strings.Trim(strings.TrimSpace(kv[1]), `"'`)
+	}
+	if cur != nil {
+		items = append(items, cur)
+	}
+	if len(items) == 0 {
+		return nil, fmt.Errorf("未找到 proxies 列表")
+	}
+
+	entries := make([]Entry, 0, len(items))
+	for _, m := range items {
+		host := m["server"]
+		if host == "" {
+			continue
+		}
+		server := host
+		if port, err := strconv.Atoi(m["port"]); err == nil && port > 0 {
+			server = net.JoinHostPort(host, m["port"])
+		}
+		ech := m["ech-config"]
+		if ech == "" {
+			ech = m["sni"]
+		}
+		entries = append(entries, Entry{
+			Name:   m["name"],
+			Server: server,
+			Token:  m["uuid"],
+			ECH:    ech,
+		})
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("未解析出任何服务器条目")
+	}
+	return entries, nil
+}
+
+// StableID derives a server's ID from (server, token, ech) so repeated
+// fetches of the same subscription update that entry via UpsertServer
+// in place rather than duplicating it, even if the subscription's
+// ordering or cosmetic fields (name, listen, ...) change between
+// fetches.
+func StableID(server, token, ech string) string {
+	h := sha1.Sum([]byte(server + "\x00" + token + "\x00" + ech))
+	return hex.EncodeToString(h[:])
+}
@@ -5,16 +5,182 @@ package sysproxy
 import (
 	"fmt"
 	"os/exec"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
-// Network service name usually "Wi-Fi" or "Ethernet".
-func getPrimaryService() string {
-	return "Wi-Fi"
+// serviceCacheTTL bounds how long getActiveServices' result is reused,
+// so a laptop that moves between Wi-Fi and Ethernet picks up the change
+// within a few seconds without shelling out on every call.
+//
+// Invalidation here is TTL-only: SCDynamicStore change notifications
+// would let us invalidate immediately on a real network switch, but that
+// needs cgo bindings this build doesn't have, so a stale entry can lag
+// an actual switch by up to serviceCacheTTL.
+const serviceCacheTTL = 5 * time.Second
+
+// OnlyPrimaryService restricts Set/SetPAC to the single network service
+// carrying the default route instead of every active one. Off by
+// default, since a laptop that moves between Wi-Fi and Ethernet (or has
+// both up at once, e.g. Thunderbolt Bridge) needs every active service
+// updated to keep working no matter which interface wins.
+var OnlyPrimaryService = false
+
+var (
+	serviceCacheMu  sync.Mutex
+	serviceCache    []string
+	serviceCachedAt time.Time
+)
+
+// getActiveServices returns the network services Set/SetPAC/IsEnabled/
+// CurrentServer should target: every service with an IP address
+// (-listnetworkserviceorder order), with the one carrying the default
+// route first - or just that one if OnlyPrimaryService is set. Replaces
+// the previous hardcoded "Wi-Fi", which silently did nothing on
+// Ethernet-only machines, Thunderbolt Bridge, USB tethering, or a
+// renamed Wi-Fi service.
+func getActiveServices() []string {
+	serviceCacheMu.Lock()
+	if serviceCache != nil && time.Since(serviceCachedAt) < serviceCacheTTL {
+		cached := serviceCache
+		serviceCacheMu.Unlock()
+		return cached
+	}
+	serviceCacheMu.Unlock()
+
+	services := discoverActiveServices()
+
+	serviceCacheMu.Lock()
+	serviceCache = services
+	serviceCachedAt = time.Now()
+	serviceCacheMu.Unlock()
+
+	return services
+}
+
+func discoverActiveServices() []string {
+	names := listNetworkServiceOrder()
+	primary := primaryServiceName(names)
+
+	var active []string
+	if primary != "" {
+		active = append(active, primary)
+	}
+	if !OnlyPrimaryService {
+		for _, name := range names {
+			if name == primary {
+				continue
+			}
+			if serviceHasIP(name) {
+				active = append(active, name)
+			}
+		}
+	}
+	if len(active) == 0 {
+		// Last-resort fallback matching the old hardcoded behavior, in
+		// case discovery itself failed (networksetup/route missing).
+		active = []string{"Wi-Fi"}
+	}
+	return active
+}
+
+// listNetworkServiceOrder parses `networksetup -listnetworkserviceorder`,
+// which interleaves "(N) <name>" header lines with indented "(Hardware
+// Port: ...)" lines; only the "(N) <name>" lines name an actual service.
+func listNetworkServiceOrder() []string {
+	out, err := exec.Command("networksetup", "-listnetworkserviceorder").Output()
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, line := range strings.Split(string(out), "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "(") {
+			continue
+		}
+		end := strings.Index(line, ")")
+		if end < 0 {
+			continue
+		}
+		if _, err := strconv.Atoi(strings.TrimSpace(line[1:end])); err != nil {
+			continue
+		}
+		names = append(names, strings.TrimSpace(line[end+1:]))
+	}
+	return names
+}
+
+// primaryServiceName cross-references `route -n get default`'s interface
+// against each service's `networksetup -getinfo` Device line to find
+// which service actually carries the default route.
+func primaryServiceName(names []string) string {
+	out, err := exec.Command("route", "-n", "get", "default").Output()
+	if err != nil {
+		return ""
+	}
+	var iface string
+	for _, line := range strings.Split(string(out), "\n") {
+		line = strings.TrimSpace(line)
+		if after, ok := strings.CutPrefix(line, "interface:"); ok {
+			iface = strings.TrimSpace(after)
+			break
+		}
+	}
+	if iface == "" {
+		return ""
+	}
+	for _, name := range names {
+		if serviceDevice(name) == iface {
+			return name
+		}
+	}
+	return ""
+}
+
+func serviceDevice(name string) string {
+	out, err := exec.Command("networksetup", "-getinfo", name).Output()
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		line = strings.TrimSpace(line)
+		if after, ok := strings.CutPrefix(line, "Device:"); ok {
+			return strings.TrimSpace(after)
+		}
+	}
+	return ""
+}
+
+// serviceHasIP reports whether `networksetup -getinfo` shows a non-empty,
+// non-"none" IP address for name.
+func serviceHasIP(name string) bool {
+	out, err := exec.Command("networksetup", "-getinfo", name).Output()
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		line = strings.TrimSpace(line)
+		if after, ok := strings.CutPrefix(line, "IP address:"); ok {
+			ip := strings.TrimSpace(after)
+			return ip != "" && ip != "none"
+		}
+	}
+	return false
 }
 
 func Set(enabled bool, listenAddr string) error {
-	service := getPrimaryService()
+	var firstErr error
+	for _, service := range getActiveServices() {
+		if err := setForService(service, enabled, listenAddr); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func setForService(service string, enabled bool, listenAddr string) error {
 	if !enabled {
 		_ = exec.Command("networksetup", "-setwebproxystate", service, "off").Run()
 		_ = exec.Command("networksetup", "-setsecurewebproxystate", service, "off").Run()
@@ -28,10 +194,10 @@ func Set(enabled bool, listenAddr string) error {
 	}
 
 	if err := exec.Command("networksetup", "-setwebproxy", service, host, port).Run(); err != nil {
-		return fmt.Errorf("failed to set web proxy: %v", err)
+		return fmt.Errorf("为网络服务 %s 设置网页代理失败: %v", service, err)
 	}
 	if err := exec.Command("networksetup", "-setsecurewebproxy", service, host, port).Run(); err != nil {
-		return fmt.Errorf("failed to set secure web proxy: %v", err)
+		return fmt.Errorf("为网络服务 %s 设置安全网页代理失败: %v", service, err)
 	}
 	return nil
 }
@@ -44,10 +210,77 @@ func splitHostPort(addr string) (string, string) {
 	return "127.0.0.1", "8080"
 }
 
+// IsEnabled reports whether the web proxy is on for the primary active
+// network service (see getActiveServices).
 func IsEnabled() (bool, error) {
+	services := getActiveServices()
+	if len(services) == 0 {
+		return false, nil
+	}
+	out, err := exec.Command("networksetup", "-getwebproxy", services[0]).Output()
+	if err != nil {
+		return false, err
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		line = strings.TrimSpace(line)
+		if after, ok := strings.CutPrefix(line, "Enabled:"); ok {
+			return strings.TrimSpace(after) == "Yes", nil
+		}
+	}
 	return false, nil
 }
 
+// CurrentServer returns the web proxy address configured on the primary
+// active network service, or "" if none is set.
 func CurrentServer() (string, error) {
-	return "", nil
+	services := getActiveServices()
+	if len(services) == 0 {
+		return "", nil
+	}
+	out, err := exec.Command("networksetup", "-getwebproxy", services[0]).Output()
+	if err != nil {
+		return "", err
+	}
+	var server, port string
+	for _, line := range strings.Split(string(out), "\n") {
+		line = strings.TrimSpace(line)
+		if after, ok := strings.CutPrefix(line, "Server:"); ok {
+			server = strings.TrimSpace(after)
+		} else if after, ok := strings.CutPrefix(line, "Port:"); ok {
+			port = strings.TrimSpace(after)
+		}
+	}
+	if server == "" {
+		return "", nil
+	}
+	return server + ":" + port, nil
+}
+
+// ActiveServiceNames exposes getActiveServices' result so the GUI can
+// show which network service(s) are actually being driven.
+func ActiveServiceNames() []string {
+	return getActiveServices()
+}
+
+// SetPAC points every active network service (or just the primary one,
+// see OnlyPrimaryService) at pacURL (ModePAC); an empty pacURL turns
+// auto-proxy-config back off.
+func SetPAC(pacURL string) error {
+	var firstErr error
+	for _, service := range getActiveServices() {
+		if err := setPACForService(service, pacURL); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func setPACForService(service, pacURL string) error {
+	if pacURL == "" {
+		return exec.Command("networksetup", "-setautoproxystate", service, "off").Run()
+	}
+	if err := exec.Command("networksetup", "-setautoproxyurl", service, pacURL).Run(); err != nil {
+		return fmt.Errorf("为网络服务 %s 设置 PAC 地址失败: %v", service, err)
+	}
+	return exec.Command("networksetup", "-setautoproxystate", service, "on").Run()
 }
@@ -44,3 +44,18 @@ func IsEnabled() (bool, error) {
 func CurrentServer() (string, error) {
 	return "", nil
 }
+
+// SetPAC switches GNOME's proxy schema to mode='auto' with
+// autoconfig-url=pacURL (ModePAC); an empty pacURL sets mode='none'.
+func SetPAC(pacURL string) error {
+	if _, err := exec.LookPath("gsettings"); err != nil {
+		return fmt.Errorf("gsettings not found")
+	}
+	if pacURL == "" {
+		return exec.Command("gsettings", "set", "org.gnome.system.proxy", "mode", "none").Run()
+	}
+	if err := exec.Command("gsettings", "set", "org.gnome.system.proxy", "autoconfig-url", pacURL).Run(); err != nil {
+		return fmt.Errorf("failed to set autoconfig-url: %v", err)
+	}
+	return exec.Command("gsettings", "set", "org.gnome.system.proxy", "mode", "auto").Run()
+}
@@ -0,0 +1,24 @@
+package sysproxy
+
+// Mode selects how the OS is told to route traffic: a blanket
+// HTTP/HTTPS proxy (ModeGlobal, via Set), a generated PAC script
+// (ModePAC, via SetPAC/PACServer) or no system-level proxy at all
+// (ModeOff, via Set(false, "")).
+type Mode int
+
+const (
+	ModeOff Mode = iota
+	ModeGlobal
+	ModePAC
+)
+
+func (m Mode) String() string {
+	switch m {
+	case ModeGlobal:
+		return "global"
+	case ModePAC:
+		return "pac"
+	default:
+		return "off"
+	}
+}
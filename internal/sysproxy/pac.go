@@ -0,0 +1,111 @@
+package sysproxy
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// PACConfig controls the generated proxy.pac's FindProxyForURL.
+type PACConfig struct {
+	ListenAddr  string   // proxy to hand out, e.g. "127.0.0.1:30000"
+	RoutingMode string   // same values as core.ProxyConfig.RoutingMode: "global", "bypass_cn", "none"
+	Bypass      []string // extra entries that always go DIRECT: domain wildcards (shExpMatch) or IP-CIDRs (isInNet), told apart by net.ParseCIDR - see script
+}
+
+// PACServer serves a generated proxy.pac over a tiny loopback-only HTTP
+// listener, so the OS (or any PAC-aware browser) can pull routing rules
+// instead of ECH Workers's own PAC mode intercepting every request via
+// a blanket system proxy.
+type PACServer struct {
+	cfg PACConfig
+	ln  net.Listener
+	srv *http.Server
+}
+
+// NewPACServer builds a PACServer; call Start to bind and begin serving.
+func NewPACServer(cfg PACConfig) *PACServer {
+	return &PACServer{cfg: cfg}
+}
+
+// Start binds an ephemeral loopback port and begins serving proxy.pac.
+func (p *PACServer) Start() error {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return fmt.Errorf("启动 PAC 服务器失败: %w", err)
+	}
+	p.ln = ln
+	mux := http.NewServeMux()
+	mux.HandleFunc("/proxy.pac", p.serve)
+	p.srv = &http.Server{Handler: mux}
+	go p.srv.Serve(ln)
+	return nil
+}
+
+// URL returns the proxy.pac URL to hand to the OS, or "" if not started.
+func (p *PACServer) URL() string {
+	if p.ln == nil {
+		return ""
+	}
+	return fmt.Sprintf("http://%s/proxy.pac", p.ln.Addr().String())
+}
+
+// Stop shuts down the PAC HTTP listener.
+func (p *PACServer) Stop() error {
+	if p.srv == nil {
+		return nil
+	}
+	return p.srv.Close()
+}
+
+func (p *PACServer) serve(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/x-ns-proxy-autoconfig")
+	_, _ = w.Write([]byte(p.script()))
+}
+
+// script renders FindProxyForURL. LAN/intranet hosts and the bypass
+// list always resolve DIRECT; everything else goes through ListenAddr.
+//
+// RoutingMode "bypass_cn" is treated the same as "global" here: telling
+// mainland-China destinations apart needs the GeoIP/CIDR data the
+// embedded core.ProxyServer already carries, which isn't duplicated
+// into this script. Routing that's actually CN-aware still happens in
+// the proxy itself; PAC mode here only decides whether traffic reaches
+// it at all.
+func (p *PACServer) script() string {
+	if p.cfg.RoutingMode == "none" {
+		return "function FindProxyForURL(url, host) {\n    return \"DIRECT\";\n}\n"
+	}
+
+	host, port := splitHostPort(p.cfg.ListenAddr)
+	proxyLine := fmt.Sprintf("SOCKS5 %s:%s; PROXY %s:%s", host, port, host, port)
+
+	// Each Bypass entry is either an IP-CIDR (isInNet) or a domain
+	// wildcard (shExpMatch); net.ParseCIDR tells them apart so callers
+	// don't need a separate field for the two shapes.
+	var bypass strings.Builder
+	for _, b := range p.cfg.Bypass {
+		if b = strings.TrimSpace(b); b == "" {
+			continue
+		}
+		if _, ipNet, err := net.ParseCIDR(b); err == nil {
+			mask := net.IP(ipNet.Mask).String()
+			fmt.Fprintf(&bypass, "    if (isInNet(host, %q, %q)) return \"DIRECT\";\n", ipNet.IP.String(), mask)
+			continue
+		}
+		fmt.Fprintf(&bypass, "    if (shExpMatch(host, %q)) return \"DIRECT\";\n", b)
+	}
+
+	return fmt.Sprintf(`function FindProxyForURL(url, host) {
+    if (isPlainHostName(host) || shExpMatch(host, "*.local") ||
+        isInNet(host, "10.0.0.0", "255.0.0.0") ||
+        isInNet(host, "172.16.0.0", "255.240.0.0") ||
+        isInNet(host, "192.168.0.0", "255.255.0.0") ||
+        isInNet(host, "127.0.0.0", "255.0.0.0")) {
+        return "DIRECT";
+    }
+%s    return "%s";
+}
+`, bypass.String(), proxyLine)
+}
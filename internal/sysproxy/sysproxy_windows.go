@@ -0,0 +1,155 @@
+//go:build windows
+
+package sysproxy
+
+import (
+	"fmt"
+	"syscall"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+const (
+	internetSettingsKeyPath = `Software\Microsoft\Windows\CurrentVersion\Internet Settings`
+
+	internetOptionSettingsChanged = 39
+	internetOptionRefresh         = 37
+)
+
+var (
+	wininet                = syscall.NewLazyDLL("wininet.dll")
+	procInternetSetOptionW = wininet.NewProc("InternetSetOptionW")
+)
+
+// notifyWinINet tells every WinINet-based process (Edge, IE, and Chrome,
+// which shares WinINet's proxy settings) to re-read the registry values
+// we just wrote, so the change takes effect without a restart.
+func notifyWinINet() {
+	procInternetSetOptionW.Call(0, internetOptionSettingsChanged, 0, 0)
+	procInternetSetOptionW.Call(0, internetOptionRefresh, 0, 0)
+}
+
+// Set writes ProxyEnable/ProxyServer, plus ProxyOverride "<local>" (via
+// SetWithBypass), under HKCU\...\Internet Settings and notifies WinINet.
+// Disabling only clears ProxyEnable, matching how Windows' own "Use a
+// proxy server" toggle behaves - ProxyServer/ProxyOverride are left in
+// place so re-enabling restores the same address.
+func Set(enabled bool, listenAddr string) error {
+	return SetWithBypass(enabled, listenAddr, "<local>")
+}
+
+// SetWithBypass is Set with an explicit ProxyOverride bypass list
+// (semicolon-separated hosts/CIDRs; "<local>" bypasses intranet sites).
+func SetWithBypass(enabled bool, listenAddr, bypass string) error {
+	k, err := registry.OpenKey(registry.CURRENT_USER, internetSettingsKeyPath, registry.SET_VALUE)
+	if err != nil {
+		return fmt.Errorf("打开注册表项失败: %w", err)
+	}
+	defer k.Close()
+
+	if !enabled {
+		if err := k.SetDWordValue("ProxyEnable", 0); err != nil {
+			return fmt.Errorf("写入 ProxyEnable 失败: %w", err)
+		}
+		notifyWinINet()
+		return nil
+	}
+
+	host, port := splitHostPort(listenAddr)
+	server := fmt.Sprintf("%s:%s", host, port)
+
+	if err := k.SetStringValue("ProxyServer", server); err != nil {
+		return fmt.Errorf("写入 ProxyServer 失败: %w", err)
+	}
+	if bypass != "" {
+		if err := k.SetStringValue("ProxyOverride", bypass); err != nil {
+			return fmt.Errorf("写入 ProxyOverride 失败: %w", err)
+		}
+	}
+	// Clear any PAC url left over from ModePAC so it doesn't take
+	// priority over the global proxy we're about to enable.
+	if err := k.DeleteValue("AutoConfigURL"); err != nil && err != registry.ErrNotExist {
+		return fmt.Errorf("删除 AutoConfigURL 失败: %w", err)
+	}
+	if err := k.SetDWordValue("ProxyEnable", 1); err != nil {
+		return fmt.Errorf("写入 ProxyEnable 失败: %w", err)
+	}
+	notifyWinINet()
+	return nil
+}
+
+func splitHostPort(addr string) (string, string) {
+	host, port := "127.0.0.1", "8080"
+	for i := len(addr) - 1; i >= 0; i-- {
+		if addr[i] == ':' {
+			host, port = addr[:i], addr[i+1:]
+			break
+		}
+	}
+	if host == "" {
+		host = "127.0.0.1"
+	}
+	return host, port
+}
+
+// SetPAC writes AutoConfigURL under Internet Settings and notifies
+// WinINet (ModePAC). An empty pacURL deletes AutoConfigURL instead.
+// ProxyEnable is cleared either way so a stale global-proxy setting
+// doesn't fight with the PAC script.
+func SetPAC(pacURL string) error {
+	k, err := registry.OpenKey(registry.CURRENT_USER, internetSettingsKeyPath, registry.SET_VALUE)
+	if err != nil {
+		return fmt.Errorf("打开注册表项失败: %w", err)
+	}
+	defer k.Close()
+
+	if err := k.SetDWordValue("ProxyEnable", 0); err != nil {
+		return fmt.Errorf("写入 ProxyEnable 失败: %w", err)
+	}
+
+	if pacURL == "" {
+		if err := k.DeleteValue("AutoConfigURL"); err != nil && err != registry.ErrNotExist {
+			return fmt.Errorf("删除 AutoConfigURL 失败: %w", err)
+		}
+		notifyWinINet()
+		return nil
+	}
+
+	if err := k.SetStringValue("AutoConfigURL", pacURL); err != nil {
+		return fmt.Errorf("写入 AutoConfigURL 失败: %w", err)
+	}
+	notifyWinINet()
+	return nil
+}
+
+func IsEnabled() (bool, error) {
+	k, err := registry.OpenKey(registry.CURRENT_USER, internetSettingsKeyPath, registry.QUERY_VALUE)
+	if err != nil {
+		return false, err
+	}
+	defer k.Close()
+	v, _, err := k.GetIntegerValue("ProxyEnable")
+	if err != nil {
+		if err == registry.ErrNotExist {
+			return false, nil
+		}
+		return false, err
+	}
+	return v != 0, nil
+}
+
+func CurrentServer() (string, error) {
+	k, err := registry.OpenKey(registry.CURRENT_USER, internetSettingsKeyPath, registry.QUERY_VALUE)
+	if err != nil {
+		return "", err
+	}
+	defer k.Close()
+	v, _, err := k.GetStringValue("ProxyServer")
+	if err != nil {
+		if err == registry.ErrNotExist {
+			return "", nil
+		}
+		return "", err
+	}
+	return v, nil
+}
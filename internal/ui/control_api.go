@@ -0,0 +1,242 @@
+package ui
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"github.com/juerson/ech-wk/client-gui-go/internal/config"
+	"github.com/juerson/ech-wk/client-gui-go/internal/control"
+)
+
+// initRemoteControl wires the "启用远程控制" checkbox and, if the
+// persisted setting was on, starts the control API immediately.
+func (mw *MainWindow) initRemoteControl() {
+	mw.controlBroker = control.NewBroker()
+
+	mw.remoteCheck = widget.NewCheck("启用远程控制", func(bool) {
+		mw.onRemoteControlChanged()
+	})
+	mw.remoteCheck.SetChecked(mw.cfg.Model.RemoteControl.Enabled)
+
+	if mw.cfg.Model.RemoteControl.Enabled {
+		if err := mw.startRemoteControl(); err != nil {
+			log.Printf("警告: 启动远程控制 API 失败: %v", err)
+			mw.remoteCheck.SetChecked(false)
+			mw.cfg.Model.RemoteControl.Enabled = false
+		}
+	}
+}
+
+func (mw *MainWindow) onRemoteControlChanged() {
+	enabled := mw.remoteCheck.Checked
+	if !enabled {
+		mw.stopRemoteControl()
+		mw.cfg.Model.RemoteControl.Enabled = false
+		_ = mw.cfg.Save()
+		mw.appendLog("[系统] 已关闭远程控制 API\n")
+		return
+	}
+
+	if mw.cfg.Model.RemoteControl.BindAddr == "" || mw.cfg.Model.RemoteControl.Token == "" {
+		mw.showRemoteControlForm()
+		return
+	}
+	if err := mw.startRemoteControl(); err != nil {
+		mw.remoteCheck.SetChecked(false)
+		dialog.ShowError(err, mw.w)
+		return
+	}
+	mw.cfg.Model.RemoteControl.Enabled = true
+	_ = mw.cfg.Save()
+}
+
+// showRemoteControlForm asks for a bind address and token before the
+// API is first enabled (or to change them later).
+func (mw *MainWindow) showRemoteControlForm() {
+	bindEntry := widget.NewEntry()
+	bindEntry.SetText(mw.cfg.Model.RemoteControl.BindAddr)
+	bindEntry.SetPlaceHolder("127.0.0.1:47900")
+	tokenEntry := widget.NewEntry()
+	tokenEntry.SetText(mw.cfg.Model.RemoteControl.Token)
+	tokenEntry.SetPlaceHolder("访问令牌")
+
+	form := widget.NewForm(
+		widget.NewFormItem("监听地址", bindEntry),
+		widget.NewFormItem("访问令牌", tokenEntry),
+	)
+	d := dialog.NewForm("远程控制设置", "确定", "取消", form.Items, func(ok bool) {
+		if !ok {
+			mw.remoteCheck.SetChecked(false)
+			return
+		}
+		bind := strings.TrimSpace(bindEntry.Text)
+		token := strings.TrimSpace(tokenEntry.Text)
+		if bind == "" || token == "" {
+			dialog.ShowError(errors.New("监听地址和访问令牌都不能为空"), mw.w)
+			mw.remoteCheck.SetChecked(false)
+			return
+		}
+		mw.cfg.Model.RemoteControl.BindAddr = bind
+		mw.cfg.Model.RemoteControl.Token = token
+		if err := mw.startRemoteControl(); err != nil {
+			mw.remoteCheck.SetChecked(false)
+			dialog.ShowError(err, mw.w)
+			return
+		}
+		mw.cfg.Model.RemoteControl.Enabled = true
+		_ = mw.cfg.Save()
+	}, mw.w)
+	d.Resize(fyne.NewSize(420, 180))
+	d.Show()
+}
+
+func (mw *MainWindow) startRemoteControl() error {
+	mw.stopRemoteControl()
+
+	srv := control.New(mw.cfg.Model.RemoteControl.BindAddr, mw.cfg.Model.RemoteControl.Token, mw.controlBroker, mw.controlHandlers())
+	errCh := srv.Start()
+	select {
+	case err := <-errCh:
+		return fmt.Errorf("监听 %s 失败: %w", mw.cfg.Model.RemoteControl.BindAddr, err)
+	case <-time.After(200 * time.Millisecond):
+		// No immediate listen error; assume it came up.
+	}
+	mw.controlServer = srv
+	mw.appendLog(fmt.Sprintf("[系统] 远程控制 API 已在 %s 启动\n", mw.cfg.Model.RemoteControl.BindAddr))
+	return nil
+}
+
+func (mw *MainWindow) stopRemoteControl() {
+	if mw.controlServer == nil {
+		return
+	}
+	_ = mw.controlServer.Stop()
+	mw.controlServer = nil
+}
+
+// controlHandlers binds the control API to the exact same code paths
+// the Fyne UI's own buttons use. Start/Stop have no synchronous error
+// return in this codebase (failures surface via dialog.ShowError), so
+// these handlers report "request accepted" rather than "succeeded" —
+// callers should poll GET /status to confirm the outcome.
+func (mw *MainWindow) controlHandlers() control.Handlers {
+	return control.Handlers{
+		ListServers: func() []control.ServerSummary {
+			out := make([]control.ServerSummary, 0, len(mw.cfg.Model.Servers))
+			for _, s := range mw.cfg.Model.Servers {
+				out = append(out, control.ServerSummary{ID: s.ID, Name: s.Name})
+			}
+			return out
+		},
+		StartServer: func(id string) error {
+			if id != "" {
+				found := false
+				for _, s := range mw.cfg.Model.Servers {
+					if s.ID == id {
+						found = true
+						break
+					}
+				}
+				if !found {
+					return fmt.Errorf("未找到服务器: %s", id)
+				}
+				mw.cfg.SetCurrentServer(id)
+				_ = mw.cfg.Save()
+			}
+			fyne.Do(func() {
+				mw.loadCurrentToForm()
+				mw.onStart()
+			})
+			return nil
+		},
+		StopServer: func() error {
+			fyne.Do(func() {
+				mw.shutdown()
+			})
+			return nil
+		},
+		Status: func() control.StatusSnapshot {
+			cur, _ := mw.cfg.GetCurrentServer()
+			return control.StatusSnapshot{
+				Running:            mw.running,
+				CurrentServerID:    cur.ID,
+				CurrentServerName:  cur.Name,
+				SystemProxyEnabled: mw.systemProxyEnabled,
+			}
+		},
+		SetSystemProxy: func(enabled bool) error {
+			fyne.Do(func() {
+				mw.setProxyCheckSilently(enabled)
+				mw.onProxyChanged()
+			})
+			return nil
+		},
+		SetCurrentServer: func(id string) error {
+			found := false
+			for _, s := range mw.cfg.Model.Servers {
+				if s.ID == id {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return fmt.Errorf("未找到服务器: %s", id)
+			}
+			if mw.running {
+				return fmt.Errorf("代理运行中，无法切换服务器")
+			}
+			fyne.Do(func() {
+				mw.saveFormToCurrent(false)
+				mw.cfg.SetCurrentServer(id)
+				_ = mw.cfg.Save()
+				mw.loadCurrentToForm()
+				mw.refreshServerSelect()
+			})
+			return nil
+		},
+		SetRouting: func(mode string) error {
+			valid := false
+			for _, opt := range mw.routing.Options {
+				if opt == mode {
+					valid = true
+					break
+				}
+			}
+			if !valid {
+				return fmt.Errorf("未知分流模式: %s", mode)
+			}
+			fyne.Do(func() {
+				mw.routing.SetSelected(mode)
+			})
+			return nil
+		},
+		GetConfig: func() ([]byte, error) {
+			return json.MarshalIndent(mw.cfg.Model, "", "  ")
+		},
+		SetConfig: func(raw []byte) error {
+			var model config.FileModel
+			if err := json.Unmarshal(raw, &model); err != nil {
+				return fmt.Errorf("解析配置失败: %w", err)
+			}
+			fyne.Do(func() {
+				mw.cfg.Model = model
+				if err := mw.cfg.Save(); err != nil {
+					mw.appendLog(fmt.Sprintf("[错误] 远程控制 API 替换配置失败: %v\n", err))
+					return
+				}
+				mw.refreshServerSelect()
+				mw.loadCurrentToForm()
+				mw.rebuildCronRules()
+			})
+			return nil
+		},
+	}
+}
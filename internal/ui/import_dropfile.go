@@ -0,0 +1,130 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"github.com/juerson/ech-wk/client-gui-go/internal/config"
+	"github.com/juerson/ech-wk/client-gui-go/internal/importer"
+)
+
+// handleDroppedFile is registered via fyne.Window.SetOnDropped; it
+// reads the dropped file, detects its format (native JSON, `ech://`
+// lines, or a compatibility export) and opens the import preview.
+func (mw *MainWindow) handleDroppedFile(u fyne.URI) {
+	path := u.Path()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		mw.appendLog(fmt.Sprintf("[错误] 读取拖放文件失败: %v\n", err))
+		return
+	}
+
+	candidates, err := importer.DetectAndParse(filepath.Base(path), data)
+	if err != nil {
+		fyne.Do(func() {
+			dialog.ShowError(fmt.Errorf("无法解析拖放的文件 %s: %w", filepath.Base(path), err), mw.w)
+		})
+		return
+	}
+
+	fyne.Do(func() {
+		mw.showImportPreview(candidates)
+	})
+}
+
+// showImportPreview lists candidates with per-row import/skip
+// checkboxes and a shared conflict-resolution choice, applied to every
+// checked row that collides with an existing server by name.
+func (mw *MainWindow) showImportPreview(candidates []importer.Candidate) {
+	checks := make([]*widget.Check, len(candidates))
+	rows := make([]fyne.CanvasObject, 0, len(candidates))
+	for i, c := range candidates {
+		label := c.Name
+		if label == "" {
+			label = c.Server
+		}
+		chk := widget.NewCheck(fmt.Sprintf("%s  (%s)", label, c.Server), nil)
+		chk.SetChecked(true)
+		checks[i] = chk
+		rows = append(rows, chk)
+	}
+
+	scroll := container.NewVScroll(container.NewVBox(rows...))
+	scroll.SetMinSize(fyne.NewSize(420, 260))
+
+	resolution := widget.NewSelect([]string{"覆盖同名", "重命名", "跳过"}, nil)
+	resolution.SetSelected("覆盖同名")
+
+	content := container.NewBorder(
+		widget.NewLabel(fmt.Sprintf("检测到 %d 个服务器，选择要导入的条目：", len(candidates))),
+		widget.NewForm(widget.NewFormItem("同名冲突处理", resolution)),
+		nil, nil, scroll,
+	)
+
+	d := dialog.NewCustomConfirm("导入预览", "导入", "取消", content, func(ok bool) {
+		if !ok {
+			return
+		}
+		imported := 0
+		for i, c := range candidates {
+			if !checks[i].Checked {
+				continue
+			}
+			if mw.importCandidate(c, resolution.Selected) {
+				imported++
+			}
+		}
+		if imported > 0 {
+			_ = mw.cfg.Save()
+			mw.refreshServerSelect()
+		}
+		mw.appendLog(fmt.Sprintf("[系统] 已从拖放文件导入 %d 个服务器\n", imported))
+	}, mw.w)
+	d.Resize(fyne.NewSize(480, 420))
+	d.Show()
+}
+
+// importCandidate applies one row's conflict resolution and, unless
+// skipped, upserts it. It reports whether the candidate was written.
+func (mw *MainWindow) importCandidate(c importer.Candidate, resolution string) bool {
+	name := c.Name
+	if name == "" {
+		name = c.Server
+	}
+
+	s := config.Server{
+		Name: name, Server: c.Server, Listen: c.Listen, Token: c.Token,
+		IP: c.IP, DNS: c.DNS, ECH: c.ECH, RoutingMode: c.RoutingMode,
+	}
+
+	existing, found := mw.findServerByName(name)
+	switch {
+	case !found:
+		s.ID = newID()
+	case resolution == "跳过":
+		return false
+	case resolution == "重命名":
+		s.ID = newID()
+		s.Name = name + " (导入)"
+	default: // 覆盖同名
+		s.ID = existing.ID
+	}
+
+	mw.cfg.UpsertServer(s)
+	return true
+}
+
+func (mw *MainWindow) findServerByName(name string) (config.Server, bool) {
+	for _, s := range mw.cfg.Model.Servers {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return config.Server{}, false
+}
@@ -0,0 +1,291 @@
+package ui
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"github.com/juerson/ech-wk/client-gui-go/internal/config"
+	"github.com/juerson/ech-wk/client-gui-go/internal/notify"
+)
+
+const defaultNotifyMinInterval = 60 * time.Second
+
+// initNotify builds the notification dispatcher from the persisted
+// config. Called once from initControls; showNotifySettings rebuilds it
+// whenever the user changes channel settings.
+func (mw *MainWindow) initNotify() {
+	mw.rebuildNotifyManager()
+}
+
+// rebuildNotifyManager recreates mw.notifyMgr from mw.cfg.Model.Notify,
+// including only enabled channels. Each channel's MutedEvents wraps its
+// Notifier so per-event muting survives independently of the manager's
+// global per-event-type rate limiter.
+func (mw *MainWindow) rebuildNotifyManager() {
+	var notifiers []notify.Notifier
+	for _, c := range mw.cfg.Model.Notify.Channels {
+		if !c.Enabled {
+			continue
+		}
+		var n notify.Notifier
+		switch c.Kind {
+		case "desktop":
+			n = &notify.DesktopNotifier{App: fyne.CurrentApp()}
+		case "webhook":
+			if c.WebhookURL != "" {
+				n = &notify.WebhookNotifier{URL: c.WebhookURL}
+			}
+		case "telegram":
+			if c.TelegramBotToken != "" && c.TelegramChatID != "" {
+				n = &notify.TelegramNotifier{BotToken: c.TelegramBotToken, ChatID: c.TelegramChatID}
+			}
+		case "bark":
+			if c.BarkKey != "" {
+				n = &notify.BarkNotifier{ServerURL: c.BarkServerURL, Key: c.BarkKey}
+			}
+		case "serverchan":
+			if c.ServerChanKey != "" {
+				n = &notify.ServerChanNotifier{SendKey: c.ServerChanKey}
+			}
+		case "smtp":
+			if c.SMTPHost != "" && len(c.SMTPTo) > 0 {
+				n = &notify.SMTPNotifier{
+					Host: c.SMTPHost, Port: c.SMTPPort, User: c.SMTPUser,
+					Pass: c.SMTPPass, From: c.SMTPFrom, To: c.SMTPTo,
+				}
+			}
+		}
+		if n == nil {
+			continue
+		}
+		if len(c.MutedEvents) > 0 {
+			muted := make(map[string]bool, len(c.MutedEvents))
+			for _, t := range c.MutedEvents {
+				muted[t] = true
+			}
+			n = &notify.MutedNotifier{Notifier: n, Muted: muted}
+		}
+		notifiers = append(notifiers, n)
+	}
+
+	minInterval := defaultNotifyMinInterval
+	if mw.cfg.Model.Notify.MinIntervalSec > 0 {
+		minInterval = time.Duration(mw.cfg.Model.Notify.MinIntervalSec) * time.Second
+	}
+	mw.notifyMgr = notify.NewManager(notifiers, minInterval, mw.appendLog)
+}
+
+// notifyEvent dispatches ev through mw.notifyMgr, a no-op until the
+// first channel is enabled.
+func (mw *MainWindow) notifyEvent(eventType, message string) {
+	if mw.notifyMgr == nil {
+		return
+	}
+	cur, _ := mw.cfg.GetCurrentServer()
+	mw.notifyMgr.Dispatch(notify.Event{
+		Type:    eventType,
+		Server:  cur.Name,
+		Message: message,
+		Time:    time.Now(),
+	})
+}
+
+func (mw *MainWindow) channelByKind(kind string) config.NotifyChannel {
+	for _, c := range mw.cfg.Model.Notify.Channels {
+		if c.Kind == kind {
+			return c
+		}
+	}
+	return config.NotifyChannel{Kind: kind}
+}
+
+// showNotifySettings opens the "通知设置" dialog: one enable checkbox
+// plus its fields per channel, and a 测试通知 button that fans a
+// synthetic event out to whatever is enabled right now in the form.
+func (mw *MainWindow) showNotifySettings() {
+	desktop := mw.channelByKind("desktop")
+	webhook := mw.channelByKind("webhook")
+	telegram := mw.channelByKind("telegram")
+	bark := mw.channelByKind("bark")
+	serverchan := mw.channelByKind("serverchan")
+	smtp := mw.channelByKind("smtp")
+
+	desktopCheck := widget.NewCheck("启用桌面通知", nil)
+	desktopCheck.SetChecked(desktop.Enabled)
+
+	webhookCheck := widget.NewCheck("启用 Webhook", nil)
+	webhookCheck.SetChecked(webhook.Enabled)
+	webhookURL := widget.NewEntry()
+	webhookURL.SetPlaceHolder("https://example.com/hook")
+	webhookURL.SetText(webhook.WebhookURL)
+	webhookMuted := widget.NewEntry()
+	webhookMuted.SetPlaceHolder("静音事件，逗号分隔，如 log-warn")
+	webhookMuted.SetText(strings.Join(webhook.MutedEvents, ", "))
+
+	telegramCheck := widget.NewCheck("启用 Telegram", nil)
+	telegramCheck.SetChecked(telegram.Enabled)
+	telegramToken := widget.NewEntry()
+	telegramToken.SetPlaceHolder("Bot Token")
+	telegramToken.SetText(telegram.TelegramBotToken)
+	telegramChat := widget.NewEntry()
+	telegramChat.SetPlaceHolder("Chat ID")
+	telegramChat.SetText(telegram.TelegramChatID)
+	telegramMuted := widget.NewEntry()
+	telegramMuted.SetPlaceHolder("静音事件，逗号分隔")
+	telegramMuted.SetText(strings.Join(telegram.MutedEvents, ", "))
+
+	barkCheck := widget.NewCheck("启用 Bark", nil)
+	barkCheck.SetChecked(bark.Enabled)
+	barkServer := widget.NewEntry()
+	barkServer.SetPlaceHolder("https://api.day.app（留空使用默认）")
+	barkServer.SetText(bark.BarkServerURL)
+	barkKey := widget.NewEntry()
+	barkKey.SetPlaceHolder("设备 Key")
+	barkKey.SetText(bark.BarkKey)
+	barkMuted := widget.NewEntry()
+	barkMuted.SetPlaceHolder("静音事件，逗号分隔")
+	barkMuted.SetText(strings.Join(bark.MutedEvents, ", "))
+
+	serverChanCheck := widget.NewCheck("启用 Server酱", nil)
+	serverChanCheck.SetChecked(serverchan.Enabled)
+	serverChanKey := widget.NewEntry()
+	serverChanKey.SetPlaceHolder("SendKey")
+	serverChanKey.SetText(serverchan.ServerChanKey)
+	serverChanMuted := widget.NewEntry()
+	serverChanMuted.SetPlaceHolder("静音事件，逗号分隔")
+	serverChanMuted.SetText(strings.Join(serverchan.MutedEvents, ", "))
+
+	smtpCheck := widget.NewCheck("启用邮件通知", nil)
+	smtpCheck.SetChecked(smtp.Enabled)
+	smtpHost := widget.NewEntry()
+	smtpHost.SetPlaceHolder("smtp.example.com")
+	smtpHost.SetText(smtp.SMTPHost)
+	smtpPort := widget.NewEntry()
+	smtpPort.SetPlaceHolder("587")
+	if smtp.SMTPPort != 0 {
+		smtpPort.SetText(strconv.Itoa(smtp.SMTPPort))
+	}
+	smtpUser := widget.NewEntry()
+	smtpUser.SetText(smtp.SMTPUser)
+	smtpPass := widget.NewPasswordEntry()
+	smtpPass.SetText(smtp.SMTPPass)
+	smtpFrom := widget.NewEntry()
+	smtpFrom.SetText(smtp.SMTPFrom)
+	smtpTo := widget.NewEntry()
+	smtpTo.SetPlaceHolder("a@example.com, b@example.com")
+	smtpTo.SetText(strings.Join(smtp.SMTPTo, ", "))
+
+	// splitMuted turns a comma-separated entry into a MutedEvents list.
+	splitMuted := func(s string) []string {
+		var out []string
+		for _, t := range strings.Split(s, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				out = append(out, t)
+			}
+		}
+		return out
+	}
+
+	// collectChannels builds every channel from the form's current
+	// values, shared by Save and 测试通知.
+	collectChannels := func() []config.NotifyChannel {
+		port, _ := strconv.Atoi(strings.TrimSpace(smtpPort.Text))
+		var to []string
+		for _, addr := range strings.Split(smtpTo.Text, ",") {
+			if addr = strings.TrimSpace(addr); addr != "" {
+				to = append(to, addr)
+			}
+		}
+		return []config.NotifyChannel{
+			{Kind: "desktop", Enabled: desktopCheck.Checked},
+			{
+				Kind: "webhook", Enabled: webhookCheck.Checked,
+				WebhookURL:  strings.TrimSpace(webhookURL.Text),
+				MutedEvents: splitMuted(webhookMuted.Text),
+			},
+			{
+				Kind: "telegram", Enabled: telegramCheck.Checked,
+				TelegramBotToken: strings.TrimSpace(telegramToken.Text),
+				TelegramChatID:   strings.TrimSpace(telegramChat.Text),
+				MutedEvents:      splitMuted(telegramMuted.Text),
+			},
+			{
+				Kind: "bark", Enabled: barkCheck.Checked,
+				BarkServerURL: strings.TrimSpace(barkServer.Text),
+				BarkKey:       strings.TrimSpace(barkKey.Text),
+				MutedEvents:   splitMuted(barkMuted.Text),
+			},
+			{
+				Kind: "serverchan", Enabled: serverChanCheck.Checked,
+				ServerChanKey: strings.TrimSpace(serverChanKey.Text),
+				MutedEvents:   splitMuted(serverChanMuted.Text),
+			},
+			{
+				Kind: "smtp", Enabled: smtpCheck.Checked,
+				SMTPHost: strings.TrimSpace(smtpHost.Text), SMTPPort: port,
+				SMTPUser: smtpUser.Text, SMTPPass: smtpPass.Text,
+				SMTPFrom: strings.TrimSpace(smtpFrom.Text), SMTPTo: to,
+			},
+		}
+	}
+
+	testBtn := widget.NewButton("测试通知", func() {
+		mw.cfg.Model.Notify.Channels = collectChannels()
+		mw.rebuildNotifyManager()
+		mw.notifyMgr.Test(notify.Event{
+			Type:    "test",
+			Message: "这是一条测试通知",
+			Time:    time.Now(),
+		})
+	})
+
+	form := widget.NewForm(
+		widget.NewFormItem("", desktopCheck),
+		widget.NewFormItem("", webhookCheck),
+		widget.NewFormItem("Webhook URL", webhookURL),
+		widget.NewFormItem("静音事件", webhookMuted),
+		widget.NewFormItem("", telegramCheck),
+		widget.NewFormItem("Bot Token", telegramToken),
+		widget.NewFormItem("Chat ID", telegramChat),
+		widget.NewFormItem("静音事件", telegramMuted),
+		widget.NewFormItem("", barkCheck),
+		widget.NewFormItem("服务器地址", barkServer),
+		widget.NewFormItem("设备 Key", barkKey),
+		widget.NewFormItem("静音事件", barkMuted),
+		widget.NewFormItem("", serverChanCheck),
+		widget.NewFormItem("SendKey", serverChanKey),
+		widget.NewFormItem("静音事件", serverChanMuted),
+		widget.NewFormItem("", smtpCheck),
+		widget.NewFormItem("SMTP 服务器", smtpHost),
+		widget.NewFormItem("端口", smtpPort),
+		widget.NewFormItem("用户名", smtpUser),
+		widget.NewFormItem("密码", smtpPass),
+		widget.NewFormItem("发件人", smtpFrom),
+		widget.NewFormItem("收件人", smtpTo),
+	)
+
+	scroll := container.NewVScroll(form)
+	scroll.SetMinSize(fyne.NewSize(460, 420))
+	content := container.NewVBox(scroll, testBtn)
+
+	d := dialog.NewCustomConfirm("通知设置", "保存", "取消", content, func(ok bool) {
+		if !ok {
+			return
+		}
+		mw.cfg.Model.Notify.Channels = collectChannels()
+		if err := mw.cfg.Save(); err != nil {
+			dialog.ShowError(err, mw.w)
+			return
+		}
+		mw.rebuildNotifyManager()
+		mw.appendLog("[系统] 已保存通知设置\n")
+	}, mw.w)
+	d.Resize(fyne.NewSize(480, 620))
+	d.Show()
+}
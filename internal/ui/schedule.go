@@ -0,0 +1,275 @@
+package ui
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"github.com/juerson/ech-wk/client-gui-go/internal/config"
+	"github.com/juerson/ech-wk/client-gui-go/internal/scheduler"
+)
+
+const (
+	ruleActionStart       = "start"
+	ruleActionStop        = "stop"
+	ruleActionSwitch      = "switch-to"
+	ruleActionToggleProxy = "toggle-system-proxy"
+)
+
+// rebuildCronRules re-parses every enabled rule and hands the resulting
+// set to the cron engine. Rules with an invalid spec are skipped and
+// logged rather than rejected wholesale, since one bad rule shouldn't
+// disable the others.
+func (mw *MainWindow) rebuildCronRules() {
+	rules := make([]scheduler.Rule, 0, len(mw.cfg.Model.Rules)+len(mw.cfg.Model.Subscriptions))
+	for _, r := range mw.cfg.Model.Rules {
+		if !r.Enabled {
+			continue
+		}
+		spec, err := scheduler.Parse(r.Spec)
+		if err != nil {
+			log.Printf("[定时任务] 规则 %q 的 cron 表达式无效，已跳过: %v", r.Name, err)
+			continue
+		}
+		rules = append(rules, scheduler.Rule{ID: r.ID, Spec: spec})
+	}
+	for _, s := range mw.cfg.Model.Subscriptions {
+		if s.IntervalMinutes <= 0 {
+			continue
+		}
+		// scheduler.Parse has no "*/N" step syntax, so list the minutes
+		// explicitly: 0, N, 2N, ... below 60 (an interval of 60 or more
+		// fires once an hour, at minute 0).
+		minutes := make([]string, 0, 60/s.IntervalMinutes+1)
+		for m := 0; m < 60; m += s.IntervalMinutes {
+			minutes = append(minutes, strconv.Itoa(m))
+		}
+		spec, err := scheduler.Parse(strings.Join(minutes, ",") + " * * * *")
+		if err != nil {
+			log.Printf("[订阅] 订阅 %q 的拉取周期无效，已跳过: %v", s.Name, err)
+			continue
+		}
+		rules = append(rules, scheduler.Rule{ID: subscriptionRuleID(s.ID), Spec: spec})
+	}
+	mw.cron.SetRules(rules)
+}
+
+// onRuleFire is invoked by the cron engine (from its own goroutine) when
+// a rule matches; it dispatches to the same code paths the 启动/停止
+// buttons use, so a fired rule behaves identically to a manual click.
+func (mw *MainWindow) onRuleFire(id string) {
+	if subID, ok := subscriptionIDFromRule(id); ok {
+		fyne.Do(func() { mw.fetchSubscription(subID, false) })
+		return
+	}
+
+	var rule *config.ScheduleRule
+	for i := range mw.cfg.Model.Rules {
+		if mw.cfg.Model.Rules[i].ID == id {
+			rule = &mw.cfg.Model.Rules[i]
+			break
+		}
+	}
+	if rule == nil {
+		return
+	}
+
+	fyne.Do(func() {
+		mw.appendLog(fmt.Sprintf("[定时任务] 触发: %s (%s)\n", rule.Name, rule.Action))
+		switch rule.Action {
+		case ruleActionStart:
+			mw.onStart()
+		case ruleActionStop:
+			mw.shutdown()
+		case ruleActionSwitch:
+			mw.cfg.SetCurrentServer(rule.TargetServerID)
+			_ = mw.cfg.Save()
+			mw.refreshServerSelect()
+			mw.loadCurrentToForm()
+			if mw.running {
+				mw.shutdown()
+				mw.onStart()
+			}
+		case ruleActionToggleProxy:
+			mw.setProxyCheckSilently(!mw.systemProxyEnabled)
+			mw.onProxyChanged()
+		default:
+			mw.appendLog(fmt.Sprintf("[警告] 未知的定时任务动作: %s\n", rule.Action))
+		}
+	})
+}
+
+// buildScheduleTab builds the "定时任务" tab: a list of rules with their
+// next-run time, and add/edit/delete/run-now controls below it.
+func (mw *MainWindow) buildScheduleTab() fyne.CanvasObject {
+	mw.ruleList = widget.NewList(
+		func() int { return len(mw.cfg.Model.Rules) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(i widget.ListItemID, o fyne.CanvasObject) {
+			if i < 0 || i >= len(mw.cfg.Model.Rules) {
+				return
+			}
+			o.(*widget.Label).SetText(mw.ruleRowText(mw.cfg.Model.Rules[i]))
+		},
+	)
+	mw.ruleList.OnSelected = func(i widget.ListItemID) {
+		mw.selectedRule = i
+	}
+	mw.ruleList.OnUnselected = func(widget.ListItemID) {
+		mw.selectedRule = -1
+	}
+
+	addBtn := widget.NewButton("新增", func() { mw.showRuleForm(nil) })
+	editBtn := widget.NewButton("编辑", func() {
+		if mw.selectedRule < 0 || mw.selectedRule >= len(mw.cfg.Model.Rules) {
+			dialog.ShowInformation("提示", "请先在列表中选择一条规则", mw.w)
+			return
+		}
+		r := mw.cfg.Model.Rules[mw.selectedRule]
+		mw.showRuleForm(&r)
+	})
+	deleteBtn := widget.NewButton("删除", func() {
+		if mw.selectedRule < 0 || mw.selectedRule >= len(mw.cfg.Model.Rules) {
+			dialog.ShowInformation("提示", "请先在列表中选择一条规则", mw.w)
+			return
+		}
+		r := mw.cfg.Model.Rules[mw.selectedRule]
+		dialog.ShowConfirm("确认删除", fmt.Sprintf("确定要删除定时任务 \"%s\" 吗？", r.Name), func(ok bool) {
+			if !ok {
+				return
+			}
+			mw.cfg.DeleteRule(r.ID)
+			_ = mw.cfg.Save()
+			mw.rebuildCronRules()
+			mw.selectedRule = -1
+			mw.ruleList.Refresh()
+		}, mw.w)
+	})
+	runNowBtn := widget.NewButton("立即执行", func() {
+		if mw.selectedRule < 0 || mw.selectedRule >= len(mw.cfg.Model.Rules) {
+			dialog.ShowInformation("提示", "请先在列表中选择一条规则", mw.w)
+			return
+		}
+		mw.cron.RunNow(mw.cfg.Model.Rules[mw.selectedRule].ID)
+	})
+
+	buttons := container.NewHBox(addBtn, editBtn, deleteBtn, runNowBtn)
+	return container.NewBorder(nil, buttons, nil, nil, mw.ruleList)
+}
+
+// ruleRowText renders one list row: name, cron spec, action and, when
+// the spec is valid, its next run time.
+func (mw *MainWindow) ruleRowText(r config.ScheduleRule) string {
+	status := "已启用"
+	if !r.Enabled {
+		status = "已禁用"
+	}
+	next := "—"
+	if spec, err := scheduler.Parse(r.Spec); err == nil {
+		if t, ok := spec.Next(time.Now()); ok {
+			next = t.Format("01-02 15:04")
+		}
+	} else {
+		next = "表达式无效"
+	}
+	return fmt.Sprintf("%s  [%s]  %s  (%s)  下次运行: %s", r.Name, r.Spec, r.Action, status, next)
+}
+
+// showRuleForm opens the add/edit dialog for a schedule rule. existing
+// is nil when adding a new rule.
+func (mw *MainWindow) showRuleForm(existing *config.ScheduleRule) {
+	nameEntry := widget.NewEntry()
+	specEntry := widget.NewEntry()
+	specEntry.SetPlaceHolder("0 8 * * MON-FRI")
+	actionSelect := widget.NewSelect([]string{ruleActionStart, ruleActionStop, ruleActionSwitch, ruleActionToggleProxy}, nil)
+	targetSelect := widget.NewSelect(mw.serverNamesForRule(), nil)
+	enabledCheck := widget.NewCheck("启用", nil)
+	enabledCheck.SetChecked(true)
+
+	if existing != nil {
+		nameEntry.SetText(existing.Name)
+		specEntry.SetText(existing.Spec)
+		actionSelect.SetSelected(existing.Action)
+		targetSelect.SetSelected(mw.serverNameByID(existing.TargetServerID))
+		enabledCheck.SetChecked(existing.Enabled)
+	} else {
+		actionSelect.SetSelected(ruleActionStart)
+	}
+
+	form := widget.NewForm(
+		widget.NewFormItem("名称", nameEntry),
+		widget.NewFormItem("Cron 表达式", specEntry),
+		widget.NewFormItem("动作", actionSelect),
+		widget.NewFormItem("目标服务器(switch-to)", targetSelect),
+		widget.NewFormItem("", enabledCheck),
+	)
+
+	title := "新增定时任务"
+	if existing != nil {
+		title = "编辑定时任务"
+	}
+
+	d := dialog.NewForm(title, "确定", "取消", form.Items, func(ok bool) {
+		if !ok {
+			return
+		}
+		name := strings.TrimSpace(nameEntry.Text)
+		if name == "" {
+			dialog.ShowError(fmt.Errorf("名称不能为空"), mw.w)
+			return
+		}
+		if _, err := scheduler.Parse(specEntry.Text); err != nil {
+			dialog.ShowError(err, mw.w)
+			return
+		}
+
+		r := config.ScheduleRule{
+			Name:    name,
+			Spec:    strings.TrimSpace(specEntry.Text),
+			Action:  actionSelect.Selected,
+			Enabled: enabledCheck.Checked,
+		}
+		if existing != nil {
+			r.ID = existing.ID
+		} else {
+			r.ID = newID()
+		}
+		if r.Action == ruleActionSwitch {
+			r.TargetServerID = mw.serverNameTo[targetSelect.Selected]
+		}
+
+		mw.cfg.UpsertRule(r)
+		if err := mw.cfg.Save(); err != nil {
+			dialog.ShowError(err, mw.w)
+			return
+		}
+		mw.rebuildCronRules()
+		mw.ruleList.Refresh()
+	}, mw.w)
+	d.Resize(fyne.NewSize(480, 280))
+	d.Show()
+}
+
+func (mw *MainWindow) serverNamesForRule() []string {
+	names := make([]string, 0, len(mw.cfg.Model.Servers))
+	for _, s := range mw.cfg.Model.Servers {
+		names = append(names, s.Name)
+	}
+	return names
+}
+
+func (mw *MainWindow) serverNameByID(id string) string {
+	for _, s := range mw.cfg.Model.Servers {
+		if s.ID == id {
+			return s.Name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,263 @@
+package ui
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"github.com/juerson/ech-wk/client-gui-go/internal/config"
+	"github.com/juerson/ech-wk/client-gui-go/internal/subscription"
+)
+
+const subscriptionRulePrefix = "sub:"
+
+// subscriptionRuleID namespaces a subscription's periodic-fetch cron
+// rule so it can't collide with a user-defined schedule rule's ID.
+func subscriptionRuleID(subID string) string {
+	return subscriptionRulePrefix + subID
+}
+
+// subscriptionIDFromRule reverses subscriptionRuleID, reporting whether
+// id names a subscription's periodic-fetch rule.
+func subscriptionIDFromRule(id string) (string, bool) {
+	if !strings.HasPrefix(id, subscriptionRulePrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(id, subscriptionRulePrefix), true
+}
+
+// applySubscriptionLock disables 保存/删除 and shows the owning
+// subscription's URL when s is subscription-managed; otherwise it
+// restores normal editing and hides the source label.
+func (mw *MainWindow) applySubscriptionLock(s config.Server) {
+	if s.SubscriptionID == "" {
+		if mw.saveBtn != nil {
+			mw.saveBtn.Enable()
+			mw.delBtn.Enable()
+		}
+		if mw.subSourceLabel != nil {
+			mw.subSourceLabel.Hide()
+		}
+		return
+	}
+
+	if mw.saveBtn != nil {
+		mw.saveBtn.Disable()
+		mw.delBtn.Disable()
+	}
+	if mw.subSourceLabel != nil {
+		mw.subSourceLabel.SetText(fmt.Sprintf("来自订阅: %s", mw.subscriptionURLByID(s.SubscriptionID)))
+		mw.subSourceLabel.Show()
+	}
+}
+
+func (mw *MainWindow) subscriptionURLByID(id string) string {
+	for _, s := range mw.cfg.Model.Subscriptions {
+		if s.ID == id {
+			return s.URL
+		}
+	}
+	return "(未知订阅)"
+}
+
+// fetchSubscription downloads and merges one subscription's content
+// into Model.Servers: matching entries (by subscription.StableID) are
+// updated in place, new ones added, and orphaned subscription-owned
+// entries pruned. manual controls whether failures pop an error dialog
+// (a background cron fetch just logs).
+func (mw *MainWindow) fetchSubscription(id string, manual bool) {
+	var sub *config.Subscription
+	for i := range mw.cfg.Model.Subscriptions {
+		if mw.cfg.Model.Subscriptions[i].ID == id {
+			sub = &mw.cfg.Model.Subscriptions[i]
+			break
+		}
+	}
+	if sub == nil {
+		return
+	}
+
+	mw.appendLog(fmt.Sprintf("[系统] 正在拉取订阅: %s\n", sub.Name))
+	entries, err := subscription.Fetch(sub.URL)
+	if err != nil {
+		mw.appendLog(fmt.Sprintf("[错误] 拉取订阅失败: %v\n", err))
+		if manual {
+			dialog.ShowError(err, mw.w)
+		}
+		return
+	}
+
+	seen := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		sid := subscription.StableID(e.Server, e.Token, e.ECH)
+		seen[sid] = true
+		mw.cfg.UpsertServer(config.Server{
+			ID:             sid,
+			Name:           e.Name,
+			Server:         e.Server,
+			Listen:         e.Listen,
+			Token:          e.Token,
+			IP:             e.IP,
+			DNS:            e.DNS,
+			ECH:            e.ECH,
+			RoutingMode:    e.RoutingMode,
+			SubscriptionID: sub.ID,
+		})
+	}
+
+	kept := make([]config.Server, 0, len(mw.cfg.Model.Servers))
+	for _, s := range mw.cfg.Model.Servers {
+		if s.SubscriptionID == sub.ID && !seen[s.ID] {
+			continue
+		}
+		kept = append(kept, s)
+	}
+	mw.cfg.Model.Servers = kept
+	sub.LastFetchedUnix = time.Now().Unix()
+
+	_ = mw.cfg.Save()
+	mw.refreshServerSelect()
+	mw.appendLog(fmt.Sprintf("[系统] 订阅 %s 已更新，共 %d 个服务器\n", sub.Name, len(entries)))
+}
+
+// showSubscriptionDialog lists configured subscriptions with
+// add/edit/delete/立即拉取 controls, mirroring buildScheduleTab's layout.
+func (mw *MainWindow) showSubscriptionDialog() {
+	selected := -1
+	list := widget.NewList(
+		func() int { return len(mw.cfg.Model.Subscriptions) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(i widget.ListItemID, o fyne.CanvasObject) {
+			if i < 0 || i >= len(mw.cfg.Model.Subscriptions) {
+				return
+			}
+			o.(*widget.Label).SetText(mw.subscriptionRowText(mw.cfg.Model.Subscriptions[i]))
+		},
+	)
+	list.OnSelected = func(i widget.ListItemID) { selected = i }
+	list.OnUnselected = func(widget.ListItemID) { selected = -1 }
+
+	var d dialog.Dialog
+
+	addBtn := widget.NewButton("新增", func() { mw.showSubscriptionForm(nil, list) })
+	editBtn := widget.NewButton("编辑", func() {
+		if selected < 0 || selected >= len(mw.cfg.Model.Subscriptions) {
+			dialog.ShowInformation("提示", "请先在列表中选择一个订阅", mw.w)
+			return
+		}
+		s := mw.cfg.Model.Subscriptions[selected]
+		mw.showSubscriptionForm(&s, list)
+	})
+	deleteBtn := widget.NewButton("删除", func() {
+		if selected < 0 || selected >= len(mw.cfg.Model.Subscriptions) {
+			dialog.ShowInformation("提示", "请先在列表中选择一个订阅", mw.w)
+			return
+		}
+		s := mw.cfg.Model.Subscriptions[selected]
+		dialog.ShowConfirm("确认删除", fmt.Sprintf("确定要删除订阅 \"%s\" 及其管理的服务器吗？", s.Name), func(ok bool) {
+			if !ok {
+				return
+			}
+			mw.cfg.DeleteSubscription(s.ID)
+			_ = mw.cfg.Save()
+			mw.rebuildCronRules()
+			mw.refreshServerSelect()
+			selected = -1
+			list.Refresh()
+		}, mw.w)
+	})
+	fetchBtn := widget.NewButton("立即拉取", func() {
+		if selected < 0 || selected >= len(mw.cfg.Model.Subscriptions) {
+			dialog.ShowInformation("提示", "请先在列表中选择一个订阅", mw.w)
+			return
+		}
+		mw.fetchSubscription(mw.cfg.Model.Subscriptions[selected].ID, true)
+		list.Refresh()
+	})
+
+	buttons := container.NewHBox(addBtn, editBtn, deleteBtn, fetchBtn)
+	content := container.NewBorder(nil, buttons, nil, nil, list)
+
+	d = dialog.NewCustom("订阅设置", "关闭", content, mw.w)
+	d.Resize(fyne.NewSize(480, 360))
+	d.Show()
+}
+
+func (mw *MainWindow) subscriptionRowText(s config.Subscription) string {
+	interval := "手动拉取"
+	if s.IntervalMinutes > 0 {
+		interval = fmt.Sprintf("每 %d 分钟", s.IntervalMinutes)
+	}
+	last := "从未拉取"
+	if s.LastFetchedUnix > 0 {
+		last = time.Unix(s.LastFetchedUnix, 0).Format("01-02 15:04")
+	}
+	return fmt.Sprintf("%s  (%s)  上次拉取: %s", s.Name, interval, last)
+}
+
+// showSubscriptionForm opens the add/edit dialog for a subscription.
+// existing is nil when adding a new one.
+func (mw *MainWindow) showSubscriptionForm(existing *config.Subscription, list *widget.List) {
+	nameEntry := widget.NewEntry()
+	urlEntry := widget.NewEntry()
+	urlEntry.SetPlaceHolder("https://example.com/subscribe")
+	intervalEntry := widget.NewEntry()
+	intervalEntry.SetPlaceHolder("0 = 仅手动拉取")
+
+	if existing != nil {
+		nameEntry.SetText(existing.Name)
+		urlEntry.SetText(existing.URL)
+		if existing.IntervalMinutes > 0 {
+			intervalEntry.SetText(strconv.Itoa(existing.IntervalMinutes))
+		}
+	}
+
+	form := widget.NewForm(
+		widget.NewFormItem("名称", nameEntry),
+		widget.NewFormItem("订阅地址", urlEntry),
+		widget.NewFormItem("拉取周期(分钟)", intervalEntry),
+	)
+
+	title := "新增订阅"
+	if existing != nil {
+		title = "编辑订阅"
+	}
+
+	d := dialog.NewForm(title, "确定", "取消", form.Items, func(ok bool) {
+		if !ok {
+			return
+		}
+		name := strings.TrimSpace(nameEntry.Text)
+		url := strings.TrimSpace(urlEntry.Text)
+		if name == "" || url == "" {
+			dialog.ShowError(fmt.Errorf("名称和订阅地址都不能为空"), mw.w)
+			return
+		}
+		interval, _ := strconv.Atoi(strings.TrimSpace(intervalEntry.Text))
+
+		s := config.Subscription{Name: name, URL: url, IntervalMinutes: interval}
+		if existing != nil {
+			s.ID = existing.ID
+			s.LastFetchedUnix = existing.LastFetchedUnix
+		} else {
+			s.ID = newID()
+		}
+
+		mw.cfg.UpsertSubscription(s)
+		if err := mw.cfg.Save(); err != nil {
+			dialog.ShowError(err, mw.w)
+			return
+		}
+		mw.rebuildCronRules()
+		list.Refresh()
+		mw.fetchSubscription(s.ID, true)
+	}, mw.w)
+	d.Resize(fyne.NewSize(480, 220))
+	d.Show()
+}
@@ -0,0 +1,49 @@
+package ui
+
+import (
+	"fmt"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/widget"
+)
+
+// initSupervisor wires the "崩溃自动重启" checkbox and the crash status
+// label, and applies the persisted supervisor setting to the runner.
+func (mw *MainWindow) initSupervisor() {
+	mw.run.SetOnCrash(mw.onProcessCrash)
+
+	mw.crashStatusLabel = widget.NewLabel("")
+	mw.crashStatusLabel.Hide()
+
+	mw.autoRestartCheck = widget.NewCheck("崩溃自动重启", func(v bool) {
+		mw.cfg.Model.Supervisor.Enabled = v
+		_ = mw.cfg.Save()
+		mw.applyAutoRestartSetting()
+	})
+	mw.autoRestartCheck.SetChecked(mw.cfg.Model.Supervisor.Enabled)
+
+	mw.applyAutoRestartSetting()
+}
+
+// applyAutoRestartSetting pushes the current Supervisor config onto the
+// process.Runner. Zero MaxBackoffSec/HealthySec fall back to the
+// runner's own defaults.
+func (mw *MainWindow) applyAutoRestartSetting() {
+	sup := mw.cfg.Model.Supervisor
+	maxBackoff := time.Duration(sup.MaxBackoffSec) * time.Second
+	healthyAfter := time.Duration(sup.HealthySec) * time.Second
+	mw.run.SetAutoRestart(sup.Enabled, maxBackoff, healthyAfter)
+}
+
+// onProcessCrash is registered as the process.Runner's crash callback.
+// It fires on every unexpected exit, including ones auto-restart goes
+// on to recover from, so the UI can surface crash stats without the
+// running state being torn down underneath a transient restart.
+func (mw *MainWindow) onProcessCrash(crashCount int, reason string) {
+	fyne.Do(func() {
+		mw.crashStatusLabel.SetText(fmt.Sprintf("崩溃次数: %d  最近原因: %s", crashCount, reason))
+		mw.crashStatusLabel.Show()
+		mw.notifyEvent("restart", fmt.Sprintf("代理进程崩溃，正在自动重启（第 %d 次，原因: %s）", crashCount, reason))
+	})
+}
@@ -0,0 +1,119 @@
+package ui
+
+import (
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	sysproxy "github.com/juerson/ech-wk/client-gui-go/internal/sysproxy"
+)
+
+// initSysProxyMode wires the "使用 PAC 脚本" checkbox that switches
+// mw.cfg.Model.SysProxy.Mode between "global" (default) and "pac". It
+// only changes which mode future applySystemProxy calls use; it does
+// not itself turn the system proxy on or off.
+func (mw *MainWindow) initSysProxyMode() {
+	mw.pacModeCheck = widget.NewCheck("使用 PAC 脚本分流", func(bool) {
+		mw.onSysProxyModeChanged()
+	})
+	mw.pacModeCheck.SetChecked(mw.cfg.Model.SysProxy.Mode == "pac")
+}
+
+func (mw *MainWindow) onSysProxyModeChanged() {
+	if mw.pacModeCheck.Checked {
+		mw.showSysProxyBypassForm()
+		return
+	}
+	mw.cfg.Model.SysProxy.Mode = "global"
+	_ = mw.cfg.Save()
+	if mw.systemProxyEnabled {
+		cur, ok := mw.cfg.GetCurrentServer()
+		if ok {
+			_ = mw.applySystemProxy(true, cur.Listen)
+		}
+	}
+}
+
+// showSysProxyBypassForm asks for the PAC bypass list (one host/CIDR
+// per line) before PAC mode is first enabled, mirroring
+// showRemoteControlForm's confirm-or-revert shape.
+func (mw *MainWindow) showSysProxyBypassForm() {
+	bypassEntry := widget.NewMultiLineEntry()
+	bypassEntry.SetText(strings.Join(mw.cfg.Model.SysProxy.Bypass, "\n"))
+	bypassEntry.SetPlaceHolder("192.168.0.0/16\n10.0.0.0/8\n*.cn")
+
+	form := widget.NewForm(
+		widget.NewFormItem("直连地址/网段(每行一个)", bypassEntry),
+	)
+	d := dialog.NewForm("PAC 分流设置", "确定", "取消", form.Items, func(ok bool) {
+		if !ok {
+			mw.pacModeCheck.SetChecked(false)
+			return
+		}
+		var bypass []string
+		for _, line := range strings.Split(bypassEntry.Text, "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				bypass = append(bypass, line)
+			}
+		}
+		mw.cfg.Model.SysProxy.Mode = "pac"
+		mw.cfg.Model.SysProxy.Bypass = bypass
+		_ = mw.cfg.Save()
+
+		if mw.systemProxyEnabled {
+			cur, ok := mw.cfg.GetCurrentServer()
+			if ok {
+				if err := mw.applySystemProxy(true, cur.Listen); err != nil {
+					mw.pacModeCheck.SetChecked(false)
+					mw.cfg.Model.SysProxy.Mode = "global"
+					_ = mw.cfg.Save()
+					dialog.ShowError(err, mw.w)
+					return
+				}
+			}
+		}
+	}, mw.w)
+	d.Resize(fyne.NewSize(420, 240))
+	d.Show()
+}
+
+// applySystemProxy turns the OS-level proxy on or off according to
+// mw.cfg.Model.SysProxy.Mode ("pac" spins up/tears down mw.pacServer
+// and points the OS at its proxy.pac; anything else - including the
+// unset zero value - falls back to sysproxy.Set's blanket global
+// proxy). It's the single place every onProxyChanged/onRoutingChanged
+// call site in window.go goes through, so PAC vs. global stays
+// consistent no matter which of them triggered the change.
+func (mw *MainWindow) applySystemProxy(enabled bool, listenAddr string) error {
+	if mw.cfg.Model.SysProxy.Mode != "pac" {
+		mw.stopPACServer()
+		return sysproxy.Set(enabled, listenAddr)
+	}
+
+	if !enabled {
+		mw.stopPACServer()
+		return sysproxy.SetPAC("")
+	}
+
+	mw.stopPACServer()
+	srv := sysproxy.NewPACServer(sysproxy.PACConfig{
+		ListenAddr:  listenAddr,
+		RoutingMode: mw.routing.Selected,
+		Bypass:      mw.cfg.Model.SysProxy.Bypass,
+	})
+	if err := srv.Start(); err != nil {
+		return err
+	}
+	mw.pacServer = srv
+	return sysproxy.SetPAC(srv.URL())
+}
+
+func (mw *MainWindow) stopPACServer() {
+	if mw.pacServer == nil {
+		return
+	}
+	_ = mw.pacServer.Stop()
+	mw.pacServer = nil
+}
@@ -0,0 +1,125 @@
+// Package theme provides the app's fyne.Theme implementation. Fyne's
+// built-in theme falls back to a font with no CJK glyphs, so Chinese
+// labels throughout the UI render as tofu boxes; this package bundles
+// Noto Sans SC/TC so they render correctly on every platform, while
+// still following the OS light/dark variant and letting the user pick
+// an accent color that's remembered across launches.
+package theme
+
+import (
+	_ "embed"
+	"image/color"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/theme"
+)
+
+//go:embed fonts/NotoSansSC-Regular.ttf
+var notoSansSC []byte
+
+//go:embed fonts/NotoSansTC-Regular.ttf
+var notoSansTC []byte
+
+const (
+	prefAccentR = "theme.accent.r"
+	prefAccentG = "theme.accent.g"
+	prefAccentB = "theme.accent.b"
+	prefAccentA = "theme.accent.a"
+)
+
+// Theme wraps Fyne's default theme, substituting the bundled CJK font
+// and an optional user-chosen accent color for ColorNamePrimary.
+type Theme struct {
+	accent *color.NRGBA
+}
+
+var _ fyne.Theme = (*Theme)(nil)
+
+// New creates a theme with no accent override; Color falls through to
+// Fyne's default palette until SetAccent is called.
+func New() *Theme {
+	return &Theme{}
+}
+
+// SetAccent overrides ColorNamePrimary. Pass nil to go back to Fyne's
+// default accent.
+func (t *Theme) SetAccent(c *color.NRGBA) {
+	t.accent = c
+}
+
+func (t *Theme) Color(name fyne.ThemeColorName, variant fyne.ThemeVariant) color.Color {
+	if name == theme.ColorNamePrimary && t.accent != nil {
+		return t.accent
+	}
+	return theme.DefaultTheme().Color(name, variant)
+}
+
+func (t *Theme) Icon(name fyne.ThemeIconName) fyne.Resource {
+	return theme.DefaultTheme().Icon(name)
+}
+
+// Font returns the bundled Noto Sans CJK face for proportional text so
+// Chinese/Japanese/Korean labels render correctly; monospace requests
+// (the console panel, log views) keep Fyne's built-in monospace font
+// since the bundled face has no fixed-width metrics.
+func (t *Theme) Font(style fyne.TextStyle) fyne.Resource {
+	if style.Monospace {
+		return theme.DefaultTheme().Font(style)
+	}
+	if res := cjkFontResource(); res != nil {
+		return res
+	}
+	return theme.DefaultTheme().Font(style)
+}
+
+func (t *Theme) Size(name fyne.ThemeSizeName) float32 {
+	return theme.DefaultTheme().Size(name)
+}
+
+// cjkFontResource prefers Simplified Chinese and falls back to
+// Traditional; if neither embed was populated (e.g. a source checkout
+// without the font binaries vendored in) it returns nil so callers fall
+// back to the default theme font instead of shipping a broken resource.
+func cjkFontResource() fyne.Resource {
+	if len(notoSansSC) > 0 {
+		return fyne.NewStaticResource("NotoSansSC-Regular.ttf", notoSansSC)
+	}
+	if len(notoSansTC) > 0 {
+		return fyne.NewStaticResource("NotoSansTC-Regular.ttf", notoSansTC)
+	}
+	return nil
+}
+
+// SavedAccent reads back the accent color persisted by SaveAccent, or
+// nil if the user never set one.
+func SavedAccent(a fyne.App) *color.NRGBA {
+	p := a.Preferences()
+	if !p.HasKey(prefAccentR) {
+		return nil
+	}
+	return &color.NRGBA{
+		R: uint8(p.Int(prefAccentR)),
+		G: uint8(p.Int(prefAccentG)),
+		B: uint8(p.Int(prefAccentB)),
+		A: uint8(p.IntWithFallback(prefAccentA, 255)),
+	}
+}
+
+// SaveAccent persists c in the app preferences so it survives restarts.
+func SaveAccent(a fyne.App, c color.NRGBA) {
+	p := a.Preferences()
+	p.SetInt(prefAccentR, int(c.R))
+	p.SetInt(prefAccentG, int(c.G))
+	p.SetInt(prefAccentB, int(c.B))
+	p.SetInt(prefAccentA, int(c.A))
+}
+
+// ClearAccent removes the persisted accent override, reverting to
+// Fyne's default on the next launch.
+func ClearAccent(a fyne.App) {
+	p := a.Preferences()
+	p.RemoveValue(prefAccentR)
+	p.RemoveValue(prefAccentG)
+	p.RemoveValue(prefAccentB)
+	p.RemoveValue(prefAccentA)
+}
@@ -0,0 +1,19 @@
+//go:build darwin
+
+package theme
+
+import "os/exec"
+
+// DetectOSDark reports whether macOS is currently in dark mode, using
+// the same `defaults read -g AppleInterfaceStyle` probe Fyne's own
+// driver uses internally. Fyne already resolves this into the
+// ThemeVariant passed to Color, so this is only for display purposes
+// (e.g. an "auto-detected: dark" hint in the settings dialog).
+func DetectOSDark() bool {
+	out, err := exec.Command("defaults", "read", "-g", "AppleInterfaceStyle").Output()
+	if err != nil {
+		// Key is absent in light mode; treat any error as "not dark".
+		return false
+	}
+	return len(out) > 0
+}
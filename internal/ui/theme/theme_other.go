@@ -0,0 +1,20 @@
+//go:build !darwin
+
+package theme
+
+import (
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/theme"
+)
+
+// DetectOSDark reports whether the current app is rendering with the
+// dark variant. On Windows/Linux we don't have a cheap native probe
+// like macOS's AppleInterfaceStyle default, so this just reads back
+// whatever Fyne's own driver already resolved.
+func DetectOSDark() bool {
+	a := fyne.CurrentApp()
+	if a == nil {
+		return false
+	}
+	return a.Settings().ThemeVariant() == theme.VariantDark
+}
@@ -6,9 +6,14 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"image/color"
 	"log"
 	"net"
 	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
 	"strings"
 	"sync"
 	"time"
@@ -23,8 +28,16 @@ import (
 
 	autostart "github.com/juerson/ech-wk/client-gui-go/internal/autostart"
 	"github.com/juerson/ech-wk/client-gui-go/internal/config"
+	"github.com/juerson/ech-wk/client-gui-go/internal/console"
+	"github.com/juerson/ech-wk/client-gui-go/internal/control"
+	"github.com/juerson/ech-wk/client-gui-go/internal/logsink"
+	"github.com/juerson/ech-wk/client-gui-go/internal/notify"
 	"github.com/juerson/ech-wk/client-gui-go/internal/process"
+	"github.com/juerson/ech-wk/client-gui-go/internal/scheduler"
 	sysproxy "github.com/juerson/ech-wk/client-gui-go/internal/sysproxy"
+	uitheme "github.com/juerson/ech-wk/client-gui-go/internal/ui/theme"
+	"github.com/juerson/ech-wk/client-gui-go/internal/uri"
+	"github.com/juerson/ech-wk/client-gui-go/internal/wol"
 )
 
 //go:embed app.png
@@ -49,6 +62,7 @@ type LogEntry struct {
 	Timestamp time.Time
 	Level     string // "INFO", "WARN", "ERROR", "SYSTEM"
 	Message   string
+	Fields    map[string]string // server/listen/routing context, for the file sink
 }
 
 // LogBuffer manages log entries with intelligent limiting
@@ -127,8 +141,14 @@ type MainWindow struct {
 	addBtn   *widget.Button
 	saveBtn  *widget.Button
 	delBtn   *widget.Button
+	subBtn   *widget.Button
 	clearBtn *widget.Button
 
+	// subSourceLabel shows the owning subscription's URL for a
+	// subscription-managed server. Fyne's widget.Select has no native
+	// hover tooltip, so this inline label stands in for one.
+	subSourceLabel *widget.Label
+
 	name   *widget.Entry
 	server *MaskedEntry
 	listen *widget.Entry
@@ -139,8 +159,10 @@ type MainWindow struct {
 
 	routing *widget.Select
 
-	proxyCheck     *widget.Check
-	autoStartCheck *widget.Check
+	proxyCheck       *widget.Check
+	autoStartCheck   *widget.Check
+	autoRestartCheck *widget.Check
+	crashStatusLabel *widget.Label
 
 	systemProxyEnabled bool
 
@@ -152,6 +174,24 @@ type MainWindow struct {
 	logBuffer *LogBuffer
 	logFilter *widget.Select
 
+	console *console.Console
+
+	cron         *scheduler.Cron
+	ruleList     *widget.List
+	selectedRule int // index into mw.cfg.Model.Rules, -1 if none
+
+	logSink *logsink.FileSink
+	logDir  string
+
+	controlServer *control.Server
+	controlBroker *control.Broker
+	remoteCheck   *widget.Check
+
+	pacServer    *sysproxy.PACServer
+	pacModeCheck *widget.Check
+
+	notifyMgr *notify.Manager
+
 	trayEnabled bool
 	isHidden    bool
 
@@ -191,6 +231,184 @@ func InitTray(a fyne.App, w fyne.Window) {
 	}
 }
 
+// Show brings the running instance's window to the front. It backs the
+// IPC "SHOW" command delivered when a second launch is redirected here.
+func Show() {
+	if mainWindowInstance == nil {
+		return
+	}
+	mw := mainWindowInstance
+	fyne.Do(func() {
+		mw.isHidden = false
+		mw.w.Show()
+		mw.w.RequestFocus()
+	})
+}
+
+// HideToTray hides the running instance's window without quitting it.
+func HideToTray() {
+	if mainWindowInstance == nil {
+		return
+	}
+	mw := mainWindowInstance
+	fyne.Do(func() {
+		mw.isHidden = true
+		mw.w.Hide()
+	})
+}
+
+// ReloadConfig re-reads the on-disk config into the running instance. It
+// backs the IPC "RELOAD" command.
+func ReloadConfig() error {
+	if mainWindowInstance == nil {
+		return errors.New("主窗口尚未初始化")
+	}
+	mw := mainWindowInstance
+	if err := mw.cfg.Load(); err != nil {
+		return err
+	}
+	fyne.Do(func() {
+		mw.refreshServerSelect()
+		mw.loadCurrentToForm()
+	})
+	return nil
+}
+
+// ApplyURI is invoked when a second launch forwards an `ech://` argument,
+// or when one was queued before the window finished initializing. It
+// never mutates the on-disk config on its own: the link is parsed and
+// the user is asked to confirm before any server entry is added, so a
+// malicious drive-by `ech://` link can't silently import a server.
+func ApplyURI(raw string) error {
+	if mainWindowInstance == nil {
+		return errors.New("主窗口尚未初始化")
+	}
+	mw := mainWindowInstance
+
+	fyne.Do(func() {
+		mw.isHidden = false
+		mw.w.Show()
+		mw.w.RequestFocus()
+	})
+
+	req, err := uri.Parse(raw)
+	if err != nil {
+		fyne.Do(func() {
+			mw.appendLog(fmt.Sprintf("[警告] 忽略无效的导入链接: %v\n", err))
+		})
+		return err
+	}
+
+	fyne.Do(func() {
+		mw.appendLog(fmt.Sprintf("[系统] 收到外部导入请求: %s\n", raw))
+		mw.confirmImport(req)
+	})
+	return nil
+}
+
+// confirmImport asks the user before turning a parsed ImportRequest
+// into a new server entry.
+func (mw *MainWindow) confirmImport(req *uri.ImportRequest) {
+	name := req.Name
+	if name == "" {
+		name = "导入的服务器"
+	}
+	msg := fmt.Sprintf("是否导入新的服务器配置？\n\n名称: %s\nECH域名: %s\n服务地址: %s",
+		name, req.SNI, req.Server)
+	if req.ConfigList != "" {
+		msg += "\n\n注意: 链接中包含的 ECHConfigList 不会被直接写入配置，客户端仍会通过 DoH 动态获取最新的 ECH 配置。"
+	}
+
+	dialog.ShowConfirm("确认导入", msg, func(ok bool) {
+		if !ok {
+			mw.appendLog("[系统] 用户取消了导入请求\n")
+			return
+		}
+
+		cur, hasCur := mw.cfg.GetCurrentServer()
+		newS := config.Server{
+			ID:   newID(),
+			Name: name,
+			ECH:  req.SNI,
+		}
+		if req.Server != "" {
+			newS.Server = req.Server
+		} else if hasCur {
+			newS.Server = cur.Server
+		}
+		if req.DNS != "" {
+			newS.DNS = req.DNS
+		} else if hasCur {
+			newS.DNS = cur.DNS
+		}
+		if hasCur {
+			newS.Listen = cur.Listen
+			newS.Token = cur.Token
+			newS.IP = cur.IP
+			newS.RoutingMode = cur.RoutingMode
+		}
+
+		mw.cfg.UpsertServer(newS)
+		mw.cfg.SetCurrentServer(newS.ID)
+		if err := mw.cfg.Save(); err != nil {
+			dialog.ShowError(err, mw.w)
+			return
+		}
+		mw.refreshServerSelect()
+		mw.loadCurrentToForm()
+		mw.appendLog(fmt.Sprintf("[系统] 已导入服务器: %s\n", name))
+	}, mw.w)
+}
+
+// ShowSettingsDialog opens the accent-color picker backing the tray
+// menu's "设置" entry. The choice applies immediately and is persisted
+// via theme.SaveAccent so it survives restarts.
+func ShowSettingsDialog() {
+	if mainWindowInstance == nil {
+		return
+	}
+	mw := mainWindowInstance
+	a := fyne.CurrentApp()
+	if a == nil {
+		return
+	}
+	appTheme, ok := a.Settings().Theme().(*uitheme.Theme)
+	if !ok {
+		return
+	}
+
+	fyne.Do(func() {
+		picker := dialog.NewColorPicker("主题设置", "选择强调色（立即生效，重启后仍然保留）", func(c color.Color) {
+			if c == nil {
+				return
+			}
+			nrgba := color.NRGBAModel.Convert(c).(color.NRGBA)
+			appTheme.SetAccent(&nrgba)
+			a.Settings().SetTheme(appTheme)
+			uitheme.SaveAccent(a, nrgba)
+		}, mw.w)
+		picker.Show()
+	})
+}
+
+// PromptUpdate asks the user for consent before an update is downloaded
+// and staged. onAccept is only invoked if the user confirms.
+func PromptUpdate(version, releaseNote string, onAccept func()) {
+	if mainWindowInstance == nil {
+		return
+	}
+	mw := mainWindowInstance
+	fyne.Do(func() {
+		dialog.ShowConfirm("发现新版本",
+			fmt.Sprintf("检测到新版本 %s，是否现在下载？\n\n%s", version, releaseNote),
+			func(ok bool) {
+				if ok && onAccept != nil {
+					onAccept()
+				}
+			}, mw.w)
+	})
+}
+
 func NewMainWindow(a fyne.App) (fyne.Window, error) {
 	log.Printf("初始化配置管理器...")
 	cfg, err := config.NewManager()
@@ -205,6 +423,11 @@ func NewMainWindow(a fyne.App) (fyne.Window, error) {
 		// 配置加载失败不应该阻止程序启动
 	}
 
+	logDir := ""
+	if exe, err := os.Executable(); err == nil {
+		logDir = filepath.Join(filepath.Dir(exe), "logs")
+	}
+
 	log.Printf("创建主窗口实例...")
 	mw := &MainWindow{
 		cfg: cfg,
@@ -214,6 +437,32 @@ func NewMainWindow(a fyne.App) (fyne.Window, error) {
 		logUpdateInterval: 100 * time.Millisecond,      // Update UI every 100ms max
 		lastUIUpdate:      time.Now(),
 		logLevelFilter:    "ALL", // Show all logs by default
+		console:           console.New(logDir, 2000),
+		selectedRule:      -1,
+		logDir:            logDir,
+	}
+	mw.cron = scheduler.New(mw.onRuleFire)
+	mw.run.SetOnExit(mw.onProcessExit)
+
+	if err := mw.run.WatchConfig(cfg.ConfigFile); err != nil {
+		log.Printf("警告: 启动配置热重载监视器失败: %v", err)
+	}
+
+	if cfg.Model.Logging.Disabled {
+		log.Printf("日志文件已在配置中禁用，跳过创建")
+	} else {
+		sinkDir := cfg.Model.Logging.Dir
+		if sinkDir == "" {
+			sinkDir = logDir
+		}
+		sinkFormat := logsink.Format(cfg.Model.Logging.Format)
+		if sink, err := logsink.NewFileSink(sinkDir, sinkFormat,
+			cfg.Model.Logging.MaxSizeMB, cfg.Model.Logging.MaxAgeDays, cfg.Model.Logging.MaxBackups); err != nil {
+			log.Printf("警告: 打开日志文件失败: %v", err)
+		} else {
+			mw.logSink = sink
+			mw.logDir = sinkDir
+		}
 	}
 
 	// 设置全局实例
@@ -240,6 +489,12 @@ func NewMainWindow(a fyne.App) (fyne.Window, error) {
 	content := mw.buildLayout()
 	mw.w.SetContent(content)
 
+	mw.w.SetOnDropped(func(_ fyne.Position, uris []fyne.URI) {
+		for _, u := range uris {
+			mw.handleDroppedFile(u)
+		}
+	})
+
 	mw.ensureAtLeastOneServer()
 	mw.refreshServerSelect()
 	mw.loadCurrentToForm()
@@ -250,7 +505,7 @@ func NewMainWindow(a fyne.App) (fyne.Window, error) {
 	if mw.cfg.Model.LastState.AutoStartChecked {
 		mw.setAutoStartCheckSilently(true)
 	} else {
-		if en, err := autostart.IsEnabled(); err == nil {
+		if en, err := autostart.IsEnabled(autostart.ModeLoginItem); err == nil {
 			mw.setAutoStartCheckSilently(en)
 		}
 	}
@@ -261,6 +516,9 @@ func NewMainWindow(a fyne.App) (fyne.Window, error) {
 	// 初始化日志显示 - 确保初始状态正确
 	mw.updateLogUI()
 
+	mw.rebuildCronRules()
+	mw.cron.Start()
+
 	log.Printf("主窗口创建完成")
 	return mw.w, nil
 }
@@ -393,12 +651,22 @@ func (mw *MainWindow) initControls() {
 	mw.logScroll = container.NewVScroll(mw.logBox)
 
 	// Initialize log level filter
-	mw.logFilter = widget.NewSelect([]string{"ALL", "ERROR", "WARN", "SYSTEM", "INFO"}, func(selected string) {
+	mw.logFilter = widget.NewSelect([]string{"ALL", "ERROR", "WARN", "SCHEDULE", "SYSTEM", "INFO"}, func(selected string) {
 		mw.mu.Lock()
 		mw.logLevelFilter = selected
 		mw.mu.Unlock()
 		// Update UI with new filter
 		mw.updateLogUI()
+		// "ALL" only affects what's displayed; every other choice also
+		// raises the file sink's floor, so turning the filter down
+		// stops flooding disk with entries nobody's looking at either.
+		if mw.logSink != nil {
+			if selected == "ALL" {
+				mw.logSink.SetLevel("")
+			} else {
+				mw.logSink.SetLevel(selected)
+			}
+		}
 	})
 	mw.logFilter.SetSelected("ALL")
 	mw.logFilter.Resize(fyne.NewSize(80, 25))
@@ -417,6 +685,9 @@ func (mw *MainWindow) initControls() {
 	mw.addBtn = widget.NewButton("新增", func() { mw.addServer() })
 	mw.saveBtn = widget.NewButton("保存", func() { mw.saveFormToCurrent(true) })
 	mw.delBtn = widget.NewButton("删除", func() { mw.deleteCurrentServer() })
+	mw.subBtn = widget.NewButton("订阅", func() { mw.showSubscriptionDialog() })
+	mw.subSourceLabel = widget.NewLabel("")
+	mw.subSourceLabel.Hide()
 	mw.clearBtn = widget.NewButton("清空日志", func() {
 		// Asynchronous clear with debouncing
 		go func() {
@@ -447,6 +718,11 @@ func (mw *MainWindow) initControls() {
 	})
 	mw.stopBtn.Importance = widget.DangerImportance
 	mw.stopBtn.Disable()
+
+	mw.initRemoteControl()
+	mw.initSysProxyMode()
+	mw.initNotify()
+	mw.initSupervisor()
 }
 
 func (mw *MainWindow) installCloseHandler(a fyne.App) {
@@ -465,6 +741,16 @@ func (mw *MainWindow) installCloseHandler(a fyne.App) {
 		}
 		// 如果没有托盘，则正常退出
 		closing = true
+		if mw.cron != nil {
+			mw.cron.Stop()
+		}
+		if mw.logSink != nil {
+			_ = mw.logSink.Close()
+		}
+		if mw.console != nil {
+			_ = mw.console.Close()
+		}
+		mw.stopRemoteControl()
 		mw.shutdown()
 		mw.w.Close()
 		if a != nil {
@@ -508,12 +794,44 @@ func (mw *MainWindow) initTray(a fyne.App) {
 		}
 	})
 
+	settings := fyne.NewMenuItem("设置", func() {
+		ShowSettingsDialog()
+	})
+
+	openLogDir := fyne.NewMenuItem("打开日志目录", func() {
+		mw.openLogDir()
+	})
+	exportLogs := fyne.NewMenuItem("导出日志包", func() {
+		mw.exportLogsBundle()
+	})
+
+	notifySettings := fyne.NewMenuItem("通知设置", func() {
+		mw.showNotifySettings()
+	})
+
+	wakePeers := fyne.NewMenuItem("唤醒设备", func() {
+		mw.wakeCurrentPeers()
+	})
+	shutdownPeers := fyne.NewMenuItem("关机设备", func() {
+		mw.shutdownCurrentPeers()
+	})
+
 	quit := fyne.NewMenuItem("退出", func() {
+		if mw.cron != nil {
+			mw.cron.Stop()
+		}
+		if mw.logSink != nil {
+			_ = mw.logSink.Close()
+		}
+		if mw.console != nil {
+			_ = mw.console.Close()
+		}
+		mw.stopRemoteControl()
 		mw.shutdown()
 		a.Quit()
 	})
 
-	menu := fyne.NewMenu("ECH Workers", showHide, fyne.NewMenuItemSeparator(), quit)
+	menu := fyne.NewMenu("ECH Workers", showHide, settings, openLogDir, exportLogs, notifySettings, wakePeers, shutdownPeers, fyne.NewMenuItemSeparator(), quit)
 	da.SetSystemTrayMenu(menu)
 	mw.trayEnabled = true
 	log.Printf("系统托盘初始化完成")
@@ -535,6 +853,118 @@ func (mw *MainWindow) shutdown() {
 	_ = mw.cfg.Save()
 }
 
+// openLogDir opens the on-disk log directory in the OS's file manager,
+// backing the tray menu's "打开日志目录" entry so users can grab a
+// support bundle without knowing the path by heart.
+func (mw *MainWindow) openLogDir() {
+	dir := mw.logDir
+	if dir == "" {
+		dialog.ShowInformation("提示", "日志目录不可用", mw.w)
+		return
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		dialog.ShowError(err, mw.w)
+		return
+	}
+
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "windows":
+		cmd = exec.Command("explorer", dir)
+	case "darwin":
+		cmd = exec.Command("open", dir)
+	default:
+		cmd = exec.Command("xdg-open", dir)
+	}
+	if err := cmd.Start(); err != nil {
+		dialog.ShowError(fmt.Errorf("打开日志目录失败: %w", err), mw.w)
+	}
+}
+
+// exportLogsBundle zips every on-disk log file into a timestamped
+// archive next to them, backing the tray menu's "导出日志包" entry so
+// a user can hand one file to support instead of the whole directory.
+func (mw *MainWindow) exportLogsBundle() {
+	if mw.logSink == nil {
+		dialog.ShowInformation("提示", "日志文件未启用", mw.w)
+		return
+	}
+	if err := os.MkdirAll(mw.logDir, 0o755); err != nil {
+		dialog.ShowError(err, mw.w)
+		return
+	}
+
+	name := fmt.Sprintf("ech-wk-logs-%s.zip", time.Now().Format("20060102-150405"))
+	path := filepath.Join(mw.logDir, name)
+	f, err := os.Create(path)
+	if err != nil {
+		dialog.ShowError(fmt.Errorf("创建日志包失败: %w", err), mw.w)
+		return
+	}
+	defer f.Close()
+
+	if err := mw.logSink.Bundle(f); err != nil {
+		dialog.ShowError(fmt.Errorf("打包日志失败: %w", err), mw.w)
+		return
+	}
+	dialog.ShowInformation("已导出", "日志包已保存为:\n"+path, mw.w)
+}
+
+// wakeCurrentPeers sends a Wake-on-LAN magic packet to every peer
+// device configured on the current server, backing the tray menu's
+// "唤醒设备" entry so a home machine can be woken before connecting
+// through the proxy.
+func (mw *MainWindow) wakeCurrentPeers() {
+	peers, ok := mw.currentPeers()
+	if !ok {
+		return
+	}
+	var failed []string
+	for _, peer := range peers {
+		if err := wol.Wake(peer); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", peer.Name, err))
+		}
+	}
+	mw.showPeerActionResult("唤醒设备", len(peers), failed)
+}
+
+// shutdownCurrentPeers calls the ech-wk-agent Shutdown endpoint for
+// every peer device configured on the current server that has one,
+// backing the tray menu's "关机设备" entry.
+func (mw *MainWindow) shutdownCurrentPeers() {
+	peers, ok := mw.currentPeers()
+	if !ok {
+		return
+	}
+	var failed []string
+	for _, peer := range peers {
+		if peer.AgentEndpoint == "" {
+			continue
+		}
+		if err := wol.Shutdown(peer); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", peer.Name, err))
+		}
+	}
+	mw.showPeerActionResult("关机设备", len(peers), failed)
+}
+
+func (mw *MainWindow) currentPeers() ([]config.PeerDevice, bool) {
+	cur, ok := mw.cfg.GetCurrentServer()
+	if !ok || len(cur.Peers) == 0 {
+		dialog.ShowInformation("提示", "当前服务器未配置任何设备", mw.w)
+		return nil, false
+	}
+	return cur.Peers, true
+}
+
+func (mw *MainWindow) showPeerActionResult(action string, total int, failed []string) {
+	if len(failed) == 0 {
+		dialog.ShowInformation(action, fmt.Sprintf("已对 %d 台设备发起%s", total, action), mw.w)
+		return
+	}
+	dialog.ShowError(fmt.Errorf("%s 部分失败:\n%s", action, strings.Join(failed, "\n")), mw.w)
+}
+
 func (mw *MainWindow) buildLayout() fyne.CanvasObject {
 	serverBar := container.NewBorder(nil, nil,
 		widget.NewLabel("选择服务器"),
@@ -543,6 +973,7 @@ func (mw *MainWindow) buildLayout() fyne.CanvasObject {
 			mw.addBtn,
 			mw.saveBtn,
 			mw.delBtn,
+			mw.subBtn,
 		),
 	)
 
@@ -565,6 +996,13 @@ func (mw *MainWindow) buildLayout() fyne.CanvasObject {
 		mw.proxyCheck,
 		layout.NewSpacer(),
 		mw.autoStartCheck,
+		layout.NewSpacer(),
+		mw.remoteCheck,
+		layout.NewSpacer(),
+		mw.pacModeCheck,
+		layout.NewSpacer(),
+		mw.autoRestartCheck,
+		mw.crashStatusLabel,
 	)
 
 	buttons := container.NewHBox(
@@ -586,8 +1024,14 @@ func (mw *MainWindow) buildLayout() fyne.CanvasObject {
 
 	logGroup := container.NewBorder(logHeader, nil, nil, nil, mw.logScroll)
 
-	contentTop := container.NewVBox(serverBar, form, buttons)
-	return container.NewBorder(contentTop, nil, nil, nil, logGroup)
+	contentTop := container.NewVBox(serverBar, form, mw.subSourceLabel, buttons)
+	mainTab := container.NewBorder(contentTop, nil, nil, nil, logGroup)
+
+	return container.NewAppTabs(
+		container.NewTabItem("主页", mainTab),
+		container.NewTabItem("控制台", mw.console.CanvasObject()),
+		container.NewTabItem("定时任务", mw.buildScheduleTab()),
+	)
 }
 
 func (mw *MainWindow) ensureAtLeastOneServer() {
@@ -664,6 +1108,8 @@ func (mw *MainWindow) loadCurrentToForm() {
 	mw.setServerSelectSilently(s.Name)
 	mw.suppressChanges = false
 
+	mw.applySubscriptionLock(s)
+
 	// update snapshots used for "lock while running"
 	mw.lastName = s.Name
 	mw.lastSrv = s.Server
@@ -681,6 +1127,10 @@ func (mw *MainWindow) saveFormToCurrent(showToast bool) {
 	if !ok {
 		return
 	}
+	if showToast && s.SubscriptionID != "" {
+		dialog.ShowInformation("提示", "订阅管理的服务器不可编辑", mw.w)
+		return
+	}
 
 	s.Name = strings.TrimSpace(mw.name.Text)
 	s.Server = strings.TrimSpace(mw.server.Real())
@@ -751,6 +1201,10 @@ func (mw *MainWindow) deleteCurrentServer() {
 	if !ok {
 		return
 	}
+	if cur.SubscriptionID != "" {
+		dialog.ShowInformation("提示", "订阅管理的服务器不可删除，请在订阅设置中删除对应订阅", mw.w)
+		return
+	}
 	dialog.ShowConfirm("确认删除", fmt.Sprintf("确定要删除服务器 \"%s\" 吗？", cur.Name), func(ok bool) {
 		if !ok {
 			return
@@ -824,6 +1278,7 @@ func (mw *MainWindow) onStart() {
 		return
 	}
 	mw.setRunningState(true)
+	mw.notifyEvent("connected", fmt.Sprintf("已连接到 %s", cur.Name))
 
 	// 记录 last_state
 	mw.cfg.Model.LastState.WasRunning = true
@@ -835,10 +1290,21 @@ func (mw *MainWindow) onStart() {
 	}
 }
 
+// onProcessExit is registered as the process.Runner's exit callback; it
+// only fires for an external-mode child that exited without a
+// preceding Stop() call, i.e. an unexpected disconnect or crash.
+func (mw *MainWindow) onProcessExit() {
+	fyne.Do(func() {
+		mw.appendLog("[警告] 代理进程意外退出\n")
+		mw.notifyEvent("crash", "代理进程意外退出")
+		mw.onStopped()
+	})
+}
+
 func (mw *MainWindow) onStopped() {
 	// 停止时自动清理系统代理
 	if mw.systemProxyEnabled {
-		if err := sysproxy.Set(false, ""); err == nil {
+		if err := mw.applySystemProxy(false, ""); err == nil {
 			mw.appendLog("[系统] 已自动清理系统代理\n")
 		}
 		mw.systemProxyEnabled = false
@@ -847,6 +1313,9 @@ func (mw *MainWindow) onStopped() {
 		mw.setProxyCheckSilently(false)
 	}
 
+	if mw.running {
+		mw.notifyEvent("disconnected", "代理已停止")
+	}
 	mw.setRunningState(false)
 	mw.cfg.Model.LastState.WasRunning = false
 	_ = mw.cfg.Save()
@@ -877,6 +1346,9 @@ func (mw *MainWindow) setRunningState(running bool) {
 			mw.addBtn.Enable()
 			mw.saveBtn.Enable()
 			mw.delBtn.Enable()
+			if cur, ok := mw.cfg.GetCurrentServer(); ok {
+				mw.applySubscriptionLock(cur)
+			}
 		}
 	}
 
@@ -1083,6 +1555,9 @@ func parseLogLevel(message string) string {
 	if strings.HasPrefix(message, "[警告]") || strings.Contains(message, "WARN") || strings.Contains(message, "warn") {
 		return "WARN"
 	}
+	if strings.HasPrefix(message, "[定时任务]") || strings.Contains(message, "SCHEDULE") {
+		return "SCHEDULE"
+	}
 	if strings.HasPrefix(message, "[系统]") || strings.Contains(message, "SYSTEM") {
 		return "SYSTEM"
 	}
@@ -1177,6 +1652,22 @@ func (mw *MainWindow) setLogText(s string) {
 	}
 }
 
+// currentLogFields captures the form's current server context so file
+// sink records carry enough to tell servers apart after the fact.
+func (mw *MainWindow) currentLogFields() map[string]string {
+	fields := map[string]string{}
+	if mw.name != nil && mw.name.Text != "" {
+		fields["server"] = mw.name.Text
+	}
+	if mw.listen != nil && mw.listen.Text != "" {
+		fields["listen"] = mw.listen.Text
+	}
+	if mw.routing != nil && mw.routing.Selected != "" {
+		fields["routing"] = mw.routing.Selected
+	}
+	return fields
+}
+
 func (mw *MainWindow) appendLog(s string) {
 	mw.mu.Lock()
 	defer mw.mu.Unlock()
@@ -1194,12 +1685,40 @@ func (mw *MainWindow) appendLog(s string) {
 	// Add to buffer with intelligent limiting
 	if mw.logBuffer != nil {
 		logLevel := parseLogLevel(s)
+		fields := mw.currentLogFields()
 		mw.logBuffer.Add(LogEntry{
 			Timestamp: time.Now(),
 			Level:     logLevel,
 			Message:   s,
+			Fields:    fields,
 		})
 
+		// ERROR/WARN entries fan out to the notifier too, rate-limited
+		// per level the same way as every other event type.
+		if logLevel == "ERROR" || logLevel == "WARN" {
+			mw.notifyEvent("log-"+strings.ToLower(logLevel), strings.TrimSpace(s))
+		}
+
+		if mw.logSink != nil {
+			if err := mw.logSink.Write(logsink.Record{
+				Time:    time.Now(),
+				Level:   logLevel,
+				Message: strings.TrimRight(s, "\n"),
+				Fields:  fields,
+			}); err != nil {
+				log.Printf("警告: 写入日志文件失败: %v", err)
+			}
+		}
+
+		if mw.controlBroker != nil {
+			mw.controlBroker.Publish(control.LogEvent{
+				Timestamp: time.Now().Format(time.RFC3339),
+				Level:     logLevel,
+				Message:   strings.TrimRight(s, "\n"),
+				Fields:    fields,
+			})
+		}
+
 		// Schedule debounced UI update
 		mw.scheduleLogUpdate()
 	} else {
@@ -1252,7 +1771,7 @@ func (mw *MainWindow) restoreLastState() {
 	if mw.cfg.Model.LastState.AutoStartChecked {
 		mw.setAutoStartCheckSilently(true)
 	} else {
-		if en, err := autostart.IsEnabled(); err == nil {
+		if en, err := autostart.IsEnabled(autostart.ModeLoginItem); err == nil {
 			mw.setAutoStartCheckSilently(en)
 		}
 	}
@@ -1300,9 +1819,9 @@ func (mw *MainWindow) onAutoStartChanged() {
 	enabled := mw.autoStartCheck.Checked
 	var err error
 	if enabled {
-		err = autostart.Enable()
+		err = autostart.Enable(autostart.ModeLoginItem)
 	} else {
-		err = autostart.Disable()
+		err = autostart.Disable(autostart.ModeLoginItem)
 	}
 	if err != nil {
 		mw.setAutoStartCheckSilently(!enabled)
@@ -1313,8 +1832,10 @@ func (mw *MainWindow) onAutoStartChanged() {
 	_ = mw.cfg.Save()
 	if enabled {
 		mw.appendLog("[系统] 已设置开机启动\n")
+		mw.notifyEvent("autostart-on", "已设置开机启动")
 	} else {
 		mw.appendLog("[系统] 已取消开机启动\n")
+		mw.notifyEvent("autostart-off", "已取消开机启动")
 	}
 }
 
@@ -1330,7 +1851,7 @@ func (mw *MainWindow) onProxyChanged() {
 		mw.tryEnableProxyFromUI()
 		return
 	}
-	if err := sysproxy.Set(false, ""); err != nil {
+	if err := mw.applySystemProxy(false, ""); err != nil {
 		mw.setProxyCheckSilently(true)
 		dialog.ShowError(err, mw.w)
 		return
@@ -1339,6 +1860,7 @@ func (mw *MainWindow) onProxyChanged() {
 	mw.cfg.Model.LastState.SystemProxyEnabled = false
 	_ = mw.cfg.Save()
 	mw.appendLog("[系统] 已关闭系统代理\n")
+	mw.notifyEvent("proxy-off", "系统代理已关闭")
 }
 
 func (mw *MainWindow) tryEnableProxyFromUI() {
@@ -1351,7 +1873,7 @@ func (mw *MainWindow) tryEnableProxyFromUI() {
 		dialog.ShowInformation("提示", "当前分流模式为\"none\"，不设置系统代理", mw.w)
 		return
 	}
-	if err := sysproxy.Set(true, cur.Listen); err != nil {
+	if err := mw.applySystemProxy(true, cur.Listen); err != nil {
 		mw.setProxyCheckSilently(false)
 		dialog.ShowError(err, mw.w)
 		return
@@ -1360,6 +1882,7 @@ func (mw *MainWindow) tryEnableProxyFromUI() {
 	mw.cfg.Model.LastState.SystemProxyEnabled = true
 	_ = mw.cfg.Save()
 	mw.appendLog("[系统] 已设置系统代理\n")
+	mw.notifyEvent("proxy-on", "系统代理已设置")
 }
 
 func (mw *MainWindow) onRoutingChanged() {
@@ -1370,7 +1893,7 @@ func (mw *MainWindow) onRoutingChanged() {
 		return
 	}
 	if mw.routing.Selected == "none" {
-		_ = sysproxy.Set(false, "")
+		_ = mw.applySystemProxy(false, "")
 		mw.systemProxyEnabled = false
 		mw.cfg.Model.LastState.SystemProxyEnabled = false
 		_ = mw.cfg.Save()
@@ -1382,7 +1905,7 @@ func (mw *MainWindow) onRoutingChanged() {
 	if !ok {
 		return
 	}
-	_ = sysproxy.Set(true, cur.Listen)
+	_ = mw.applySystemProxy(true, cur.Listen)
 	mw.appendLog("[系统] 分流模式已变更，已更新系统代理设置\n")
 }
 
@@ -1418,6 +1941,11 @@ func (mw *MainWindow) onWindowClosing() {
 	mw.saveFormToCurrent(false)
 	_ = mw.cfg.Save()
 
+	// 落盘日志文件
+	if mw.logSink != nil {
+		_ = mw.logSink.Flush()
+	}
+
 	// 关闭窗口
 	mw.w.Close()
 }
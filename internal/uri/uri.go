@@ -0,0 +1,58 @@
+// Package uri parses the app's custom `ech://` deep-link scheme into a
+// structured import request. It does no config mutation itself — that
+// stays in the ui package behind a confirmation dialog, so a drive-by
+// link can at worst be parsed, never silently applied.
+package uri
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// Scheme is the URI scheme this app registers with the OS.
+const Scheme = "ech"
+
+// ImportRequest is the result of parsing an `ech://import?...` link.
+type ImportRequest struct {
+	Name       string // display name for the new server entry, optional
+	Server     string // server address (host:port), optional
+	SNI        string // ECH outer SNI / domain
+	ConfigList string // base64 ECHConfigList, informational only today:
+	// the client fetches ECH configs live via DoH rather than pinning a
+	// static list, so this is surfaced to the user/log rather than
+	// written into config.Server.
+	DNS string // DoH resolver override, optional
+}
+
+// Parse turns a raw `ech://...` link into an ImportRequest. Only the
+// "import" host/action is currently understood.
+func Parse(raw string) (*ImportRequest, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("解析链接失败: %w", err)
+	}
+	if u.Scheme != Scheme {
+		return nil, fmt.Errorf("不支持的协议: %s", u.Scheme)
+	}
+
+	action := u.Host
+	if action == "" {
+		action = u.Opaque
+	}
+	if action != "import" {
+		return nil, fmt.Errorf("不支持的操作: %s", action)
+	}
+
+	q := u.Query()
+	req := &ImportRequest{
+		Name:       q.Get("name"),
+		Server:     q.Get("server"),
+		SNI:        q.Get("sni"),
+		ConfigList: q.Get("configlist"),
+		DNS:        q.Get("dns"),
+	}
+	if req.SNI == "" && req.ConfigList == "" {
+		return nil, fmt.Errorf("链接缺少 sni 或 configlist 参数")
+	}
+	return req, nil
+}
@@ -1,15 +1,37 @@
 package main
 
 import (
+	"encoding/hex"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"fyne.io/fyne/v2/app"
+	"github.com/juerson/ech-wk/client-gui-go/internal/ipc"
 	"github.com/juerson/ech-wk/client-gui-go/internal/ui"
+	uitheme "github.com/juerson/ech-wk/client-gui-go/internal/ui/theme"
+	"github.com/juerson/ech-wk/client-gui-go/internal/updater"
+)
+
+// appVersion is stamped at build time via -ldflags "-X main.appVersion=...".
+var appVersion = "dev"
+
+// updateManifestURL and updatePublicKeyHex are filled in at build time
+// from the release signing key; left empty, update checks are inert.
+var (
+	updateManifestURL  = ""
+	updatePublicKeyHex = ""
 )
 
 func main() {
+	// 如果是由 Windows 服务控制管理器启动的，直接以服务方式运行内嵌代理，
+	// 不创建 Fyne 窗口（见 autostart.Enable(autostart.ModeService)）。
+	if isService, err := isWindowsService(); err == nil && isService {
+		runWindowsService()
+		return
+	}
+
 	// Ensure working directory is set to executable directory
 	// This is crucial for relative paths (config, resources) to work
 	if exe, err := os.Executable(); err == nil {
@@ -20,9 +42,27 @@ func main() {
 		}
 	}
 
+	// 应用上次已下载好的更新（如果有）
+	if err := updater.ApplyOnNextLaunch(); err != nil {
+		log.Printf("警告: 应用待安装更新失败: %v", err)
+	}
+
+	// 如果已有实例在运行，把本次启动参数转发给它，然后直接退出
+	args := os.Args[1:]
+	if ipc.TryNotifyRunning(args) {
+		log.Printf("检测到已运行的实例，已转发请求并退出")
+		return
+	}
+
 	log.Printf("创建Fyne应用...")
 	a := app.New()
 
+	appTheme := uitheme.New()
+	if accent := uitheme.SavedAccent(a); accent != nil {
+		appTheme.SetAccent(accent)
+	}
+	a.Settings().SetTheme(appTheme)
+
 	// 设置应用图标
 	if icon := ui.WindowIconResource(); icon != nil {
 		a.SetIcon(icon)
@@ -38,6 +78,70 @@ func main() {
 	log.Printf("初始化系统托盘...")
 	ui.InitTray(a, w)
 
+	log.Printf("启动单实例 IPC 服务...")
+	ipcServer, err := ipc.Serve(&ipc.Handler{
+		Show:   ui.Show,
+		Hide:   ui.HideToTray,
+		Reload: ui.ReloadConfig,
+		Apply:  ui.ApplyURI,
+	})
+	if err != nil {
+		log.Printf("警告: 启动单实例 IPC 服务失败: %v", err)
+	} else {
+		defer ipcServer.Close()
+	}
+
+	// 冷启动时自带的 ech:// 链接，等窗口初始化完成后再应用
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "ech://") {
+			_ = ui.ApplyURI(arg)
+		}
+	}
+
+	checkForUpdates()
+
 	log.Printf("显示并运行应用...")
 	w.ShowAndRun()
 }
+
+// checkForUpdates polls the signed update manifest in the background and,
+// if a newer version is available, asks the user for consent before
+// downloading it. The downloaded binary is only applied on the next
+// launch via updater.ApplyOnNextLaunch.
+func checkForUpdates() {
+	if updateManifestURL == "" || updatePublicKeyHex == "" {
+		return
+	}
+	pubKey, err := hex.DecodeString(updatePublicKeyHex)
+	if err != nil {
+		log.Printf("警告: 更新公钥格式无效: %v", err)
+		return
+	}
+
+	cfg := updater.Config{
+		ManifestURL: updateManifestURL,
+		PublicKey:   pubKey,
+		CurrentVer:  appVersion,
+	}
+
+	go func() {
+		result, err := updater.Check(cfg)
+		if err != nil {
+			log.Printf("[更新] 检查更新失败: %v", err)
+			return
+		}
+		if !result.Available {
+			return
+		}
+		ui.PromptUpdate(result.Manifest.Version, result.Manifest.ReleaseNote, func() {
+			go func() {
+				path, err := updater.Download(cfg, result.Manifest)
+				if err != nil {
+					log.Printf("[更新] 下载更新失败: %v", err)
+					return
+				}
+				log.Printf("[更新] 已暂存新版本: %s，将在下次启动时生效", path)
+			}()
+		})
+	}()
+}
@@ -0,0 +1,10 @@
+//go:build !windows
+
+package main
+
+// isWindowsService always reports false on non-Windows platforms; those
+// use autostart.ModeService's launchd/systemd backends, which run the
+// normal executable rather than invoking it through an SCM-style handler.
+func isWindowsService() (bool, error) { return false, nil }
+
+func runWindowsService() {}
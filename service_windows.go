@@ -0,0 +1,82 @@
+//go:build windows
+
+package main
+
+import (
+	"log"
+
+	"github.com/juerson/ech-wk/client-gui-go/internal/autostart"
+	"github.com/juerson/ech-wk/client-gui-go/internal/config"
+	"github.com/juerson/ech-wk/client-gui-go/internal/process"
+	"golang.org/x/sys/windows/svc"
+)
+
+// isWindowsService reports whether this process was started by the
+// Windows Service Control Manager (autostart.Enable(ModeService)) rather
+// than interactively, so main can skip the Fyne GUI entirely.
+func isWindowsService() (bool, error) {
+	return svc.IsWindowsService()
+}
+
+// runWindowsService runs the embedded proxy for the currently selected
+// server under the SCM until it sends a Stop or Shutdown control,
+// translating those into EmbeddedRunner.Stop(). It returns once the
+// service has stopped; setup or svc.Run failures exit via log.Fatal.
+func runWindowsService() {
+	cfg, err := config.NewManager()
+	if err != nil {
+		log.Fatalf("加载配置失败: %v", err)
+	}
+	if err := cfg.Load(); err != nil {
+		log.Fatalf("加载配置失败: %v", err)
+	}
+	srv, ok := cfg.GetCurrentServer()
+	if !ok {
+		log.Fatal("未配置任何服务器，无法以服务方式启动")
+	}
+
+	runner := process.NewEmbeddedRunner(func(s string) { log.Print(s) })
+	runnerCfg := process.Config{
+		Server:      srv.Server,
+		Listen:      srv.Listen,
+		Token:       srv.Token,
+		IP:          srv.IP,
+		DNS:         srv.DNS,
+		ECH:         srv.ECH,
+		RoutingMode: srv.RoutingMode,
+	}
+
+	h := &windowsServiceHandler{runner: runner, cfg: runnerCfg}
+	if err := svc.Run(autostart.ServiceName, h); err != nil {
+		log.Fatalf("服务运行失败: %v", err)
+	}
+}
+
+type windowsServiceHandler struct {
+	runner *process.EmbeddedRunner
+	cfg    process.Config
+}
+
+func (h *windowsServiceHandler) Execute(args []string, r <-chan svc.ChangeRequest, s chan<- svc.Status) (bool, uint32) {
+	const accepted = svc.AcceptStop | svc.AcceptShutdown
+	s <- svc.Status{State: svc.StartPending}
+
+	if err := h.runner.Start(h.cfg, func(string) {}); err != nil {
+		log.Printf("启动内嵌代理失败: %v", err)
+		return false, 1
+	}
+	s <- svc.Status{State: svc.Running, Accepts: accepted}
+
+	for c := range r {
+		switch c.Cmd {
+		case svc.Interrogate:
+			s <- c.CurrentStatus
+		case svc.Stop, svc.Shutdown:
+			s <- svc.Status{State: svc.StopPending}
+			h.runner.Stop()
+			s <- svc.Status{State: svc.Stopped}
+			return false, 0
+		}
+	}
+	return false, 0
+}